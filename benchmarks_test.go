@@ -225,7 +225,7 @@ func BenchmarkFullTile(b *testing.B) {
 	}
 }
 
-func BenchmarkProcessGeoJSON(b *testing.B) {
+func BenchmarkProcessZooms(b *testing.B) {
 	config, err := Load("config/queries.yaml")
 	if err != nil {
 		b.Fatalf("unable to load layer: %v", err)
@@ -234,28 +234,122 @@ func BenchmarkProcessGeoJSON(b *testing.B) {
 	tile := maptile.New(17896, 24450, 16)
 	data := loadFile(b, tile)
 
-	input, err := convertToGeoJSON(data, tile.Bound())
-	if err != nil {
-		b.Fatalf("convert failed: %v", err)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := config.ProcessZooms(data, tile, 16, 18)
+		if err != nil {
+			b.Fatalf("procces failure: %v", err)
+		}
 	}
+}
 
-	ctx := &zenContext{
-		Zoom:  tile.Z,
-		Bound: tile.Bound(),
-		OSM:   data,
+func BenchmarkProcessElements(b *testing.B) {
+	config, err := Load("config/queries.yaml")
+	if err != nil {
+		b.Fatalf("unable to load layer: %v", err)
 	}
-	ctx.ComputeMembership()
+
+	tile := maptile.New(17896, 24450, 16)
+	data := loadFile(b, tile)
+
+	idx := NewMembershipIndex(data)
+	ctx := newZenContext(nil, data, tile.Bound(), tile.Z, idx)
 
 	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := config.processGeoJSON(ctx, input, tile.Z)
+		input := buildElements(data, tile.Bound(), idx)
+		_, err := config.processElements(ctx, input, tile.Z)
 		if err != nil {
 			b.Fatalf("procces failure: %v", err)
 		}
 	}
 }
 
+// The filter match benchmarks compare finding the first matching filter
+// using the index to trying every filter in order.
+
+func BenchmarkFilterMatch_index(b *testing.B) {
+	benchmarkFilterMatch(b, func(l *Layer, ctx *filter.Context) *filter.Filter {
+		return l.index.Match(ctx)
+	})
+}
+
+func BenchmarkFilterMatch_linear(b *testing.B) {
+	benchmarkFilterMatch(b, func(l *Layer, ctx *filter.Context) *filter.Filter {
+		for _, f := range l.filters {
+			if f.Match(ctx) {
+				return f
+			}
+		}
+
+		return nil
+	})
+}
+
+func benchmarkFilterMatch(b *testing.B, match func(*Layer, *filter.Context) *filter.Filter) {
+	config, err := Load("config/queries.yaml")
+	if err != nil {
+		b.Fatalf("unable to load layer: %v", err)
+	}
+
+	tile := maptile.New(17896, 24450, 16)
+	data := loadFile(b, tile)
+	elements := buildElements(data, tile.Bound(), NewMembershipIndex(data))
+
+	ctx := &filter.Context{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, name := range config.All {
+			l := config.Layers[name]
+			for j := range elements {
+				ctx = filter.NewContextFromElement(ctx, &elements[j])
+				match(l, ctx)
+			}
+		}
+	}
+}
+
+// The convert benchmarks compare building the elements, where the geometry
+// is built lazily, to a full conversion to geojson using osmgeojson.
+
+func BenchmarkConvert_elements(b *testing.B) {
+	tile := maptile.New(17896, 24450, 16)
+	data := loadFile(b, tile)
+
+	// the index is also used for the membership so it's built once
+	// per call to Process either way.
+	idx := NewMembershipIndex(data)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buildElements(data, tile.Bound(), idx)
+	}
+}
+
+func BenchmarkConvert_osmgeojson(b *testing.B) {
+	tile := maptile.New(17896, 24450, 16)
+	data := loadFile(b, tile)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := osmgeojson.Convert(data,
+			osmgeojson.IncludeInvalidPolygons(true),
+			osmgeojson.NoID(true),
+			osmgeojson.NoMeta(true),
+			osmgeojson.NoRelationMembership(true),
+		)
+		if err != nil {
+			b.Fatalf("convert failure: %v", err)
+		}
+	}
+}
+
 func loadFile(t testing.TB, tile maptile.Tile) *osm.OSM {
 	filename := fmt.Sprintf("testdata/tile-%d-%d-%d.xml", tile.Z, tile.X, tile.Y)
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
@@ -0,0 +1,462 @@
+package osmzen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/paulmach/osmzen/filter"
+	"github.com/paulmach/osmzen/postprocess"
+	"github.com/paulmach/osmzen/transform"
+)
+
+// A Catalog describes the layers and feature properties created by a config.
+// It can be exported as a JSON Schema, TileJSON vector_layers or a taginfo
+// project file.
+type Catalog struct {
+	Layers []*LayerCatalog `json:"layers"`
+}
+
+// LayerCatalog describes the properties of the features in a layer
+// and the osm tags used to create them.
+type LayerCatalog struct {
+	Name          string             `json:"name"`
+	GeometryTypes []string           `json:"geometry_types"`
+	Properties    []*PropertyCatalog `json:"properties"`
+	Tags          []*TagUsage        `json:"tags"`
+}
+
+// PropertyCatalog describes a feature property.
+type PropertyCatalog struct {
+	Key string `json:"key"`
+
+	// Types are the json types of the values, eg. string, number, boolean
+	// or array. Can be empty if unknown, eg. copied from another property.
+	Types []string `json:"types,omitempty"`
+
+	// Values are the enumerable string values, eg. the kinds.
+	// Computed is true if the property can have other values.
+	Values   []string `json:"values,omitempty"`
+	Computed bool     `json:"computed,omitempty"`
+
+	// Sources are where the property is set, eg. `filter`,
+	// `transform:road_classifier` or `postprocess:csv_match_properties`.
+	Sources []string `json:"sources"`
+}
+
+// TagUsage is an osm tag used by the filters of a layer.
+type TagUsage struct {
+	Key         string   `json:"key"`
+	Value       string   `json:"value,omitempty"`
+	ObjectTypes []string `json:"object_types"`
+	Kinds       []string `json:"kinds,omitempty"`
+}
+
+// Catalog statically builds the catalog of the layers, properties and
+// kinds from the filter outputs, transforms and post processors.
+func (c *Config) Catalog() *Catalog {
+	cat := &Catalog{}
+
+	layers := make(map[string]*layerBuilder, len(c.All))
+	for _, name := range c.All {
+		l := c.Layers[name]
+		lb := &layerBuilder{
+			layer: &LayerCatalog{
+				Name:          name,
+				GeometryTypes: l.GeometryTypes,
+			},
+			properties: make(map[string]*PropertyCatalog),
+			tags:       make(map[[2]string]*TagUsage),
+		}
+		layers[name] = lb
+		cat.Layers = append(cat.Layers, lb.layer)
+
+		for _, p := range processProperties {
+			lb.add(p.Key, "process", []string{p.Type}, p.Values, p.Computed)
+		}
+
+		for _, f := range l.filters {
+			lb.addFilter(f)
+		}
+
+		for _, t := range l.Transforms {
+			source := "transform:" + strings.TrimPrefix(t, "vectordatasource.transform.")
+			for _, p := range transform.Properties(t) {
+				lb.add(p.Key, source, []string{p.Type}, p.Values, p.Computed)
+			}
+		}
+	}
+
+	addPostProcess := func(source string, props []postprocess.Property) {
+		for _, p := range props {
+			var types []string
+			if p.Type != "" {
+				types = []string{p.Type}
+			}
+
+			for _, name := range c.All {
+				if p.Layer == "" || p.Layer == name {
+					layers[name].add(p.Key, source, types, p.Values, p.Computed)
+				}
+			}
+		}
+	}
+
+	addPostProcess("postprocess:set_conditional_names", postprocess.SetConditionalNamesProperties)
+	for i, f := range c.postProcessors {
+		if ps, ok := f.(postprocess.PropertySetter); ok {
+			name := strings.TrimPrefix(c.PostProcess[i].Func, "vectordatasource.transform.")
+			addPostProcess("postprocess:"+name, ps.OutputProperties())
+		}
+	}
+
+	for _, name := range c.All {
+		layers[name].finish()
+	}
+
+	return cat
+}
+
+// Layer returns the catalog of the layer, nil if not found.
+func (cat *Catalog) Layer(name string) *LayerCatalog {
+	for _, l := range cat.Layers {
+		if l.Name == name {
+			return l
+		}
+	}
+
+	return nil
+}
+
+// Property returns the catalog of the property, nil if not found.
+func (l *LayerCatalog) Property(key string) *PropertyCatalog {
+	for _, p := range l.Properties {
+		if p.Key == key {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// processProperties are set on every feature while processing,
+// they replace any filter output with the same key.
+var processProperties = []postprocess.Property{
+	{Key: "id", Type: "number", Computed: true},
+	{Key: "type", Type: "string", Values: []interface{}{"node", "way", "relation"}},
+	{Key: "min_zoom", Type: "number", Computed: true},
+}
+
+type layerBuilder struct {
+	layer      *LayerCatalog
+	properties map[string]*PropertyCatalog
+	tags       map[[2]string]*TagUsage
+}
+
+func (lb *layerBuilder) add(key, source string, types []string, values []interface{}, computed bool) {
+	p := lb.properties[key]
+	if p == nil {
+		p = &PropertyCatalog{Key: key}
+		lb.properties[key] = p
+	}
+
+	p.Sources = appendString(p.Sources, source)
+	for _, t := range types {
+		p.Types = appendString(p.Types, t)
+	}
+
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			p.Values = appendString(p.Values, s)
+		}
+	}
+
+	p.Computed = p.Computed || computed
+}
+
+func (lb *layerBuilder) addFilter(f *filter.Filter) {
+outputs:
+	for _, o := range f.Output {
+		for _, p := range processProperties {
+			if p.Key == o.Key {
+				continue outputs
+			}
+		}
+
+		ov := f.OutputValues(o.Key)
+		if ov == nil {
+			continue
+		}
+
+		lb.add(o.Key, "filter", ov.Types, ov.Values, ov.Computed)
+	}
+
+	kinds := f.OutputValues("kind")
+	if kinds == nil {
+		return
+	}
+
+	for _, v := range kinds.Values {
+		if kind, ok := v.(string); ok {
+			lb.addTags(f.Combinations(map[string]string{"kind": kind}), kind)
+		}
+	}
+
+	if kinds.Computed {
+		lb.addTags(f.Combinations(nil), "")
+	}
+}
+
+// addTags adds the osm tags required by the combinations.
+func (lb *layerBuilder) addTags(combinations []filter.Combination, kind string) {
+	for _, comb := range combinations {
+		types := comb.GeometryTypes
+		if len(types) == 0 {
+			types = lb.layer.GeometryTypes
+		}
+
+		var objectTypes []string
+		for _, t := range types {
+			if stringIn(t, lb.layer.GeometryTypes) {
+				objectTypes = appendString(objectTypes, osmObjectTypes[t])
+			}
+		}
+
+		if len(objectTypes) == 0 {
+			continue
+		}
+
+		for _, t := range comb.Tags {
+			if t.Not {
+				continue
+			}
+
+			values := t.Values
+			if len(values) == 0 {
+				values = []string{""}
+			}
+
+			for _, v := range values {
+				tu := lb.tags[[2]string{t.Key, v}]
+				if tu == nil {
+					tu = &TagUsage{Key: t.Key, Value: v}
+					lb.tags[[2]string{t.Key, v}] = tu
+				}
+
+				for _, ot := range objectTypes {
+					tu.ObjectTypes = appendString(tu.ObjectTypes, ot)
+				}
+
+				if kind != "" {
+					tu.Kinds = appendString(tu.Kinds, kind)
+				}
+			}
+		}
+	}
+}
+
+// osmObjectTypes maps the geometry types to the taginfo object types.
+var osmObjectTypes = map[string]string{
+	"Point":           "node",
+	"MultiPoint":      "node",
+	"LineString":      "way",
+	"MultiLineString": "relation",
+	"Polygon":         "area",
+	"MultiPolygon":    "area",
+}
+
+func (lb *layerBuilder) finish() {
+	for _, p := range lb.properties {
+		sort.Strings(p.Types)
+		sort.Strings(p.Values)
+		lb.layer.Properties = append(lb.layer.Properties, p)
+	}
+
+	sort.Slice(lb.layer.Properties, func(i, j int) bool {
+		return lb.layer.Properties[i].Key < lb.layer.Properties[j].Key
+	})
+
+	for _, t := range lb.tags {
+		sort.Strings(t.ObjectTypes)
+		sort.Strings(t.Kinds)
+		lb.layer.Tags = append(lb.layer.Tags, t)
+	}
+
+	sort.Slice(lb.layer.Tags, func(i, j int) bool {
+		a, b := lb.layer.Tags[i], lb.layer.Tags[j]
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+
+		return a.Value < b.Value
+	})
+}
+
+// JSONSchema returns a JSON Schema describing the feature properties
+// of each layer. The top level properties are the layer names.
+func (cat *Catalog) JSONSchema() map[string]interface{} {
+	layers := make(map[string]interface{}, len(cat.Layers))
+	for _, l := range cat.Layers {
+		props := make(map[string]interface{}, len(l.Properties))
+		for _, p := range l.Properties {
+			schema := map[string]interface{}{}
+			if len(p.Types) == 1 {
+				schema["type"] = p.Types[0]
+			} else if len(p.Types) > 1 {
+				schema["type"] = p.Types
+			}
+
+			if !p.Computed && len(p.Values) > 0 && len(p.Types) == 1 && p.Types[0] == "string" {
+				schema["enum"] = p.Values
+			} else if len(p.Values) > 0 {
+				schema["examples"] = p.Values
+			}
+
+			if len(p.Types) == 1 && p.Types[0] == "array" {
+				schema["items"] = map[string]interface{}{"type": "string"}
+			}
+
+			props[p.Key] = schema
+		}
+
+		layers[l.Name] = map[string]interface{}{
+			"type":       "object",
+			"properties": props,
+		}
+	}
+
+	return map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       "osmzen feature properties",
+		"description": "The properties of the features in each layer.",
+		"type":        "object",
+		"properties":  layers,
+	}
+}
+
+// VectorLayer is a TileJSON vector_layers entry.
+// https://github.com/mapbox/tilejson-spec/tree/master/3.0.0#33-vector_layers
+type VectorLayer struct {
+	ID     string            `json:"id"`
+	Fields map[string]string `json:"fields"`
+}
+
+// VectorLayers returns the layers and their fields for a TileJSON document.
+// The field values are the type of the property, eg. String or Number,
+// or Mixed if the property can have more than one type.
+func (cat *Catalog) VectorLayers() []VectorLayer {
+	result := make([]VectorLayer, 0, len(cat.Layers))
+	for _, l := range cat.Layers {
+		vl := VectorLayer{
+			ID:     l.Name,
+			Fields: make(map[string]string, len(l.Properties)),
+		}
+
+		for _, p := range l.Properties {
+			vl.Fields[p.Key] = "Mixed"
+			if len(p.Types) == 1 {
+				vl.Fields[p.Key] = strings.ToUpper(p.Types[0][:1]) + p.Types[0][1:]
+			}
+		}
+
+		result = append(result, vl)
+	}
+
+	return result
+}
+
+// TaginfoProject is the project information in a taginfo project file.
+// https://wiki.openstreetmap.org/wiki/Taginfo/Projects
+type TaginfoProject struct {
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	ProjectURL   string `json:"project_url"`
+	DocURL       string `json:"doc_url,omitempty"`
+	IconURL      string `json:"icon_url,omitempty"`
+	ContactName  string `json:"contact_name"`
+	ContactEmail string `json:"contact_email"`
+}
+
+// Taginfo is a taginfo project file listing the osm tags used.
+type Taginfo struct {
+	DataFormat  int            `json:"data_format"`
+	DataURL     string         `json:"data_url,omitempty"`
+	DataUpdated string         `json:"data_updated,omitempty"`
+	Project     TaginfoProject `json:"project"`
+	Tags        []*TaginfoTag  `json:"tags"`
+}
+
+// TaginfoTag is a tag, or key if the value is empty, in a taginfo project file.
+type TaginfoTag struct {
+	Key         string   `json:"key"`
+	Value       string   `json:"value,omitempty"`
+	ObjectTypes []string `json:"object_types,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+// Taginfo returns a taginfo project file with the osm tags used by the
+// filters of all the layers. The description of each tag lists the
+// layers and kinds it is mapped to.
+func (cat *Catalog) Taginfo(project TaginfoProject) *Taginfo {
+	type usage struct {
+		tag   *TaginfoTag
+		kinds []string
+	}
+
+	var order [][2]string
+	tags := make(map[[2]string]*usage)
+	for _, l := range cat.Layers {
+		for _, t := range l.Tags {
+			k := [2]string{t.Key, t.Value}
+			u := tags[k]
+			if u == nil {
+				u = &usage{tag: &TaginfoTag{Key: t.Key, Value: t.Value}}
+				tags[k] = u
+				order = append(order, k)
+			}
+
+			for _, ot := range t.ObjectTypes {
+				u.tag.ObjectTypes = appendString(u.tag.ObjectTypes, ot)
+			}
+
+			if len(t.Kinds) == 0 {
+				u.kinds = appendString(u.kinds, l.Name)
+			}
+
+			for _, kind := range t.Kinds {
+				u.kinds = appendString(u.kinds, fmt.Sprintf("%s kind=%s", l.Name, kind))
+			}
+		}
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		if order[i][0] != order[j][0] {
+			return order[i][0] < order[j][0]
+		}
+
+		return order[i][1] < order[j][1]
+	})
+
+	result := &Taginfo{
+		DataFormat: 1,
+		Project:    project,
+		Tags:       make([]*TaginfoTag, 0, len(order)),
+	}
+
+	for _, k := range order {
+		u := tags[k]
+		sort.Strings(u.tag.ObjectTypes)
+		u.tag.Description = "Mapped to " + strings.Join(u.kinds, ", ")
+		result.Tags = append(result.Tags, u.tag)
+	}
+
+	return result
+}
+
+func appendString(list []string, s string) []string {
+	if stringIn(s, list) {
+		return list
+	}
+
+	return append(list, s)
+}
@@ -0,0 +1,119 @@
+package osmzen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigCatalog(t *testing.T) {
+	config, err := Load("config/queries.yaml")
+	if err != nil {
+		t.Fatalf("unable to load layer: %v", err)
+	}
+
+	cat := config.Catalog()
+	if len(cat.Layers) != len(config.All) {
+		t.Fatalf("should have all the layers: %v", len(cat.Layers))
+	}
+
+	cases := []struct {
+		name   string
+		layer  string
+		key    string
+		typ    string
+		value  string
+		source string
+	}{
+		{
+			name:   "kind from filter",
+			layer:  "pois",
+			key:    "kind",
+			typ:    "string",
+			value:  "bicycle_rental",
+			source: "filter",
+		},
+		{
+			name:   "from transform",
+			layer:  "roads",
+			key:    "oneway",
+			typ:    "string",
+			value:  "yes",
+			source: "transform:road_oneway",
+		},
+		{
+			name:   "from post process",
+			layer:  "roads",
+			key:    "sort_rank",
+			typ:    "number",
+			source: "postprocess:csv_match_properties",
+		},
+		{
+			name:   "from processing",
+			layer:  "buildings",
+			key:    "min_zoom",
+			typ:    "number",
+			source: "process",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := cat.Layer(tc.layer).Property(tc.key)
+			if p == nil {
+				t.Fatalf("property not found")
+			}
+
+			if !stringIn(tc.typ, p.Types) {
+				t.Errorf("incorrect types: %v", p.Types)
+			}
+
+			if tc.value != "" && !stringIn(tc.value, p.Values) {
+				t.Errorf("value not found: %v", p.Values)
+			}
+
+			if !stringIn(tc.source, p.Sources) {
+				t.Errorf("source not found: %v", p.Sources)
+			}
+		})
+	}
+
+	t.Run("json schema", func(t *testing.T) {
+		schema := cat.JSONSchema()
+		layers := schema["properties"].(map[string]interface{})
+		props := layers["pois"].(map[string]interface{})["properties"].(map[string]interface{})
+
+		typ := props["type"].(map[string]interface{})
+		if v := typ["enum"].([]string); len(v) != 3 {
+			t.Errorf("incorrect enum: %v", v)
+		}
+	})
+
+	t.Run("vector layers", func(t *testing.T) {
+		vls := cat.VectorLayers()
+		if len(vls) != len(config.All) {
+			t.Fatalf("should have all the layers: %v", len(vls))
+		}
+
+		if v := vls[0].Fields["id"]; v != "Number" {
+			t.Errorf("incorrect field: %v", v)
+		}
+	})
+
+	t.Run("taginfo", func(t *testing.T) {
+		ti := cat.Taginfo(TaginfoProject{Name: "osmzen"})
+
+		found := false
+		for _, tag := range ti.Tags {
+			if tag.Key == "amenity" && tag.Value == "bicycle_rental" {
+				found = true
+				if !strings.HasPrefix(tag.Description, "Mapped to pois kind=bicycle_rental") {
+					t.Errorf("incorrect description: %v", tag.Description)
+				}
+			}
+		}
+
+		if !found {
+			t.Errorf("tag not found")
+		}
+	})
+}
@@ -0,0 +1,72 @@
+// Command osmzen-catalog prints the catalog of the layers, feature
+// properties and kinds created by a config.
+//
+//	osmzen-catalog > catalog.json
+//	osmzen-catalog -format schema > schema.json
+//	osmzen-catalog -format tilejson > vector_layers.json
+//	osmzen-catalog -format taginfo -name "My Map" -url https://example.com > taginfo.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/paulmach/osmzen"
+)
+
+func main() {
+	var (
+		config = flag.String("config", "", "path to a queries.yaml config, uses the default config if empty")
+		format = flag.String("format", "catalog", "output format: catalog, schema, tilejson or taginfo")
+
+		name        = flag.String("name", "osmzen", "taginfo project name")
+		description = flag.String("description", "OpenStreetMap data converted to Tilezen vector tiles.", "taginfo project description")
+		url         = flag.String("url", "", "taginfo project url")
+		contact     = flag.String("contact", "", "taginfo contact name")
+		email       = flag.String("email", "", "taginfo contact email")
+	)
+	flag.Parse()
+
+	c, err := loadConfig(*config)
+	if err != nil {
+		log.Fatalf("unable to load config: %v", err)
+	}
+
+	cat := c.Catalog()
+
+	var result interface{}
+	switch *format {
+	case "catalog":
+		result = cat
+	case "schema":
+		result = cat.JSONSchema()
+	case "tilejson":
+		result = map[string]interface{}{"vector_layers": cat.VectorLayers()}
+	case "taginfo":
+		result = cat.Taginfo(osmzen.TaginfoProject{
+			Name:         *name,
+			Description:  *description,
+			ProjectURL:   *url,
+			ContactName:  *contact,
+			ContactEmail: *email,
+		})
+	default:
+		log.Fatalf("unsupported format: %v", *format)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		log.Fatalf("unable to encode: %v", err)
+	}
+}
+
+func loadConfig(filename string) (*osmzen.Config, error) {
+	if filename == "" {
+		return osmzen.LoadDefaultConfig()
+	}
+
+	return osmzen.Load(filename)
+}
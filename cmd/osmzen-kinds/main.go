@@ -0,0 +1,74 @@
+// Command osmzen-kinds lists the osm tags and geometry types that
+// result in a kind, and kind detail, for a layer.
+//
+//	osmzen-kinds -layer pois -kind bicycle_rental
+//	osmzen-kinds -layer landuse -kind park -json
+//	osmzen-kinds -kind locality -kind-detail city
+//
+// Each line is the layer, the index of the filter in the layer's yaml
+// file and the conditions that must all be true, eg.
+//
+//	pois	210	amenity=bicycle_rental, operator!=*, geometry=Point|MultiPoint|Polygon|MultiPolygon
+//
+// Conditions that depend on more than the tags, like `way_area >= 1000`,
+// are listed as is. If the kind is computed by a function, it can't be
+// resolved and the combination is marked with `computed(kind)`.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/paulmach/osmzen"
+)
+
+func main() {
+	var (
+		config     = flag.String("config", "", "path to a queries.yaml config, uses the default config if empty")
+		layer      = flag.String("layer", "", "layer to search, all layers if empty")
+		kind       = flag.String("kind", "", "kind to search for, required")
+		kindDetail = flag.String("kind-detail", "", "kind detail to search for, any if empty")
+		asJSON     = flag.Bool("json", false, "output the results as json")
+	)
+	flag.Parse()
+
+	if *kind == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c, err := loadConfig(*config)
+	if err != nil {
+		log.Fatalf("unable to load config: %v", err)
+	}
+
+	sources, err := c.KindSources(*layer, *kind, *kindDetail)
+	if err != nil {
+		log.Fatalf("lookup error: %v", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(sources); err != nil {
+			log.Fatalf("unable to encode: %v", err)
+		}
+
+		return
+	}
+
+	for _, s := range sources {
+		fmt.Printf("%s\t%d\t%s\n", s.Layer, s.Filter, s.Combination)
+	}
+}
+
+func loadConfig(filename string) (*osmzen.Config, error) {
+	if filename == "" {
+		return osmzen.LoadDefaultConfig()
+	}
+
+	return osmzen.Load(filename)
+}
@@ -0,0 +1,160 @@
+// Command osmzen-serve serves osmzen vector tiles over http.
+//
+// The data comes from a local index, built from an `.osm.pbf` file on startup
+// or ahead of time, or the live osm api for testing.
+//
+//	osmzen-serve -pbf delaware-latest.osm.pbf -index delaware-index
+//	osmzen-serve -index delaware-index -addr :8080
+//	osmzen-serve -api
+//	osmzen-serve -index delaware-index -overlay my-kinds.yaml
+//
+// Tiles are served at /{z}/{x}/{y}.mvt and /{z}/{x}/{y}.json with a
+// TileJSON document at /tilejson.json.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/osmzen"
+	"github.com/paulmach/osmzen/server"
+	"github.com/paulmach/osmzen/source"
+	"github.com/pkg/errors"
+)
+
+func main() {
+	var (
+		addr      = flag.String("addr", "localhost:8100", "address to listen on")
+		pbf       = flag.String("pbf", "", "build the index from this .osm.pbf file before serving")
+		index     = flag.String("index", "", "directory of the local index")
+		api       = flag.Bool("api", false, "load data from the osm api, for testing only")
+		config    = flag.String("config", "", "path to a queries.yaml config, uses the default config if empty")
+		overlay   = flag.String("overlay", "", "comma separated paths to overlay files applied to the config")
+		minZoom   = flag.Int("min-zoom", int(server.DefaultMinZoom), "min zoom to serve")
+		maxZoom   = flag.Int("max-zoom", int(server.DefaultMaxZoom), "max zoom to serve")
+		cacheSize = flag.Int("cache", server.DefaultCacheSize, "number of tiles to cache in memory, negative to disable")
+		timeout   = flag.Duration("timeout", server.DefaultTimeout, "max time to build a tile")
+		maxAge    = flag.Duration("max-age", 0, "Cache-Control max-age of the tiles")
+		baseURL   = flag.String("url", "", "public base url of the tiles for the TileJSON document")
+	)
+	flag.Parse()
+
+	c, err := loadConfig(*config, *overlay)
+	if err != nil {
+		log.Fatalf("unable to load config: %v", err)
+	}
+
+	var src source.Source
+	switch {
+	case *api:
+		src = source.OSMAPI
+	case *index != "":
+		if *pbf != "" {
+			log.Printf("building index from %s", *pbf)
+			start := time.Now()
+
+			err := source.BuildIndexFromPBF(context.Background(), *pbf, *index)
+			if err != nil {
+				log.Fatalf("unable to build index: %v", err)
+			}
+
+			log.Printf("built index in %v", time.Since(start))
+		}
+
+		idx, err := source.OpenIndex(*index)
+		if err != nil {
+			log.Fatalf("unable to open index: %v", err)
+		}
+		defer idx.Close()
+
+		src = idx
+	default:
+		log.Fatalf("one of -index or -api is required")
+	}
+
+	handler := server.New(c, src, server.Options{
+		MinZoom:   maptile.Zoom(*minZoom),
+		MaxZoom:   maptile.Zoom(*maxZoom),
+		Timeout:   *timeout,
+		CacheSize: *cacheSize,
+		MaxAge:    *maxAge,
+		URL:       *baseURL,
+	})
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      *timeout + 10*time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+	}()
+
+	log.Printf("serving tiles on http://%s", *addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatalf("server: %v", err)
+	}
+
+	<-done
+}
+
+func loadConfig(filename, overlays string) (*osmzen.Config, error) {
+	var (
+		c   *osmzen.Config
+		err error
+	)
+	if filename == "" {
+		c, err = osmzen.LoadDefaultConfig()
+	} else {
+		c, err = osmzen.Load(filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if overlays == "" {
+		return c, nil
+	}
+
+	for _, name := range strings.Split(overlays, ",") {
+		dir, file := filepath.Split(name)
+		if dir == "" {
+			dir = "."
+		}
+
+		o, err := osmzen.LoadOverlay(os.DirFS(dir), file)
+		if err != nil {
+			return nil, errors.WithMessage(err, name)
+		}
+
+		if err := c.ApplyOverlay(o); err != nil {
+			return nil, errors.WithMessage(err, name)
+		}
+	}
+
+	return c, nil
+}
@@ -0,0 +1,475 @@
+package osmzen
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmgeojson"
+)
+
+// element is an osm element to be evaluated by the layers. The filters
+// are evaluated against the osm tags directly and the geometry is only
+// built if needed, usually because the element matched a layer.
+// The rules to decide what elements to include match the osm/osmgeojson
+// package with the IncludeInvalidPolygons option, which is used to build
+// the geometry of the relations.
+type element struct {
+	id    osm.FeatureID
+	tags  osm.Tags
+	gtype string
+
+	node     *osm.Node
+	way      *osm.Way
+	relation *osm.Relation
+	builder  *elementBuilder
+
+	tagMap   map[string]string
+	geometry orb.Geometry
+	built    bool
+}
+
+// FeatureID returns the id of the osm element.
+func (e *element) FeatureID() osm.FeatureID {
+	return e.id
+}
+
+// Tags returns the osm tags of the element.
+func (e *element) Tags() osm.Tags {
+	return e.tags
+}
+
+// TagMap returns the tags of the element as a map. It is created on
+// the first call and shared by the features of all the layers.
+func (e *element) TagMap() map[string]string {
+	if e.tagMap == nil {
+		e.tagMap = e.tags.Map()
+	}
+
+	return e.tagMap
+}
+
+// GeometryType returns the geojson type of the geometry. The type of
+// relations depends on how the members join so it builds the geometry.
+// The empty string is returned if the relation has no valid geometry.
+func (e *element) GeometryType() string {
+	if e.relation != nil {
+		e.Geometry()
+	}
+
+	return e.gtype
+}
+
+// Geometry builds the geometry of the element on the first call.
+func (e *element) Geometry() orb.Geometry {
+	if e.built {
+		return e.geometry
+	}
+	e.built = true
+
+	switch {
+	case e.node != nil:
+		e.geometry = orb.Point{e.node.Lon, e.node.Lat}
+	case e.way != nil:
+		ls := wayToLineString(e.builder.nodes, e.way)
+		if e.gtype == geojson.TypePolygon {
+			p := orb.Polygon{toRing(ls)}
+			reorient(p)
+			e.geometry = p
+		} else {
+			e.geometry = ls
+		}
+	case e.relation != nil:
+		e.geometry = e.builder.relationGeometry(e.relation)
+		if e.geometry != nil {
+			e.gtype = e.geometry.GeoJSONType()
+		}
+	}
+
+	return e.geometry
+}
+
+// buildElements returns the elements to evaluate, in the same order as the
+// osmgeojson package: relations, ways then nodes. Nodes outside the bound
+// are skipped since they can't be in the output. The node and way lookups
+// of the index, built from the data or a superset, are used for the geometry.
+func buildElements(data *osm.OSM, bound orb.Bound, idx *MembershipIndex) []element {
+	b := &elementBuilder{
+		skippable: make(map[osm.WayID]struct{}),
+		nodes:     idx.Nodes,
+		ways:      idx.Ways,
+		padded:    geo.BoundPad(bound, geo.BoundWidth(bound)),
+	}
+
+	elements := make([]element, 0, len(data.Relations)+len(data.Ways)+len(data.Nodes)/4)
+	for _, r := range data.Relations {
+		var (
+			e  element
+			ok bool
+		)
+
+		// NOTE: relation that aren't multipolygons, boundaries or routes are skipped.
+		switch r.Tags.Find("type") {
+		case "route":
+			e, ok = b.route(r)
+		case "multipolygon", "boundary":
+			e, ok = b.polygon(r)
+		}
+
+		if ok {
+			elements = append(elements, e)
+		}
+	}
+
+	for _, w := range data.Ways {
+		if _, skip := b.skippable[w.ID]; skip {
+			continue
+		}
+
+		e, ok := b.way(w)
+		if ok {
+			elements = append(elements, e)
+		}
+	}
+
+	// nodes that are only part of a way's geometry are skipped.
+	// ie. a member of a way, not a member of a relation and
+	// no interesting tags.
+	wayMember := make(map[osm.NodeID]struct{}, len(data.Nodes))
+	for _, w := range data.Ways {
+		for _, wn := range w.Nodes {
+			wayMember[wn.ID] = struct{}{}
+		}
+	}
+
+	relationMember := make(map[osm.NodeID]struct{})
+	for _, r := range data.Relations {
+		for _, m := range r.Members {
+			if m.Type == osm.TypeNode {
+				relationMember[osm.NodeID(m.Ref)] = struct{}{}
+			}
+		}
+	}
+
+	for _, n := range data.Nodes {
+		if _, ok := wayMember[n.ID]; ok {
+			if _, ok := relationMember[n.ID]; !ok && !hasInterestingTags(n.Tags, nil) {
+				continue
+			}
+		}
+
+		// our definition of empty, ill defined
+		if n.Lon == 0 && n.Lat == 0 && n.Version == 0 {
+			continue
+		}
+
+		if !bound.Contains(orb.Point{n.Lon, n.Lat}) {
+			continue
+		}
+
+		elements = append(elements, element{
+			id:    n.FeatureID(),
+			tags:  n.Tags,
+			gtype: geojson.TypePoint,
+			node:  n,
+		})
+	}
+
+	return elements
+}
+
+type elementBuilder struct {
+	skippable map[osm.WayID]struct{}
+	nodes     map[osm.NodeID]*osm.Node
+	ways      map[osm.WayID]*osm.Way
+
+	// the bound padded by its width used to replace the missing
+	// outer rings of multipolygons.
+	padded orb.Bound
+}
+
+func (b *elementBuilder) way(w *osm.Way) (element, bool) {
+	if n, _, _ := b.wayPoints(w); n <= 1 {
+		// one node ways are ignored.
+		return element{}, false
+	}
+
+	gtype := geojson.TypeLineString
+	if w.Polygon() {
+		gtype = geojson.TypePolygon
+	}
+
+	return element{
+		id:      w.FeatureID(),
+		tags:    w.Tags,
+		gtype:   gtype,
+		way:     w,
+		builder: b,
+	}, true
+}
+
+// route marks the member ways to skip and returns the element if the
+// route has any member ways with nodes. The geometry is built later.
+func (b *elementBuilder) route(r *osm.Relation) (element, bool) {
+	found := false
+	for _, m := range r.Members {
+		if m.Type != osm.TypeWay {
+			continue
+		}
+
+		w := b.ways[osm.WayID(m.Ref)]
+		if w == nil {
+			continue
+		}
+
+		if !hasInterestingTags(w.Tags, nil) {
+			b.skippable[w.ID] = struct{}{}
+		}
+
+		if n, _, _ := b.wayPoints(w); n > 0 {
+			found = true
+		}
+	}
+
+	if !found {
+		// route relation is here, but we don't have any of the way members.
+		return element{}, false
+	}
+
+	return element{
+		id:       r.FeatureID(),
+		tags:     r.Tags,
+		relation: r,
+		builder:  b,
+	}, true
+}
+
+// polygon marks the member ways to skip and returns the element if the
+// multipolygon will have a geometry. The geometry is built later. "Old style"
+// multipolygons, with one outer way and uninteresting relation tags, use
+// the id and tags of the outer way.
+func (b *elementBuilder) polygon(r *osm.Relation) (element, bool) {
+	var outerWay *osm.Way
+	outerCount, outers, members := 0, 0, 0
+	for _, m := range r.Members {
+		if !polygonMember(m) {
+			continue
+		}
+
+		if m.Role == "outer" {
+			outerCount++
+		}
+
+		w := b.ways[osm.WayID(m.Ref)]
+		if w == nil {
+			if len(m.Nodes) == 0 {
+				continue
+			}
+
+			w = &osm.Way{ID: osm.WayID(m.Ref), Nodes: m.Nodes}
+		}
+
+		if m.Role == "outer" {
+			if !hasInterestingTags(w.Tags, r.Tags) {
+				b.skippable[w.ID] = struct{}{}
+			}
+		} else {
+			if !hasInterestingTags(w.Tags, nil) {
+				b.skippable[w.ID] = struct{}{}
+			}
+		}
+
+		if n, _, _ := b.wayPoints(w); n == 0 {
+			// we have the way but none the the node members
+			continue
+		}
+
+		members++
+		if m.Role == "outer" {
+			outerWay = w
+			outers++
+		}
+	}
+
+	if members == 0 {
+		return element{}, false
+	}
+
+	e := element{
+		id:       r.FeatureID(),
+		tags:     r.Tags,
+		relation: r,
+		builder:  b,
+	}
+
+	if outers == 1 && outerCount == 1 {
+		n, first, last := b.wayPoints(outerWay)
+		if n < 4 || first != last {
+			// not a valid outer ring
+			return element{}, false
+		}
+
+		// If the relation doesn't have any interesting tags use the way
+		// to define this polygon. ie. use the way's type, id and tags.
+		if !hasInterestingTags(r.Tags, osm.Tags{{Key: "type", Value: "true"}}) {
+			b.skippable[outerWay.ID] = struct{}{}
+
+			e.id = outerWay.FeatureID()
+			e.tags = outerWay.Tags
+		}
+	}
+
+	return e, true
+}
+
+// relationGeometry builds the geometry of the route or multipolygon using
+// the osmgeojson package. Only the relation and copies of its member ways,
+// with the node locations and no tags, are converted so the only feature
+// is the one for the relation.
+func (b *elementBuilder) relationGeometry(r *osm.Relation) orb.Geometry {
+	polygon := r.Tags.Find("type") != "route"
+
+	data := &osm.OSM{Relations: osm.Relations{r}}
+	for _, m := range r.Members {
+		if m.Type != osm.TypeWay || (polygon && !polygonMember(m)) {
+			continue
+		}
+
+		w := b.ways[osm.WayID(m.Ref)]
+		if w == nil {
+			continue
+		}
+
+		nodes := make(osm.WayNodes, 0, len(w.Nodes))
+		for _, wn := range w.Nodes {
+			if wn.Lon == 0 && wn.Lat == 0 {
+				if n := b.nodes[wn.ID]; n != nil {
+					wn.Lon, wn.Lat = n.Lon, n.Lat
+				}
+			}
+			nodes = append(nodes, wn)
+		}
+
+		data.Ways = append(data.Ways, &osm.Way{ID: w.ID, Nodes: nodes})
+	}
+
+	fc, err := osmgeojson.Convert(data,
+		osmgeojson.IncludeInvalidPolygons(true),
+		osmgeojson.NoID(true),
+		osmgeojson.NoMeta(true),
+		osmgeojson.NoRelationMembership(true),
+	)
+	if err != nil || len(fc.Features) == 0 {
+		return nil
+	}
+
+	// The osmgeojson.IncludeInvalidPolygons option will allow us to get
+	// polygons with open outer rings or even completely missing outer rings
+	// if just the inners intersect the bounds. The missing outer rings need to be
+	// replaced with the bound. Open outer rings will "cropped and wrapped" towards
+	// the end of the whole process.
+	switch g := fc.Features[0].Geometry.(type) {
+	case orb.MultiPolygon:
+		for _, p := range g {
+			if len(p) > 0 && p[0] == nil {
+				p[0] = b.padded.ToRing()
+			}
+		}
+	case orb.Polygon:
+		if len(g) > 0 && g[0] == nil {
+			g[0] = b.padded.ToRing()
+		}
+	}
+
+	return fc.Features[0].Geometry
+}
+
+// wayPoints returns the number of way nodes with a location,
+// and the first and last location.
+func (b *elementBuilder) wayPoints(w *osm.Way) (int, orb.Point, orb.Point) {
+	var first, last orb.Point
+
+	count := 0
+	for _, wn := range w.Nodes {
+		var p orb.Point
+		if wn.Lon != 0 || wn.Lat != 0 {
+			p = orb.Point{wn.Lon, wn.Lat}
+		} else if n := b.nodes[wn.ID]; n != nil {
+			p = orb.Point{n.Lon, n.Lat}
+		} else {
+			continue
+		}
+
+		if count == 0 {
+			first = p
+		}
+		last = p
+		count++
+	}
+
+	return count, first, last
+}
+
+func polygonMember(m osm.Member) bool {
+	return m.Type == osm.TypeWay && (m.Role == "inner" || m.Role == "outer")
+}
+
+// wayToLineString builds the line string from the way nodes, using the
+// node locations on the way if present. Missing nodes are skipped.
+func wayToLineString(nodes map[osm.NodeID]*osm.Node, w *osm.Way) orb.LineString {
+	ls := make(orb.LineString, 0, len(w.Nodes))
+	for _, wn := range w.Nodes {
+		if wn.Lon != 0 || wn.Lat != 0 {
+			ls = append(ls, orb.Point{wn.Lon, wn.Lat})
+		} else if n := nodes[wn.ID]; n != nil {
+			ls = append(ls, orb.Point{n.Lon, n.Lat})
+		}
+	}
+
+	return ls
+}
+
+// hasInterestingTags returns true if any of the tags are interesting and
+// not in the ignored tags. A value of "true" ignores all the values of the key.
+func hasInterestingTags(tags osm.Tags, ignore osm.Tags) bool {
+	for _, tag := range tags {
+		if osm.UninterestingTags[tag.Key] {
+			continue
+		}
+
+		if ignore == nil {
+			return true
+		}
+
+		if v := ignore.Find(tag.Key); v != "true" && v != tag.Value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func toRing(ls orb.LineString) orb.Ring {
+	if len(ls) < 2 {
+		return orb.Ring(ls)
+	}
+
+	// duplicate last point
+	if ls[0] != ls[len(ls)-1] {
+		return orb.Ring(append(ls, ls[0]))
+	}
+
+	return orb.Ring(ls)
+}
+
+func reorient(p orb.Polygon) {
+	if p[0].Orientation() != orb.CCW {
+		p[0].Reverse()
+	}
+
+	for i := 1; i < len(p); i++ {
+		if p[i].Orientation() != orb.CW {
+			p[i].Reverse()
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package osmzen
+
+import (
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmgeojson"
+)
+
+func TestBuildElements(t *testing.T) {
+	tile := maptile.New(17896, 24450, 16)
+	data := loadFile(t, tile)
+
+	fc, err := osmgeojson.Convert(data,
+		osmgeojson.IncludeInvalidPolygons(true),
+		osmgeojson.NoID(true),
+		osmgeojson.NoMeta(true),
+		osmgeojson.NoRelationMembership(true),
+	)
+	if err != nil {
+		t.Fatalf("convert error: %v", err)
+	}
+
+	// points outside the bound are skipped when building elements.
+	features := fc.Features[:0]
+	for _, f := range fc.Features {
+		if p, ok := f.Geometry.(orb.Point); ok && !tile.Bound().Contains(p) {
+			continue
+		}
+		features = append(features, f)
+	}
+
+	elements := buildElements(data, tile.Bound(), NewMembershipIndex(data))
+	if len(elements) != len(features) {
+		t.Fatalf("incorrect number of elements: %d != %d", len(elements), len(features))
+	}
+
+	for i, f := range features {
+		e := &elements[i]
+
+		id, _ := osm.Type(f.Properties.MustString("type")).FeatureID(int64(f.Properties.MustInt("id")))
+		if e.FeatureID() != id {
+			t.Fatalf("incorrect id: %v != %v", e.FeatureID(), id)
+		}
+
+		if e.GeometryType() != f.Geometry.GeoJSONType() {
+			t.Errorf("%v: incorrect geometry type: %v != %v", id, e.GeometryType(), f.Geometry.GeoJSONType())
+		}
+
+		// relations with missing outer rings are replaced with the bound.
+		if id.Type() == osm.TypeRelation {
+			continue
+		}
+
+		if !orb.Equal(e.Geometry(), f.Geometry) {
+			t.Errorf("%v: geometry not equal", id)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -9,9 +10,7 @@ import (
 	"strings"
 
 	"github.com/paulmach/osmzen"
-
-	"github.com/paulmach/osm"
-	"github.com/paulmach/osm/osmapi"
+	"github.com/paulmach/osmzen/source"
 
 	"github.com/paulmach/orb/geo"
 	"github.com/paulmach/orb/maptile"
@@ -21,6 +20,21 @@ import (
 const Port = "8100"
 
 func main() {
+	index := flag.String("index", "", "directory of a local index built with source.BuildIndexFromPBF, uses the osm api if empty")
+	flag.Parse()
+
+	// where to get the osm data
+	var src source.Source = source.OSMAPI
+	if *index != "" {
+		idx, err := source.OpenIndex(*index)
+		if err != nil {
+			panic(err)
+		}
+		defer idx.Close()
+
+		src = idx
+	}
+
 	// load and initialize the mapzen context using the default config files
 	config, err := osmzen.LoadDefaultConfig()
 	if err != nil {
@@ -41,10 +55,9 @@ func main() {
 	// handler to serve the tiles
 	http.HandleFunc("/tiles/", func(w http.ResponseWriter, r *http.Request) {
 		tile := parsePath(r.URL.Path) // find tile bounds for request
-		bound, _ := osm.NewBoundsFromTile(tile)
 
 		// get the osm data for that bound
-		data, err := osmapi.Map(r.Context(), bound)
+		data, err := src.Bound(r.Context(), tile.Bound())
 		if err != nil {
 			if err := r.Context().Err(); err != nil {
 				// what if not "context canceled"?
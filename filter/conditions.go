@@ -232,13 +232,13 @@ type osmTagsCond struct {
 }
 
 func (oc *osmTagsCond) Eval(ctx *Context) bool {
-	tags := ctx.Tags
+	tags, useTags := ctx.Tags, ctx.useTags
 
 	// Use the osm tags from now on
-	ctx.Tags = ctx.OSMTags
+	ctx.Tags, ctx.useTags = ctx.OSMTags, false
 
 	val := oc.Condition.Eval(ctx)
-	ctx.Tags = tags
+	ctx.Tags, ctx.useTags = tags, useTags
 
 	return val
 }
@@ -257,7 +257,7 @@ func compileOSMTagsCond(cond interface{}) (Condition, error) {
 type geometryTypesCondSingle string
 
 func (gtc geometryTypesCondSingle) Eval(ctx *Context) bool {
-	return string(gtc) == ctx.Geometry.GeoJSONType()
+	return string(gtc) == ctx.GeometryType()
 }
 
 type geometryTypesCond struct {
@@ -265,7 +265,7 @@ type geometryTypesCond struct {
 }
 
 func (gtc *geometryTypesCond) Eval(ctx *Context) bool {
-	val := ctx.Geometry.GeoJSONType()
+	val := ctx.GeometryType()
 	for _, t := range gtc.Types {
 		if t == val {
 			return true
@@ -469,7 +469,7 @@ type stringCond struct {
 }
 
 func (sc *stringCond) Eval(ctx *Context) bool {
-	return ctx.Tags[sc.Key] == sc.Val
+	return ctx.Tag(sc.Key) == sc.Val
 }
 
 ///////////////////////////////////////
@@ -482,7 +482,7 @@ type stringInCond struct {
 }
 
 func (sc *stringInCond) Eval(ctx *Context) bool {
-	val := ctx.Tags[sc.Key]
+	val := ctx.Tag(sc.Key)
 	for _, l := range sc.List {
 		if val == l {
 			return true
@@ -515,6 +515,6 @@ type boolCond struct {
 }
 
 func (bc *boolCond) Eval(ctx *Context) bool {
-	_, ok := ctx.Tags[bc.Key]
+	_, ok := ctx.LookupTag(bc.Key)
 	return ok == bc.Val
 }
@@ -17,13 +17,24 @@ type Context struct {
 	Verbose bool
 
 	FeatureID osm.FeatureID
-	Geometry  orb.Geometry
+
+	// Geometry is the geometry of the feature. When evaluating an Element
+	// it is nil until LoadGeometry is called, use GeometryType
+	// and LoadGeometry instead of accessing it directly.
+	Geometry orb.Geometry
+	element  Element
 
 	// To compute ways and/or relations if needed
 	OSM *osm.OSM
 
+	// Tags are the tags of the feature. When evaluating an Element they
+	// are nil and the osm tags of the element are used directly, use Tag
+	// and LookupTag instead of accessing them directly.
 	Tags map[string]string
 
+	tags    osm.Tags
+	useTags bool
+
 	// OSMTags are used during post processing we need access
 	// the original osm tags as well as the new filter outputs.
 	OSMTags map[string]string
@@ -36,22 +47,47 @@ type Context struct {
 	ways      osm.Ways
 	relations osm.Relations
 
+	// reused by Index.Match to save the allocs.
+	candidates []uint64
+
 	WayMembership      map[osm.NodeID]osm.Ways
 	RelationMembership map[osm.FeatureID]osm.Relations
 }
 
-// NewContext creates a new filter.Context from an osmgeojson feature.
-func NewContext(ctx *Context, feature *geojson.Feature) *Context {
-	if ctx == nil {
-		ctx = &Context{}
-	}
+// Element is an osm element that can be evaluated without building
+// its geometry or a map of its tags. The geometry is only needed by some
+// conditions and outputs, for example `way_area`, and for the matched features.
+type Element interface {
+	FeatureID() osm.FeatureID
+	Tags() osm.Tags
+
+	// GeometryType returns the geojson type of the geometry
+	// without building it.
+	GeometryType() string
+	Geometry() orb.Geometry
+}
 
-	ctx.length = -1
-	ctx.area = -1
-	ctx.minZoom = -1
+// NewContextFromElement creates a new filter.Context from an element.
+// The geometry is built on first use and cached on the context.
+func NewContextFromElement(ctx *Context, e Element) *Context {
+	ctx = resetContext(ctx)
 
-	ctx.ways = nil
-	ctx.relations = nil
+	ctx.FeatureID = e.FeatureID()
+	ctx.Tags = nil
+	ctx.tags = e.Tags()
+	ctx.useTags = true
+	ctx.Geometry = nil
+	ctx.element = e
+
+	return ctx
+}
+
+// NewContext creates a new filter.Context from an osmgeojson feature.
+func NewContext(ctx *Context, feature *geojson.Feature) *Context {
+	ctx = resetContext(ctx)
+	ctx.element = nil
+	ctx.tags = nil
+	ctx.useTags = false
 
 	if feature == nil {
 		return ctx
@@ -70,6 +106,81 @@ func NewContext(ctx *Context, feature *geojson.Feature) *Context {
 	return ctx
 }
 
+func resetContext(ctx *Context) *Context {
+	if ctx == nil {
+		ctx = &Context{}
+	}
+
+	ctx.length = -1
+	ctx.area = -1
+	ctx.minZoom = -1
+
+	ctx.ways = nil
+	ctx.relations = nil
+
+	return ctx
+}
+
+// Tag returns the value of the tag, or the empty string if not set.
+func (ctx *Context) Tag(key string) string {
+	v, _ := ctx.LookupTag(key)
+	return v
+}
+
+// LookupTag returns the value of the tag and whether it is set.
+func (ctx *Context) LookupTag(key string) (string, bool) {
+	if !ctx.useTags {
+		v, ok := ctx.Tags[key]
+		return v, ok
+	}
+
+	for _, t := range ctx.tags {
+		if t.Key == key {
+			return t.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// EachTag calls the function with every tag of the feature.
+func (ctx *Context) EachTag(fn func(key, value string)) {
+	if !ctx.useTags {
+		for k, v := range ctx.Tags {
+			fn(k, v)
+		}
+		return
+	}
+
+	for _, t := range ctx.tags {
+		fn(t.Key, t.Value)
+	}
+}
+
+// GeometryType returns the geojson type of the feature geometry,
+// without building it if evaluating an element.
+func (ctx *Context) GeometryType() string {
+	if ctx.Geometry != nil {
+		return ctx.Geometry.GeoJSONType()
+	}
+
+	if ctx.element != nil {
+		return ctx.element.GeometryType()
+	}
+
+	return ""
+}
+
+// LoadGeometry returns the geometry of the feature. If evaluating an
+// element the geometry is built on the first call.
+func (ctx *Context) LoadGeometry() orb.Geometry {
+	if ctx.Geometry == nil && ctx.element != nil {
+		ctx.Geometry = ctx.element.Geometry()
+	}
+
+	return ctx.Geometry
+}
+
 // NewContextFromProperties will create a context using a set of properties.
 // This limits the queries one can do since not all the geometry is present.
 func NewContextFromProperties(ctx *Context, props geojson.Properties) *Context {
@@ -95,6 +206,9 @@ func NewContextFromProperties(ctx *Context, props geojson.Properties) *Context {
 	ctx.OSMTags = osmTags
 
 	ctx.Geometry = nil
+	ctx.element = nil
+	ctx.tags = nil
+	ctx.useTags = false
 	ctx.length = -1
 	ctx.area = -1
 	ctx.minZoom = -1
@@ -127,10 +241,9 @@ func (ctx *Context) Area() float64 {
 }
 
 func (ctx *Context) computeLengthArea() {
-	projected := project.Geometry(orb.Clone(ctx.Geometry), project.WGS84.ToMercator)
+	projected := project.Geometry(orb.Clone(ctx.LoadGeometry()), project.WGS84.ToMercator)
 
-	ctx.area = planar.Area(projected)
-	ctx.area = math.Floor(ctx.area + 0.5)
+	ctx.area = mercatorArea(projected)
 
 	switch g := projected.(type) {
 	case orb.LineString:
@@ -142,6 +255,18 @@ func (ctx *Context) computeLengthArea() {
 	}
 }
 
+// MercatorArea returns the area of the WGS84 geometry in square mercator
+// meters. This is the same value used by the `way_area` condition and
+// the `area` output. Rings are treated as polygons, the winding order
+// does not matter.
+func MercatorArea(g orb.Geometry) float64 {
+	return mercatorArea(project.Geometry(orb.Clone(g), project.WGS84.ToMercator))
+}
+
+func mercatorArea(projected orb.Geometry) float64 {
+	return math.Floor(math.Abs(planar.Area(projected)) + 0.5)
+}
+
 // Height returns the height of the thing, usually a building.
 func (ctx *Context) Height() float64 {
 	return math.Floor(buildingHeight(ctx) + 0.5)
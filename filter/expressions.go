@@ -136,7 +136,7 @@ type colExpr struct {
 }
 
 func (ce *colExpr) Eval(ctx *Context) interface{} {
-	if val := ctx.Tags[ce.Key]; val != "" {
+	if val := ctx.Tag(ce.Key); val != "" {
 		return val
 	}
 
@@ -150,6 +150,7 @@ var colExpressions = map[string]Expression{
 	"way_area":           &areaExpr{},
 	"is_bus_route":       &calculateIsBusRoute{},
 	"mz_cycling_network": &cyclingNetwork{},
+	"mz_hiking_network":  &hikingNetwork{},
 	"mz_networks":        &getRelNetworks{},
 	"mz_is_building":     &calculateIsBuildingOrPart{},
 
@@ -12,6 +12,9 @@ import (
 type Filter struct {
 	Skip bool
 
+	// ID optionally identifies the filter so overlays can replace or remove it.
+	ID string `yaml:"id"`
+
 	RawFilter  interface{}            `yaml:"filter"`
 	RawOutput  map[string]interface{} `yaml:"output"`
 	RawMinZoom interface{}            `yaml:"min_zoom"`
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osm"
 	"github.com/paulmach/osmzen/util"
 	"github.com/pkg/errors"
 )
@@ -16,14 +18,14 @@ var functions map[string]func([]Expression) (Expression, error)
 
 func init() {
 	functions = map[string]func([]Expression) (Expression, error){
-		"mz_building_kind_detail":       compileBuildingKindDetail,
-		"mz_building_part_kind_detail":  compileBuildingPartKindDetail,
-		"mz_calculate_path_major_route": compileCalculatePathMajorRoute,
-		"mz_calculate_ferry_level":      compileCalculateFerryLevel,
-		"mz_calculate_is_bus_route":     compileCalculateIsBusRoute, // *** needs a look
-		"mz_cycling_network":            compileCyclingNetwork,      // *** now a column
-		// "mz_hiking_network":                  compileHikingNetwork,
-		// "mz_get_rel_networks":                compileGetRelNetworks,
+		"mz_building_kind_detail":            compileBuildingKindDetail,
+		"mz_building_part_kind_detail":       compileBuildingPartKindDetail,
+		"mz_calculate_path_major_route":      compileCalculatePathMajorRoute,
+		"mz_calculate_ferry_level":           compileCalculateFerryLevel,
+		"mz_calculate_is_bus_route":          compileCalculateIsBusRoute,
+		"mz_cycling_network":                 compileCyclingNetwork, // *** now a column
+		"mz_hiking_network":                  compileHikingNetwork,
+		"mz_get_rel_networks":                compileGetRelNetworks,
 		"mz_to_float_meters":                 compileToFloatMeters,
 		"mz_get_min_zoom_highway_level_gate": compileGetMinZoomHighwayLevelGate,
 		"tz_estimate_parking_capacity":       compileEstimateParkingCapacity,
@@ -87,7 +89,7 @@ func (f calculateFerryLevel) Eval(ctx *Context) interface{} {
 // mz_calculate_ferry_level
 // https://github.com/tilezen/vector-datasource/blob/617f2011d262b6f2171e988fd60931890663cf7a/data/functions.sql#L1-L17
 func (f calculateFerryLevel) EvalNum(ctx *Context) float64 {
-	if t := ctx.Geometry.GeoJSONType(); t != geojson.TypeLineString && t != geojson.TypeMultiLineString {
+	if t := ctx.GeometryType(); t != geojson.TypeLineString && t != geojson.TypeMultiLineString {
 		if ctx.Verbose {
 			log.Printf("failed to calculate ferry level: %v is non-line", ctx.FeatureID)
 		}
@@ -162,6 +164,9 @@ type calculateIsBusRoute struct{}
 
 // mz_calculate_is_bus_route
 // https://github.com/tilezen/vector-datasource/blob/d28bc2801e808e02b48023e165c8664ebe4c0486/data/functions.sql#L547-L563
+// The original only considers way members of the relation. The membership
+// is keyed by feature id, which includes the type, so bus stop nodes with
+// the same id as the way will not match.
 func (f calculateIsBusRoute) Eval(ctx *Context) interface{} {
 	for _, r := range ctx.relationMembership() {
 		if r.Tags.Find("type") == "route" {
@@ -256,7 +261,7 @@ func cyclingNetworkHelper(ctx *Context) interface{} {
 		return "ncn"
 	}
 
-	if ctx.Tags["ncn"] == "yes" || ctx.Tags["ncn_ref"] != "" {
+	if ctx.Tag("ncn") == "yes" || ctx.Tag("ncn_ref") != "" {
 		return "ncn"
 	}
 
@@ -264,7 +269,7 @@ func cyclingNetworkHelper(ctx *Context) interface{} {
 		return "rcn"
 	}
 
-	if ctx.Tags["rcn"] == "yes" || ctx.Tags["rcn_ref"] != "" {
+	if ctx.Tag("rcn") == "yes" || ctx.Tag("rcn_ref") != "" {
 		return "rcn"
 	}
 
@@ -272,7 +277,7 @@ func cyclingNetworkHelper(ctx *Context) interface{} {
 		return "lcn"
 	}
 
-	if ctx.Tags["lcn"] == "yes" || ctx.Tags["lcn_ref"] != "" {
+	if ctx.Tag("lcn") == "yes" || ctx.Tag("lcn_ref") != "" {
 		return "lcn"
 	}
 
@@ -284,7 +289,7 @@ type cyclingNetwork struct{}
 // mz_cycling_network
 // https://github.com/tilezen/vector-datasource/blob/617f2011d262b6f2171e988fd60931890663cf7a/data/functions.sql#L621-L629
 func (f cyclingNetwork) Eval(ctx *Context) interface{} {
-	if ctx.Tags["icn"] == "yes" || ctx.Tags["icn_ref"] != "" {
+	if ctx.Tag("icn") == "yes" || ctx.Tag("icn_ref") != "" {
 		return "icn"
 	}
 
@@ -310,20 +315,73 @@ func (f getRelNetworks) Eval(ctx *Context) interface{} {
 		return nil
 	}
 
-	result := make([]string, 0, len(relations))
+	triples := make([]relNetwork, 0, len(relations))
 	for _, r := range relations {
 		route := r.Tags.Find("route")
 		network := r.Tags.Find("network")
 		ref := r.Tags.Find("ref")
 
 		if route != "" && (network != "" || ref != "") {
-			result = append(result, route, network, ref)
+			triples = append(triples, relNetwork{
+				route:   route,
+				network: network,
+				ref:     ref,
+				id:      r.ID,
+			})
 		}
 	}
 
+	// The order of relation membership depends on the input data.
+	// Sort so the most important networks are first, the road_networks
+	// post processor does a more complete job for roads.
+	sort.SliceStable(triples, func(i, j int) bool {
+		ii := triples[i].importance()
+		ji := triples[j].importance()
+		if ii != ji {
+			return ii < ji
+		}
+
+		return triples[i].id < triples[j].id
+	})
+
+	result := make([]string, 0, 3*len(triples))
+	for _, t := range triples {
+		result = append(result, t.route, t.network, t.ref)
+	}
+
 	return result
 }
 
+type relNetwork struct {
+	route   string
+	network string
+	ref     string
+	id      osm.RelationID
+}
+
+var relNetworkCodes = map[string]int{
+	"iwn": 1, "icn": 1,
+	"nwn": 2, "ncn": 2,
+	"rwn": 3, "rcn": 3,
+	"lwn": 4, "lcn": 4,
+}
+
+// importance returns a number representing the importance of the network
+// where lower numbers are more important. Walking and cycling networks
+// use the iwn, nwn, rwn, lwn hierarchy. Other networks, like roads and bus
+// routes, use the same heuristic as the road network post processing.
+func (rn relNetwork) importance() int {
+	if rn.network == "" {
+		return 100
+	}
+
+	if c, ok := relNetworkCodes[rn.network]; ok {
+		return c
+	}
+
+	return util.NetworkImportance(rn.network)
+}
+
 func compileGetRelNetworks(args []Expression) (Expression, error) {
 	return getRelNetworks{}, nil
 }
@@ -389,7 +447,7 @@ func (f estimateParkingCapacity) Eval(ctx *Context) interface{} {
 }
 
 func (f estimateParkingCapacity) EvalNum(ctx *Context) float64 {
-	capacity, ok := util.ToFloat64(ctx.Tags["capacity"])
+	capacity, ok := util.ToFloat64(ctx.Tag("capacity"))
 	if ok {
 		return capacity
 	}
@@ -401,9 +459,9 @@ func (f estimateParkingCapacity) EvalNum(ctx *Context) float64 {
 	// mercator meters per space?
 	spacesPerLevel := ctx.Area() / 46.0
 
-	levels, ok := util.ToFloat64(ctx.Tags["levels"])
+	levels, ok := util.ToFloat64(ctx.Tag("levels"))
 	if !ok {
-		if ctx.Tags["parking"] == "multi-storey" {
+		if ctx.Tag("parking") == "multi-storey" {
 			// at least 2, but let's be conservative.
 			levels = 2.0
 		} else {
@@ -433,7 +491,7 @@ func (f looksLikeServiceArea) Eval(ctx *Context) interface{} {
 func (f looksLikeServiceArea) EvalNum(ctx *Context) float64 {
 	minZoom := 17.0
 
-	name, ok := ctx.Tags["name"]
+	name, ok := ctx.LookupTag("name")
 	if !ok {
 		return minZoom
 	}
@@ -461,7 +519,7 @@ func (f looksLikeRestArea) Eval(ctx *Context) interface{} {
 func (f looksLikeRestArea) EvalNum(ctx *Context) float64 {
 	minZoom := 17.0
 
-	name, ok := ctx.Tags["name"]
+	name, ok := ctx.LookupTag("name")
 	if !ok {
 		return minZoom
 	}
@@ -582,12 +640,12 @@ func (f calculateIsBuildingOrPart) Eval(ctx *Context) interface{} {
 	// there are 12,000 uses of building=no, so we ought to take that into
 	// account when figuring out if something is a building or not. also,
 	// returning "kind=no" is a bit weird.
-	building := ctx.Tags["building"]
+	building := ctx.Tag("building")
 	if building != "" && building != "no" {
 		return true
 	}
 
-	part := ctx.Tags["building:part"]
+	part := ctx.Tag("building:part")
 	if part != "" && part != "no" {
 		return true
 	}
@@ -604,7 +662,7 @@ func compileCalculateIsBuildingOrPart(args []Expression) (Expression, error) {
 // approximate height from the number of levels, if that is set.
 // https://github.com/tilezen/vector-datasource/blob/617f2011d262b6f2171e988fd60931890663cf7a/data/functions.sql#L504-L526
 func buildingHeight(ctx *Context) float64 {
-	height := ctx.Tags["height"]
+	height := ctx.Tag("height")
 
 	// if height is present, and can be parsed as a
 	// float, then we can filter right here.
@@ -618,7 +676,7 @@ func buildingHeight(ctx *Context) float64 {
 		return 1.0e10
 	}
 
-	levels := ctx.Tags["building:levels"]
+	levels := ctx.Tag("building:levels")
 
 	// looks like we assume each level is 3m, plus 2 overall.
 	if levels != "" {
@@ -690,7 +748,7 @@ var buildingKindDetailMap = buildKindMap(
 type buildingKindDetail struct{}
 
 func (f buildingKindDetail) Eval(ctx *Context) interface{} {
-	key := ctx.Tags["building"]
+	key := ctx.Tag("building")
 	if val := buildingKindDetailMap[key]; val != "" {
 		return val
 	}
@@ -723,7 +781,7 @@ var buildingPartKindDetailMap = buildKindMap(
 type buildingPartKindDetail struct{}
 
 func (f buildingPartKindDetail) Eval(ctx *Context) interface{} {
-	key := ctx.Tags["building:part"]
+	key := ctx.Tag("building:part")
 	if val := buildingPartKindDetailMap[key]; val != "" {
 		return val
 	}
@@ -1,9 +1,11 @@
 package filter
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osm"
 )
 
 func TestBuildingHeight(t *testing.T) {
@@ -228,3 +230,48 @@ func TestLooksLikeRestArea(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRelNetworks(t *testing.T) {
+	route := func(id osm.RelationID, route, network, ref string) *osm.Relation {
+		return &osm.Relation{ID: id, Tags: osm.Tags{
+			{Key: "type", Value: "route"},
+			{Key: "route", Value: route},
+			{Key: "network", Value: network},
+			{Key: "ref", Value: ref},
+		}}
+	}
+
+	f := geojson.NewFeature(nil)
+	f.Properties["type"] = "way"
+	f.Properties["id"] = 1
+	f.Properties["tags"] = map[string]string{}
+
+	ctx := NewContext(nil, f)
+	ctx.RelationMembership = map[osm.FeatureID]osm.Relations{
+		osm.WayID(1).FeatureID(): {
+			route(1, "hiking", "lwn", "L1"),
+			route(2, "road", "US:CA", "82"),
+			route(3, "hiking", "iwn", "E1"),
+			route(4, "road", "US:I", "280"),
+			{ID: 5, Tags: osm.Tags{{Key: "type", Value: "route"}, {Key: "route", Value: "bus"}}},
+		},
+	}
+
+	result := getRelNetworks{}.Eval(ctx).([]string)
+	expected := []string{
+		"hiking", "iwn", "E1",
+		"road", "US:I", "280",
+		"hiking", "lwn", "L1",
+		"road", "US:CA", "82",
+	}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("incorrect networks")
+		t.Logf("%v", result)
+		t.Logf("%v", expected)
+	}
+
+	if v := (hikingNetwork{}).Eval(ctx); v != "iwn" {
+		t.Errorf("incorrect hiking network: %v", v)
+	}
+}
@@ -0,0 +1,211 @@
+package filter
+
+import "math/bits"
+
+// An Index finds the first matching filter from a list of filters without
+// evaluating all of them. Each filter is indexed by the tags it requires,
+// eg. `amenity: cafe` or `building: true`, and only the filters with a
+// required tag present on the element, or without any required tags,
+// are evaluated in the original order.
+type Index struct {
+	filters []*Filter
+
+	// bitsets of the filter indexes to evaluate.
+	always  []uint64
+	byKey   map[string][]uint64
+	byValue map[string]map[string][]uint64
+}
+
+// NewIndex creates an index for the filters. The filters must
+// be compiled first.
+func NewIndex(filters []*Filter) *Index {
+	idx := &Index{
+		filters: filters,
+		always:  make([]uint64, (len(filters)+63)/64),
+		byKey:   make(map[string][]uint64),
+		byValue: make(map[string]map[string][]uint64),
+	}
+
+	for i, f := range filters {
+		if f.Skip {
+			continue
+		}
+
+		var req requirement
+		if f.Filter != nil {
+			req = requiredTags(f.Filter)
+		}
+
+		if req == nil {
+			idx.always[i/64] |= 1 << uint(i%64)
+			continue
+		}
+
+		for _, kv := range req {
+			if kv.Value == "" {
+				idx.byKey[kv.Key] = idx.set(idx.byKey[kv.Key], i)
+				continue
+			}
+
+			values := idx.byValue[kv.Key]
+			if values == nil {
+				values = make(map[string][]uint64)
+				idx.byValue[kv.Key] = values
+			}
+			values[kv.Value] = idx.set(values[kv.Value], i)
+		}
+	}
+
+	return idx
+}
+
+func (idx *Index) set(b []uint64, i int) []uint64 {
+	if b == nil {
+		b = make([]uint64, len(idx.always))
+	}
+
+	b[i/64] |= 1 << uint(i%64)
+	return b
+}
+
+// Match returns the first filter that matches the element, or nil if none match.
+// It returns the same filter as calling Match on each filter in order.
+func (idx *Index) Match(ctx *Context) *Filter {
+	candidates := append(ctx.candidates[:0], idx.always...)
+	ctx.candidates = candidates
+
+	if ctx.useTags {
+		for _, t := range ctx.tags {
+			idx.addCandidates(candidates, t.Key, t.Value)
+		}
+	} else {
+		for k, v := range ctx.Tags {
+			idx.addCandidates(candidates, k, v)
+		}
+	}
+
+	for i, word := range candidates {
+		for word != 0 {
+			j := bits.TrailingZeros64(word)
+			word &^= 1 << uint(j)
+
+			if f := idx.filters[i*64+j]; f.Match(ctx) {
+				return f
+			}
+		}
+	}
+
+	return nil
+}
+
+func (idx *Index) addCandidates(candidates []uint64, key, value string) {
+	if b := idx.byKey[key]; b != nil {
+		or(candidates, b)
+	}
+
+	if values := idx.byValue[key]; values != nil {
+		if b := values[value]; b != nil {
+			or(candidates, b)
+		}
+	}
+}
+
+func or(a, b []uint64) {
+	for i := range a {
+		a[i] |= b[i]
+	}
+}
+
+// tag is a key and value, an empty value matches any value of the key.
+type tag struct {
+	Key   string
+	Value string
+}
+
+// requirement is a set of tags, at least one of which must be present
+// on the element for a condition to match. A nil requirement means the
+// condition can match without any of the tags.
+type requirement []tag
+
+// requiredTags returns the tags required for the condition to match.
+// This is conservative, if it's unclear what tags are needed
+// nil is returned and the filter will always be evaluated.
+func requiredTags(c Condition) requirement {
+	switch c := c.(type) {
+	case *stringCond:
+		if c.Val == "" {
+			return nil
+		}
+
+		return requirement{{Key: c.Key, Value: c.Val}}
+	case *stringInCond:
+		req := make(requirement, 0, len(c.List))
+		for _, v := range c.List {
+			if v == "" {
+				return nil
+			}
+
+			req = append(req, tag{Key: c.Key, Value: v})
+		}
+
+		return req
+	case *boolCond:
+		if !c.Val {
+			return nil
+		}
+
+		return requirement{{Key: c.Key}}
+	case *allCond:
+		// all the conditions must match so use the most specific requirement.
+		var best requirement
+		for _, cc := range *c {
+			if req := requiredTags(cc); req != nil && req.betterThan(best) {
+				best = req
+			}
+		}
+
+		return best
+	case *anyCond:
+		// one of the conditions must match so all of them need a requirement.
+		var result requirement
+		for _, cc := range *c {
+			req := requiredTags(cc)
+			if req == nil {
+				return nil
+			}
+
+			result = append(result, req...)
+		}
+
+		return result
+	}
+
+	// not, osm_tags, geometry types, way_area etc. can match without any
+	// specific tag. osm_tags conditions are evaluated against different tags.
+	return nil
+}
+
+// betterThan returns true if the requirement should be used instead of
+// the other. Requirements on the tag value are better than on just the key
+// since there are fewer elements with the specific value.
+func (r requirement) betterThan(other requirement) bool {
+	if other == nil {
+		return true
+	}
+
+	if r.anyValue() != other.anyValue() {
+		return other.anyValue()
+	}
+
+	return len(r) < len(other)
+}
+
+func (r requirement) anyValue() bool {
+	for _, t := range r {
+		if t.Value == "" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,156 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+func TestRequiredTags(t *testing.T) {
+	cases := []struct {
+		name     string
+		filter   string
+		expected requirement
+	}{
+		{
+			name:     "string",
+			filter:   `filter: {amenity: cafe}`,
+			expected: requirement{{Key: "amenity", Value: "cafe"}},
+		},
+		{
+			name:   "string in",
+			filter: `filter: {amenity: [cafe, bar]}`,
+			expected: requirement{
+				{Key: "amenity", Value: "cafe"},
+				{Key: "amenity", Value: "bar"},
+			},
+		},
+		{
+			name:     "bool",
+			filter:   `filter: {building: true}`,
+			expected: requirement{{Key: "building"}},
+		},
+		{
+			name:     "bool false",
+			filter:   `filter: {building: false}`,
+			expected: nil,
+		},
+		{
+			name:     "all uses value over key",
+			filter:   `filter: {all: [{name: true}, {shop: [bakery, deli]}, geom_type: point]}`,
+			expected: requirement{{Key: "shop", Value: "bakery"}, {Key: "shop", Value: "deli"}},
+		},
+		{
+			name:   "any",
+			filter: `filter: {any: [{shop: bakery}, {building: true}]}`,
+			expected: requirement{
+				{Key: "shop", Value: "bakery"},
+				{Key: "building"},
+			},
+		},
+		{
+			name:     "any with not",
+			filter:   `filter: {any: [{shop: bakery}, {not: {building: true}}]}`,
+			expected: nil,
+		},
+		{
+			name:     "osm tags",
+			filter:   `filter: {osm_tags: {shop: bakery}}`,
+			expected: nil,
+		},
+		{
+			name:     "geometry",
+			filter:   `filter: {geom_type: point}`,
+			expected: nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := parseFilter(t, tc.filter)
+
+			req := requiredTags(f.Filter)
+			if !reflect.DeepEqual(req, tc.expected) {
+				t.Errorf("incorrect requirement: %v", req)
+			}
+		})
+	}
+}
+
+func TestIndex_Match(t *testing.T) {
+	filters := []*Filter{
+		parseFilter(t, `filter: {shop: bakery, geom_type: polygon}`),
+		parseFilter(t, `filter: {shop: [bakery, deli]}`),
+		parseFilter(t, `filter: {not: {building: true}}`),
+		parseFilter(t, `filter: {building: true}`),
+	}
+
+	// filters past 64 use the next bitset word.
+	for i := 0; i < 70; i++ {
+		filters = append(filters, parseFilter(t, `filter: {amenity: cafe}`))
+	}
+	filters = append(filters, parseFilter(t, `filter: {amenity: bar}`))
+
+	idx := NewIndex(filters)
+
+	cases := []struct {
+		name     string
+		geometry orb.Geometry
+		tags     map[string]string
+		expected int
+	}{
+		{
+			name:     "first match",
+			geometry: orb.Polygon{},
+			tags:     map[string]string{"shop": "bakery"},
+			expected: 0,
+		},
+		{
+			name:     "skip the first",
+			geometry: orb.Point{},
+			tags:     map[string]string{"shop": "bakery"},
+			expected: 1,
+		},
+		{
+			name:     "not",
+			geometry: orb.Point{},
+			tags:     map[string]string{"amenity": "cafe"},
+			expected: 2,
+		},
+		{
+			name:     "key",
+			geometry: orb.Point{},
+			tags:     map[string]string{"building": "yes", "amenity": "bar"},
+			expected: 3,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := &Context{Geometry: tc.geometry, Tags: tc.tags}
+
+			f := idx.Match(ctx)
+			if f != filters[tc.expected] {
+				t.Errorf("incorrect filter")
+			}
+		})
+	}
+
+	t.Run("last filter", func(t *testing.T) {
+		idx := NewIndex(filters[3:])
+		ctx := NewContext(nil, &geojson.Feature{
+			Geometry: orb.Point{},
+			Properties: geojson.Properties{
+				"type": "node",
+				"id":   1,
+				"tags": map[string]string{"amenity": "bar"},
+			},
+		})
+
+		if f := idx.Match(ctx); f != filters[len(filters)-1] {
+			t.Errorf("incorrect filter")
+		}
+	})
+}
@@ -0,0 +1,681 @@
+package filter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// maxCombinations limits the size of a condition expanded into combinations.
+// Large `not: all: [...]` conditions can explode, the extra combinations
+// are replaced by a single unresolved condition.
+const maxCombinations = 4096
+
+// geometryTypes are all the types a geometry type condition can match.
+var geometryTypes = []string{
+	"Point", "MultiPoint",
+	"LineString", "MultiLineString",
+	"Polygon", "MultiPolygon",
+}
+
+// A TagCondition is a requirement on one tag of the element.
+type TagCondition struct {
+	Key string `json:"key"`
+
+	// Values the tag must have one of, empty for any value.
+	Values []string `json:"values,omitempty"`
+
+	// Not inverts the condition, the tag must not have one of the
+	// values, or must not exist if there are no values.
+	Not bool `json:"not,omitempty"`
+}
+
+// String returns the condition as `key=a|b`, `key=*`, `key!=a|b` or `key!=*`.
+func (tc TagCondition) String() string {
+	op := "="
+	if tc.Not {
+		op = "!="
+	}
+
+	if len(tc.Values) == 0 {
+		return tc.Key + op + "*"
+	}
+
+	return tc.Key + op + strings.Join(tc.Values, "|")
+}
+
+// A Combination is a set of conditions that must all be true for
+// a filter to match and output the requested values.
+type Combination struct {
+	Tags []TagCondition `json:"tags"`
+
+	// GeometryTypes the element must have one of, empty for any type.
+	GeometryTypes []string `json:"geometry_types,omitempty"`
+
+	// Other are the conditions that depend on more than the tags and
+	// can't be resolved, eg. `way_area >= 1000`.
+	Other []string `json:"other,omitempty"`
+
+	// Computed are the output keys whose value is computed,
+	// eg. by a function, so it is unknown if they have the requested value.
+	Computed []string `json:"computed,omitempty"`
+}
+
+// String returns the conditions separated by commas.
+func (c Combination) String() string {
+	var parts []string
+	for _, t := range c.Tags {
+		parts = append(parts, t.String())
+	}
+
+	if len(c.GeometryTypes) > 0 {
+		parts = append(parts, "geometry="+strings.Join(c.GeometryTypes, "|"))
+	}
+
+	parts = append(parts, c.Other...)
+	if len(c.Computed) > 0 {
+		parts = append(parts, "computed("+strings.Join(c.Computed, ", ")+")")
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// Combinations statically walks the filter and output expressions to find
+// the combinations of tags and geometry types for which the filter will
+// match and output the values, eg. `{"kind": "cafe"}`. An empty value
+// matches any output. Constant outputs, including the branches of `case`
+// and `lookup` expressions and `col` tag values, are resolved exactly.
+// Other outputs are included with the key in Computed.
+// Must call Compile() first to initialize the filter.
+func (f *Filter) Combinations(values map[string]string) []Combination {
+	if f.Skip || f.MinZoom == nil {
+		// filters without a min zoom don't output anything
+		return nil
+	}
+
+	result := dnf{{}}
+	if f.Filter != nil {
+		result = toDNF(f.Filter, false)
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		var expr Expression
+		for _, o := range f.Output {
+			if o.Key == k {
+				expr = o.Expr
+			}
+		}
+
+		if expr == nil {
+			return nil
+		}
+
+		if values[k] == "" {
+			continue
+		}
+
+		var matching dnf
+		for _, o := range outcomes(expr) {
+			switch {
+			case o.Computed:
+				matching = matching.or(o.Cond.and(dnf{{computed: []string{k}}}))
+			case o.Col != "":
+				col := dnf{{tags: []TagCondition{{Key: o.Col, Values: []string{values[k]}}}}}
+				matching = matching.or(o.Cond.and(col))
+			case o.Value != nil && fmt.Sprint(o.Value) == values[k]:
+				matching = matching.or(o.Cond)
+			}
+		}
+
+		result = result.and(matching)
+	}
+
+	combinations := make([]Combination, 0, len(result))
+	for _, c := range result {
+		combinations = append(combinations, c.combination())
+	}
+
+	return combinations
+}
+
+// OutputValues summarizes the values an output of a filter can have.
+type OutputValues struct {
+	// Types are the json types of the values,
+	// eg. string, number, boolean or array.
+	Types []string
+
+	// Values are the constant values, including the tag values
+	// of `col` outputs that are limited by the filter conditions.
+	Values []interface{}
+
+	// Computed is true if the output can have values that can't be
+	// enumerated, eg. the value of a tag or computed by a function.
+	Computed bool
+}
+
+// OutputValues returns the values the output can have. Returns nil if
+// the filter does not have the output or does not output anything.
+// Must call Compile() first to initialize the filter.
+func (f *Filter) OutputValues(key string) *OutputValues {
+	if f.Skip || f.MinZoom == nil {
+		return nil
+	}
+
+	var expr Expression
+	for _, o := range f.Output {
+		if o.Key == key {
+			expr = o.Expr
+		}
+	}
+
+	if expr == nil {
+		return nil
+	}
+
+	filter := dnf{{}}
+	if f.Filter != nil {
+		filter = toDNF(f.Filter, false)
+	}
+
+	result := &OutputValues{}
+	addValue := func(v interface{}) {
+		for _, val := range result.Values {
+			if val == v {
+				return
+			}
+		}
+
+		result.Values = append(result.Values, v)
+	}
+
+	for _, o := range outcomes(expr) {
+		switch {
+		case o.Computed:
+			result.Computed = true
+			if o.Type != "" {
+				result.Types = appendUnique(result.Types, o.Type)
+			}
+		case o.Col != "":
+			result.Types = appendUnique(result.Types, "string")
+			for _, c := range filter.and(o.Cond) {
+				values := c.tagValues(o.Col)
+				if values == nil {
+					result.Computed = true
+				}
+
+				for _, v := range values {
+					addValue(v)
+				}
+			}
+		default:
+			result.Types = appendUnique(result.Types, valueType(o.Value))
+			addValue(o.Value)
+		}
+	}
+
+	return result
+}
+
+// An outcome is a possible value of an output expression
+// and the conditions for it.
+type outcome struct {
+	Cond     dnf
+	Value    interface{}
+	Col      string
+	Computed bool
+	Type     string // json type of computed values, if known
+}
+
+// outcomes returns the possible values of the expression.
+// Outcomes without a value are not included.
+func outcomes(e Expression) []outcome {
+	switch e := e.(type) {
+	case *stringExpr:
+		return []outcome{{Cond: dnf{{}}, Value: e.Val}}
+	case *numExpr:
+		return []outcome{{Cond: dnf{{}}, Value: e.Val}}
+	case *boolExpr:
+		return []outcome{{Cond: dnf{{}}, Value: e.Val}}
+	case *nilExpr:
+		return nil
+	case *colExpr:
+		return []outcome{{Cond: dnf{{}}, Col: e.Key}}
+	case *condExpr:
+		return []outcome{{Cond: toDNF(e.Condition, false), Value: true}}
+	case *caseExpr:
+		return caseOutcomes(e.Whens, e.Thens, e.Else)
+	case *numCaseExpr:
+		thens := make([]Expression, len(e.Thens))
+		for i, t := range e.Thens {
+			thens[i] = t.(Expression)
+		}
+
+		var els Expression
+		if e.Else != nil {
+			els = e.Else.(Expression)
+		}
+
+		return caseOutcomes(e.Whens, thens, els)
+	case *lookupExpr:
+		return lookupOutcomes(e.Key, e.Op, e.Values, e.Thens, e.Default)
+	case *lookupNumExpr:
+		return lookupNumOutcomes(e)
+	case *lookupNumExprLTE:
+		return lookupNumOutcomes(&e.lookupNumExpr)
+	case *lookupNumExprGTE:
+		return lookupNumOutcomes(&e.lookupNumExpr)
+	}
+
+	return []outcome{{Cond: dnf{{}}, Computed: true, Type: exprType(e)}}
+}
+
+// exprType returns the json type of the computed expression,
+// or an empty string if unknown.
+func exprType(e Expression) string {
+	switch e := e.(type) {
+	case NumExpression:
+		return "number"
+	case *colExpr:
+		return "string"
+	case safeInt:
+		return exprType(e.Arg)
+	case safeIntNum:
+		return "number"
+	case calculateIsBusRoute, tagStrToBool, trueOrNone, calculateIsBuildingOrPart,
+		*calculateIsBusRoute, *calculateIsBuildingOrPart:
+		return "boolean"
+	case hikingNetwork, cyclingNetwork, buildingKindDetail, buildingPartKindDetail,
+		*hikingNetwork, *cyclingNetwork:
+		return "string"
+	case getRelNetworks, *getRelNetworks:
+		return "array"
+	}
+
+	return ""
+}
+
+func valueType(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []interface{}, []string:
+		return "array"
+	}
+
+	return "number"
+}
+
+// caseOutcomes returns the outcomes of each branch. A branch is only
+// taken if none of the previous conditions match.
+func caseOutcomes(whens []Condition, thens []Expression, els Expression) []outcome {
+	var result []outcome
+
+	prev := dnf{{}}
+	for i, w := range whens {
+		cond := prev.and(toDNF(w, false))
+		for _, o := range outcomes(thens[i]) {
+			o.Cond = cond.and(o.Cond)
+			result = append(result, o)
+		}
+
+		prev = prev.and(toDNF(w, true))
+	}
+
+	if els != nil {
+		for _, o := range outcomes(els) {
+			o.Cond = prev.and(o.Cond)
+			result = append(result, o)
+		}
+	}
+
+	return result
+}
+
+func lookupOutcomes(key NumExpression, op string, values []float64, thens []interface{}, def Expression) []outcome {
+	var result []outcome
+
+	k := describeNum(key)
+	prev := dnf{{}}
+	for i, v := range values {
+		cond := fmt.Sprintf("%s %s %v", k, op, v)
+		result = append(result, outcome{
+			Cond:  prev.and(dnf{{other: []string{cond}}}),
+			Value: thens[i],
+		})
+
+		prev = prev.and(dnf{{other: []string{"not " + cond}}})
+	}
+
+	for _, o := range outcomes(def) {
+		o.Cond = prev.and(o.Cond)
+		result = append(result, o)
+	}
+
+	return result
+}
+
+func lookupNumOutcomes(e *lookupNumExpr) []outcome {
+	thens := make([]interface{}, len(e.Thens))
+	for i, t := range e.Thens {
+		thens[i] = t
+	}
+
+	return lookupOutcomes(e.Key, e.Op, e.Values, thens, e.Default.(Expression))
+}
+
+// dnf is a condition in disjunctive normal form,
+// one of the conjunctions must be true.
+type dnf []conjunction
+
+// conjunction is a set of conditions that must all be true.
+type conjunction struct {
+	tags     []TagCondition
+	geometry []string // nil for any geometry type
+	other    []string
+	computed []string
+}
+
+func (d dnf) or(o dnf) dnf {
+	return append(d, o...)
+}
+
+func (d dnf) and(o dnf) dnf {
+	if len(d)*len(o) > maxCombinations {
+		return dnf{{other: []string{"complex condition"}}}
+	}
+
+	var result dnf
+	for _, a := range d {
+		for _, b := range o {
+			if c, ok := a.and(b); ok {
+				result = append(result, c)
+			}
+		}
+	}
+
+	return result
+}
+
+// and merges the conjunctions, returns false if they contradict.
+func (c conjunction) and(o conjunction) (conjunction, bool) {
+	result := conjunction{
+		geometry: c.geometry,
+		other:    appendUnique(append([]string(nil), c.other...), o.other...),
+		computed: appendUnique(append([]string(nil), c.computed...), o.computed...),
+	}
+
+	if o.geometry != nil {
+		if result.geometry == nil {
+			result.geometry = o.geometry
+		} else {
+			result.geometry = intersect(result.geometry, o.geometry)
+			if len(result.geometry) == 0 {
+				return result, false
+			}
+		}
+	}
+
+	for _, o := range result.other {
+		if stringIn("not "+o, result.other) {
+			return result, false
+		}
+	}
+
+	tags := append(append([]TagCondition(nil), c.tags...), o.tags...)
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].Key < tags[j].Key })
+
+	for i := 0; i < len(tags); {
+		j := i
+		for j < len(tags) && tags[j].Key == tags[i].Key {
+			j++
+		}
+
+		t, ok := mergeTags(tags[i:j])
+		if !ok {
+			return result, false
+		}
+
+		result.tags = append(result.tags, t...)
+		i = j
+	}
+
+	return result, true
+}
+
+// mergeTags merges the conditions on the same tag,
+// returns false if they contradict.
+func mergeTags(tags []TagCondition) ([]TagCondition, bool) {
+	var (
+		exists    bool
+		missing   bool
+		anyValue  = true
+		values    []string
+		notValues []string
+	)
+
+	for _, t := range tags {
+		switch {
+		case !t.Not && len(t.Values) == 0:
+			exists = true
+		case !t.Not && anyValue:
+			exists = true
+			anyValue = false
+			values = append([]string(nil), t.Values...)
+		case !t.Not:
+			values = intersect(values, t.Values)
+		case len(t.Values) == 0:
+			missing = true
+		default:
+			notValues = appendUnique(notValues, t.Values...)
+		}
+	}
+
+	key := tags[0].Key
+	switch {
+	case missing:
+		return []TagCondition{{Key: key, Not: true}}, !exists
+	case !exists:
+		return []TagCondition{{Key: key, Values: notValues, Not: true}}, true
+	case anyValue && len(notValues) == 0:
+		return []TagCondition{{Key: key}}, true
+	case anyValue:
+		return []TagCondition{{Key: key}, {Key: key, Values: notValues, Not: true}}, true
+	}
+
+	result := TagCondition{Key: key}
+	for _, v := range values {
+		if !stringIn(v, notValues) {
+			result.Values = append(result.Values, v)
+		}
+	}
+
+	return []TagCondition{result}, len(result.Values) > 0
+}
+
+// tagValues returns the values the tag must have one of, nil if any value.
+func (c conjunction) tagValues(key string) []string {
+	for _, t := range c.tags {
+		if t.Key == key && !t.Not && len(t.Values) > 0 {
+			return t.Values
+		}
+	}
+
+	return nil
+}
+
+func (c conjunction) combination() Combination {
+	result := Combination{
+		Tags:          c.tags,
+		GeometryTypes: c.geometry,
+		Other:         c.other,
+		Computed:      c.computed,
+	}
+
+	sort.Strings(result.Other)
+	sort.Strings(result.Computed)
+
+	return result
+}
+
+// toDNF converts the condition, or its negation, into disjunctive normal form.
+func toDNF(c Condition, not bool) dnf {
+	switch c := c.(type) {
+	case *allCond:
+		if not {
+			return anyDNF(*c, true)
+		}
+
+		return allDNF(*c, false)
+	case *anyCond:
+		if not {
+			return allDNF(*c, true)
+		}
+
+		return anyDNF(*c, false)
+	case *notCond:
+		return toDNF(c.Condition, !not)
+	case *osmTagsCond:
+		return toDNF(c.Condition, not)
+	case *stringCond:
+		if c.Val == "" {
+			// an empty value is the same as the tag not existing.
+			return dnf{{tags: []TagCondition{{Key: c.Key, Not: !not}}}}
+		}
+
+		return dnf{{tags: []TagCondition{{Key: c.Key, Values: []string{c.Val}, Not: not}}}}
+	case *stringInCond:
+		return dnf{{tags: []TagCondition{{Key: c.Key, Values: c.List, Not: not}}}}
+	case *boolCond:
+		return dnf{{tags: []TagCondition{{Key: c.Key, Not: c.Val == not}}}}
+	case geometryTypesCondSingle:
+		return geometryDNF([]string{string(c)}, not)
+	case *geometryTypesCond:
+		return geometryDNF(c.Types, not)
+	}
+
+	d := describeCond(c)
+	if not {
+		d = "not " + d
+	}
+
+	return dnf{{other: []string{d}}}
+}
+
+func allDNF(conds []Condition, not bool) dnf {
+	result := dnf{{}}
+	for _, c := range conds {
+		result = result.and(toDNF(c, not))
+	}
+
+	return result
+}
+
+func anyDNF(conds []Condition, not bool) dnf {
+	var result dnf
+	for _, c := range conds {
+		result = result.or(toDNF(c, not))
+	}
+
+	return result
+}
+
+func geometryDNF(types []string, not bool) dnf {
+	if !not {
+		return dnf{{geometry: types}}
+	}
+
+	var result []string
+	for _, t := range geometryTypes {
+		if !stringIn(t, types) {
+			result = append(result, t)
+		}
+	}
+
+	if len(result) == 0 {
+		return nil
+	}
+
+	return dnf{{geometry: result}}
+}
+
+// describeCond returns a description of conditions that
+// do not depend on just the tags.
+func describeCond(c Condition) string {
+	switch c := c.(type) {
+	case *wayAreaCond:
+		return describeMinMax("way_area", c.MinMax)
+	case *volumeCond:
+		return describeMinMax("volume", c.MinMax)
+	case *compareCond:
+		return fmt.Sprintf("%s %s %s", describeNum(c.Left), c.Operator, describeNum(c.Right))
+	}
+
+	return fmt.Sprintf("%T", c)
+}
+
+func describeMinMax(name string, mm *minMaxCond) string {
+	var parts []string
+	if mm.Min != -math.MaxFloat64 {
+		parts = append(parts, fmt.Sprintf("%s >= %v", name, mm.Min))
+	}
+
+	if mm.Max != math.MaxFloat64 {
+		parts = append(parts, fmt.Sprintf("%s <= %v", name, mm.Max))
+	}
+
+	if len(parts) == 0 {
+		return name
+	}
+
+	return strings.Join(parts, " and ")
+}
+
+// describeNum returns a description of a numeric expression.
+func describeNum(e NumExpression) string {
+	switch e := e.(type) {
+	case *numExpr:
+		return fmt.Sprint(e.Val)
+	case *areaExpr:
+		return "way_area"
+	case *zoomExpr:
+		return "zoom"
+	case *heightExpr:
+		return "height"
+	case *toFloatMeters:
+		if c, ok := e.Args[0].(*colExpr); ok {
+			return c.Key
+		}
+	}
+
+	return "expression"
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		if !stringIn(v, list) {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+func intersect(a, b []string) []string {
+	var result []string
+	for _, v := range a {
+		if stringIn(v, b) {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
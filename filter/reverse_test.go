@@ -0,0 +1,240 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterCombinations(t *testing.T) {
+	cases := []struct {
+		name     string
+		filter   string
+		values   map[string]string
+		expected []string
+	}{
+		{
+			name: "constant output",
+			filter: `
+filter: {amenity: bicycle_rental, name: true}
+min_zoom: 16
+output: {kind: bicycle_rental}`,
+			values:   map[string]string{"kind": "bicycle_rental"},
+			expected: []string{"amenity=bicycle_rental, name=*"},
+		},
+		{
+			name: "constant output does not match",
+			filter: `
+filter: {amenity: bicycle_rental}
+min_zoom: 16
+output: {kind: bicycle_rental}`,
+			values:   map[string]string{"kind": "cafe"},
+			expected: nil,
+		},
+		{
+			name: "col output",
+			filter: `
+filter: {amenity: [cafe, bar]}
+min_zoom: 16
+output: {kind: {col: amenity}}`,
+			values:   map[string]string{"kind": "bar"},
+			expected: []string{"amenity=bar"},
+		},
+		{
+			name: "col output not in filter",
+			filter: `
+filter: {amenity: [cafe, bar]}
+min_zoom: 16
+output: {kind: {col: amenity}}`,
+			values:   map[string]string{"kind": "pub"},
+			expected: nil,
+		},
+		{
+			name: "no min zoom",
+			filter: `
+filter: {amenity: cafe}
+output: {kind: cafe}`,
+			values:   map[string]string{"kind": "cafe"},
+			expected: nil,
+		},
+		{
+			name: "any and not",
+			filter: `
+filter:
+  any:
+    - shop: bicycle
+    - all:
+        - amenity: bicycle_repair_station
+        - not: {operator: true}
+  geom_type: point
+min_zoom: 16
+output: {kind: bicycle}`,
+			values: map[string]string{"kind": "bicycle"},
+			expected: []string{
+				"shop=bicycle, geometry=Point",
+				"amenity=bicycle_repair_station, operator!=*, geometry=Point",
+			},
+		},
+		{
+			name: "case output",
+			filter: `
+filter: {highway: [primary, secondary]}
+min_zoom: 12
+output:
+  kind: major_road
+  kind_detail:
+    case:
+      - when: {highway: primary}
+        then: primary
+      - when: {ref: true}
+        then: ref
+      - else: other`,
+			values: map[string]string{"kind": "major_road", "kind_detail": "other"},
+			expected: []string{
+				"highway=secondary, ref!=*",
+			},
+		},
+		{
+			name: "lookup output",
+			filter: `
+filter: {building: true}
+min_zoom: 16
+output:
+  kind:
+    lookup:
+      key: { col: way_area }
+      op: '>='
+      table:
+        - [ big, 1000 ]
+        - [ medium, 100 ]
+      default: small`,
+			values: map[string]string{"kind": "medium"},
+			expected: []string{
+				"building=*, not way_area >= 1000, way_area >= 100",
+			},
+		},
+		{
+			name: "computed output",
+			filter: `
+filter: {route: bicycle}
+min_zoom: 16
+output: {kind: {call: {func: mz_calculate_path_major_route, args: []}}}`,
+			values:   map[string]string{"kind": "path"},
+			expected: []string{"route=bicycle, computed(kind)"},
+		},
+		{
+			name: "contradiction",
+			filter: `
+filter: {amenity: cafe, not: {amenity: [cafe, bar]}}
+min_zoom: 16
+output: {kind: cafe}`,
+			values:   map[string]string{"kind": "cafe"},
+			expected: nil,
+		},
+		{
+			name: "missing output",
+			filter: `
+filter: {amenity: cafe}
+min_zoom: 16
+output: {kind: cafe}`,
+			values:   map[string]string{"kind": "cafe", "kind_detail": "coffee"},
+			expected: nil,
+		},
+		{
+			name: "empty value matches any output",
+			filter: `
+filter: {amenity: cafe}
+min_zoom: 16
+output: {kind: cafe}`,
+			values:   map[string]string{"kind": ""},
+			expected: []string{"amenity=cafe"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := parseFilter(t, tc.filter)
+
+			var result []string
+			for _, c := range f.Combinations(tc.values) {
+				result = append(result, c.String())
+			}
+
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("incorrect combinations")
+				t.Logf("%q", result)
+				t.Logf("%q", tc.expected)
+			}
+		})
+	}
+}
+
+func TestFilterOutputValues(t *testing.T) {
+	f := parseFilter(t, `
+filter: {amenity: [cafe, bar]}
+min_zoom: 16
+output:
+  kind: {col: amenity}
+  kind_detail:
+    case:
+      - when: {cuisine: coffee_shop}
+        then: coffee
+      - else: {col: cuisine}
+  capacity: {call: {func: tz_estimate_parking_capacity, args: []}}
+  is_cafe: {cond: {amenity: cafe}}`)
+
+	cases := []struct {
+		name     string
+		key      string
+		expected *OutputValues
+	}{
+		{
+			name: "col limited by filter",
+			key:  "kind",
+			expected: &OutputValues{
+				Types:  []string{"string"},
+				Values: []interface{}{"cafe", "bar"},
+			},
+		},
+		{
+			name: "case with col",
+			key:  "kind_detail",
+			expected: &OutputValues{
+				Types:    []string{"string"},
+				Values:   []interface{}{"coffee"},
+				Computed: true,
+			},
+		},
+		{
+			name: "function",
+			key:  "capacity",
+			expected: &OutputValues{
+				Types:    []string{"number"},
+				Computed: true,
+			},
+		},
+		{
+			name: "condition",
+			key:  "is_cafe",
+			expected: &OutputValues{
+				Types:  []string{"boolean"},
+				Values: []interface{}{true},
+			},
+		},
+		{
+			name:     "not an output",
+			key:      "name",
+			expected: nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			v := f.OutputValues(tc.key)
+			if !reflect.DeepEqual(v, tc.expected) {
+				t.Errorf("incorrect output values")
+				t.Logf("%+v", v)
+				t.Logf("%+v", tc.expected)
+			}
+		})
+	}
+}
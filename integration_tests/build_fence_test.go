@@ -0,0 +1,137 @@
+package integrationtests
+
+import (
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/osm"
+)
+
+func TestBuildFence(t *testing.T) {
+	nodes := osm.Nodes{
+		{ID: 1, Lat: 0.0000, Lon: 0.0000, Visible: true},
+		{ID: 2, Lat: 0.0010, Lon: 0.0000, Visible: true},
+		{ID: 3, Lat: 0.0010, Lon: 0.0010, Visible: true},
+		{ID: 4, Lat: 0.0000, Lon: 0.0010, Visible: true},
+	}
+
+	findKind := func(t *testing.T, layer *geojson.FeatureCollection, kind string) []*geojson.Feature {
+		t.Helper()
+
+		var result []*geojson.Feature
+		for _, f := range layer.Features {
+			if f.Properties["kind"] == kind {
+				result = append(result, f)
+			}
+		}
+
+		return result
+	}
+
+	findBarrier := func(t *testing.T, layer *geojson.FeatureCollection, barrier string) []*geojson.Feature {
+		t.Helper()
+
+		var result []*geojson.Feature
+		for _, f := range layer.Features {
+			if f.Properties["barrier"] == barrier && f.Geometry.GeoJSONType() == geojson.TypeLineString {
+				result = append(result, f)
+			}
+		}
+
+		return result
+	}
+
+	t.Run("landuse with fence", func(t *testing.T) {
+		data := &osm.OSM{
+			Nodes: nodes,
+			Ways: osm.Ways{
+				{ID: 10, Visible: true,
+					Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 1}},
+					Tags: osm.Tags{
+						{Key: "landuse", Value: "meadow"},
+						{Key: "barrier", Value: "fence"},
+					},
+				},
+			},
+		}
+
+		tile := processOSM(t, data, 16)
+		meadows := findKind(t, tile["landuse"], "meadow")
+		if len(meadows) != 2 {
+			t.Fatalf("should keep landuse polygon and add fence: %v", len(meadows))
+		}
+
+		for _, f := range meadows {
+			if f.Geometry.GeoJSONType() != geojson.TypePolygon {
+				continue
+			}
+
+			if v, ok := f.Properties["barrier"]; ok {
+				t.Errorf("should remove barrier from the polygon: %v", v)
+			}
+		}
+
+		fences := findBarrier(t, tile["landuse"], "fence")
+		if len(fences) != 1 {
+			t.Fatalf("should create fence: %v", len(fences))
+		}
+
+		partialMatch(t, fences[0].Properties, geojson.Properties{
+			"id":      10,
+			"kind":    "meadow",
+			"barrier": "fence",
+		})
+	})
+
+	t.Run("closed hedge", func(t *testing.T) {
+		data := &osm.OSM{
+			Nodes: nodes,
+			Ways: osm.Ways{
+				{ID: 10, Visible: true,
+					Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 1}},
+					Tags:  osm.Tags{{Key: "barrier", Value: "hedge"}},
+				},
+			},
+		}
+
+		tile := processOSM(t, data, 16)
+		hedges := findKind(t, tile["landuse"], "hedge")
+		if len(hedges) != 1 {
+			t.Fatalf("should have one hedge: %v", len(hedges))
+		}
+
+		if gt := hedges[0].Geometry.GeoJSONType(); gt != geojson.TypeLineString {
+			t.Errorf("hedge should be a line: %v", gt)
+		}
+	})
+
+	t.Run("clipped to tile", func(t *testing.T) {
+		data := &osm.OSM{
+			Nodes: nodes,
+			Ways: osm.Ways{
+				{ID: 10, Visible: true,
+					Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 1}},
+					Tags:  osm.Tags{{Key: "barrier", Value: "hedge"}},
+				},
+			},
+		}
+
+		tile := maptile.At(orb.Point{0.0005, 0.0005}, 18)
+		layers, err := config.Process(data, tile.Bound(), 18)
+		if err != nil {
+			t.Fatalf("process error: %v", err)
+		}
+
+		hedges := findKind(t, layers["landuse"], "hedge")
+		if len(hedges) != 1 {
+			t.Fatalf("should have one hedge: %v", len(hedges))
+		}
+
+		b := hedges[0].Geometry.Bound()
+		if !tile.Bound().Contains(b.Min) || !tile.Bound().Contains(b.Max) {
+			t.Errorf("should be clipped to the tile: %v", b)
+		}
+	})
+}
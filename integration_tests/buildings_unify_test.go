@@ -0,0 +1,89 @@
+package integrationtests
+
+import (
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+func TestBuildingsUnify(t *testing.T) {
+	nodes := osm.Nodes{
+		{ID: 1, Lat: 0.0000, Lon: 0.0000, Visible: true},
+		{ID: 2, Lat: 0.0010, Lon: 0.0000, Visible: true},
+		{ID: 3, Lat: 0.0010, Lon: 0.0010, Visible: true},
+		{ID: 4, Lat: 0.0000, Lon: 0.0010, Visible: true},
+
+		{ID: 5, Lat: 0.0002, Lon: 0.0002, Visible: true},
+		{ID: 6, Lat: 0.0004, Lon: 0.0002, Visible: true},
+		{ID: 7, Lat: 0.0004, Lon: 0.0004, Visible: true},
+		{ID: 8, Lat: 0.0002, Lon: 0.0004, Visible: true},
+	}
+
+	building := &osm.Way{ID: 10, Visible: true,
+		Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 1}},
+		Tags:  osm.Tags{{Key: "building", Value: "yes"}},
+	}
+
+	part := &osm.Way{ID: 11, Visible: true,
+		Nodes: osm.WayNodes{{ID: 5}, {ID: 6}, {ID: 7}, {ID: 8}, {ID: 5}},
+		Tags:  osm.Tags{{Key: "building:part", Value: "yes"}},
+	}
+
+	t.Run("contained by building", func(t *testing.T) {
+		data := &osm.OSM{
+			Nodes: nodes,
+			Ways:  osm.Ways{building, part},
+		}
+
+		tile := processOSM(t, data, 16)
+		p := findFeature(t, tile["buildings"].Features, 11)
+		if v := p.Properties["root_id"]; v != 10 {
+			t.Errorf("incorrect root_id: %v", v)
+		}
+
+		b := findFeature(t, tile["buildings"].Features, 10)
+		if v, ok := b.Properties["root_id"]; ok {
+			t.Errorf("building should not have root_id: %v", v)
+		}
+	})
+
+	t.Run("building relation outline", func(t *testing.T) {
+		outline := &osm.Way{ID: 12, Visible: true,
+			Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 1}},
+			Tags:  osm.Tags{{Key: "building", Value: "yes"}},
+		}
+
+		data := &osm.OSM{
+			Nodes: nodes,
+			Ways:  osm.Ways{building, part, outline},
+			Relations: osm.Relations{
+				{ID: 20, Visible: true,
+					Members: osm.Members{
+						{Type: osm.TypeWay, Ref: 12, Role: "outline"},
+						{Type: osm.TypeWay, Ref: 11, Role: "part"},
+					},
+					Tags: osm.Tags{{Key: "type", Value: "building"}},
+				},
+			},
+		}
+
+		tile := processOSM(t, data, 16)
+		p := findFeature(t, tile["buildings"].Features, 11)
+		if v := p.Properties["root_id"]; v != 12 {
+			t.Errorf("should use relation outline: %v", v)
+		}
+	})
+
+	t.Run("not contained", func(t *testing.T) {
+		data := &osm.OSM{
+			Nodes: nodes,
+			Ways:  osm.Ways{part},
+		}
+
+		tile := processOSM(t, data, 16)
+		p := findFeature(t, tile["buildings"].Features, 11)
+		if v, ok := p.Properties["root_id"]; ok {
+			t.Errorf("should not have root_id: %v", v)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package integrationtests
+
+import (
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osmzen"
+	"github.com/paulmach/osmzen/postprocess"
+)
+
+func TestCountryNetworks(t *testing.T) {
+	data := &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Lat: 0.0000, Lon: 0.0000, Visible: true},
+			{ID: 2, Lat: 0.0010, Lon: 0.0010, Visible: true},
+		},
+		Ways: osm.Ways{
+			{ID: 10, Visible: true,
+				Nodes: osm.WayNodes{{ID: 1}, {ID: 2}},
+				Tags: osm.Tags{
+					{Key: "highway", Value: "motorway"},
+					{Key: "ref", Value: "M25"},
+				},
+			},
+		},
+	}
+
+	t.Run("without a resolver", func(t *testing.T) {
+		tile := processOSM(t, data, 16)
+
+		props := tile["roads"].Features[0].Properties
+		if v, ok := props["network"]; ok {
+			t.Errorf("should not have network: %v", v)
+		}
+	})
+
+	t.Run("with a resolver", func(t *testing.T) {
+		tile := processWithCountry(t, data, "GB")
+		partialMatch(t, tile["roads"].Features[0].Properties, geojson.Properties{
+			"network":     "GB:M-road",
+			"shield_text": "M25",
+		})
+	})
+
+	t.Run("operator fallback", func(t *testing.T) {
+		data := &osm.OSM{
+			Nodes: data.Nodes,
+			Ways: osm.Ways{
+				{ID: 10, Visible: true,
+					Nodes: osm.WayNodes{{ID: 1}, {ID: 2}},
+					Tags: osm.Tags{
+						{Key: "highway", Value: "motorway"},
+						{Key: "ref", Value: "A 7"},
+						{Key: "operator", Value: "Bundesrepublik Deutschland"},
+					},
+				},
+			},
+		}
+
+		tile := processOSM(t, data, 16)
+		partialMatch(t, tile["roads"].Features[0].Properties, geojson.Properties{
+			"network": "DE:BAB",
+		})
+	})
+
+	t.Run("country without fixups", func(t *testing.T) {
+		tile := processWithCountry(t, data, "DK")
+		props := tile["roads"].Features[0].Properties
+		if v, ok := props["network"]; ok {
+			t.Errorf("should not have network: %v", v)
+		}
+	})
+}
+
+func processWithCountry(t *testing.T, data *osm.OSM, country string) map[string]*geojson.FeatureCollection {
+	t.Helper()
+
+	config, err := osmzen.Load(
+		"../config/queries.yaml",
+		osmzen.WithCountryResolver(postprocess.CountryResolverFunc(func(orb.Point) string {
+			return country
+		})),
+	)
+	if err != nil {
+		t.Fatalf("unable to load config: %v", err)
+	}
+
+	tile, err := config.Process(data, maptile.Tile{}.Bound(), 16)
+	if err != nil {
+		t.Fatalf("process error: %v", err)
+	}
+
+	return tile
+}
@@ -0,0 +1,98 @@
+package integrationtests
+
+import (
+	"testing"
+
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osm"
+)
+
+func TestKoreanRoadNetworkFromNcat(t *testing.T) {
+	cases := []struct {
+		name     string
+		tags     osm.Tags
+		expected geojson.Properties
+	}{
+		{
+			name: "expressway",
+			tags: osm.Tags{
+				{Key: "highway", Value: "motorway"},
+				{Key: "ncat", Value: "고속도로"},
+				{Key: "ref", Value: "1"},
+			},
+			expected: geojson.Properties{
+				"network":     "KR:expressway",
+				"shield_text": "1",
+			},
+		},
+		{
+			name: "national road",
+			tags: osm.Tags{
+				{Key: "highway", Value: "trunk"},
+				{Key: "ncat", Value: "국도"},
+				{Key: "ref", Value: "77"},
+			},
+			expected: geojson.Properties{
+				"network":     "KR:national",
+				"shield_text": "77",
+			},
+		},
+		{
+			name: "provincial road",
+			tags: osm.Tags{
+				{Key: "highway", Value: "secondary"},
+				{Key: "ncat", Value: "지방도"},
+				{Key: "ref", Value: "1023"},
+			},
+			expected: geojson.Properties{
+				"network":     "KR:local",
+				"shield_text": "1023",
+			},
+		},
+		{
+			name: "metropolitan road",
+			tags: osm.Tags{
+				{Key: "highway", Value: "primary"},
+				{Key: "ncat", Value: "광역시도로"},
+				{Key: "ref", Value: "21"},
+			},
+			expected: geojson.Properties{
+				"network":     "KR:metropolitan",
+				"shield_text": "21",
+			},
+		},
+		{
+			name: "network tag takes precedence",
+			tags: osm.Tags{
+				{Key: "highway", Value: "trunk"},
+				{Key: "ncat", Value: "국도"},
+				{Key: "network", Value: "KR:expressway"},
+				{Key: "ref", Value: "1"},
+			},
+			expected: geojson.Properties{
+				"network": "KR:expressway",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := &osm.OSM{
+				Nodes: osm.Nodes{
+					{ID: 1, Lat: 37.5000, Lon: 127.0000, Visible: true},
+					{ID: 2, Lat: 37.5010, Lon: 127.0010, Visible: true},
+				},
+				Ways: osm.Ways{
+					{ID: 10, Visible: true, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}, Tags: tc.tags},
+				},
+			}
+
+			tile := processOSM(t, data, 16)
+			if l := len(tile["roads"].Features); l != 1 {
+				t.Fatalf("should have one road: %v", l)
+			}
+
+			partialMatch(t, tile["roads"].Features[0].Properties, tc.expected)
+		})
+	}
+}
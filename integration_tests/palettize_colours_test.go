@@ -0,0 +1,116 @@
+package integrationtests
+
+import (
+	"testing"
+
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osm"
+)
+
+func TestPalettizeColours(t *testing.T) {
+	nodes := osm.Nodes{
+		{ID: 1, Lat: 0.0000, Lon: 0.0000, Visible: true},
+		{ID: 2, Lat: 0.0010, Lon: 0.0000, Visible: true},
+		{ID: 3, Lat: 0.0010, Lon: 0.0010, Visible: true},
+		{ID: 4, Lat: 0.0000, Lon: 0.0010, Visible: true},
+	}
+
+	t.Run("building colours", func(t *testing.T) {
+		data := &osm.OSM{
+			Nodes: nodes,
+			Ways: osm.Ways{
+				{ID: 10, Visible: true,
+					Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 1}},
+					Tags: osm.Tags{
+						{Key: "building", Value: "yes"},
+						{Key: "building:colour", Value: "#fe0102"},
+						{Key: "roof:colour", Value: "Dark Red"},
+					},
+				},
+			},
+		}
+
+		tile := processOSM(t, data, 16)
+		partialMatch(t, tile["buildings"].Features[0].Properties, geojson.Properties{
+			"building_colour": "#ff0000",
+			"roof_colour":     "#8b0000",
+		})
+	})
+
+	t.Run("roof color spelling", func(t *testing.T) {
+		data := &osm.OSM{
+			Nodes: nodes,
+			Ways: osm.Ways{
+				{ID: 10, Visible: true,
+					Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 1}},
+					Tags: osm.Tags{
+						{Key: "building", Value: "yes"},
+						{Key: "roof:color", Value: "#fe0102"},
+					},
+				},
+			},
+		}
+
+		tile := processOSM(t, data, 16)
+		props := tile["buildings"].Features[0].Properties
+		partialMatch(t, props, geojson.Properties{
+			"roof_colour": "#ff0000",
+		})
+
+		if v, ok := props["roof_color"]; ok {
+			t.Errorf("should remove the alternate spelling: %v", v)
+		}
+	})
+
+	t.Run("unparsable colour", func(t *testing.T) {
+		data := &osm.OSM{
+			Nodes: nodes,
+			Ways: osm.Ways{
+				{ID: 10, Visible: true,
+					Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 1}},
+					Tags: osm.Tags{
+						{Key: "building", Value: "yes"},
+						{Key: "building:colour", Value: "brick"},
+					},
+				},
+			},
+		}
+
+		tile := processOSM(t, data, 16)
+		if v, ok := tile["buildings"].Features[0].Properties["building_colour"]; ok {
+			t.Errorf("should remove unparsable colour: %v", v)
+		}
+	})
+
+	t.Run("transit route colour", func(t *testing.T) {
+		data := &osm.OSM{
+			Nodes: nodes,
+			Ways: osm.Ways{
+				{ID: 10, Visible: true,
+					Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}},
+					Tags:  osm.Tags{{Key: "railway", Value: "rail"}},
+				},
+			},
+			Relations: osm.Relations{
+				{ID: 20, Visible: true,
+					Members: osm.Members{{Type: osm.TypeWay, Ref: 10}},
+					Tags: osm.Tags{
+						{Key: "type", Value: "route"},
+						{Key: "route", Value: "train"},
+						{Key: "colour", Value: "#E21"},
+					},
+				},
+			},
+		}
+
+		tile := processOSM(t, data, 16)
+		if len(tile["transit"].Features) == 0 {
+			t.Fatalf("should have transit feature")
+		}
+
+		partialMatch(t, tile["transit"].Features[0].Properties, geojson.Properties{
+			"colour":      "#ee2211",
+			"colour_name": "red",
+		})
+	})
+}
@@ -0,0 +1,143 @@
+package integrationtests
+
+import (
+	"testing"
+
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osm"
+)
+
+func routeRelation(id osm.RelationID, route, network, ref string, ways ...osm.WayID) *osm.Relation {
+	r := &osm.Relation{ID: id, Visible: true,
+		Tags: osm.Tags{
+			{Key: "type", Value: "route"},
+			{Key: "route", Value: route},
+		},
+	}
+
+	if network != "" {
+		r.Tags = append(r.Tags, osm.Tag{Key: "network", Value: network})
+	}
+
+	if ref != "" {
+		r.Tags = append(r.Tags, osm.Tag{Key: "ref", Value: ref})
+	}
+
+	for _, w := range ways {
+		r.Members = append(r.Members, osm.Member{Type: osm.TypeWay, Ref: int64(w)})
+	}
+
+	return r
+}
+
+func TestRouteNetworks(t *testing.T) {
+	nodes := osm.Nodes{
+		{ID: 1, Lat: 0.0000, Lon: 0.0000, Visible: true},
+		{ID: 2, Lat: 0.0010, Lon: 0.0010, Visible: true},
+	}
+
+	path := &osm.Way{ID: 10, Visible: true,
+		Nodes: osm.WayNodes{{ID: 1}, {ID: 2}},
+		Tags:  osm.Tags{{Key: "highway", Value: "path"}},
+	}
+
+	cases := []struct {
+		name      string
+		relations osm.Relations
+		expected  geojson.Properties
+	}{
+		{
+			name: "walking networks by importance",
+			relations: osm.Relations{
+				routeRelation(20, "hiking", "lwn", "L1", 10),
+				routeRelation(21, "foot", "nwn", "N1", 10),
+				routeRelation(22, "hiking", "rwn", "R1", 10),
+			},
+			expected: geojson.Properties{
+				"walking_network":          "nwn",
+				"walking_shield_text":      "N1",
+				"all_walking_networks":     []string{"nwn", "rwn", "lwn"},
+				"all_walking_shield_texts": []string{"N1", "R1", "L1"},
+			},
+		},
+		{
+			name: "bicycle network",
+			relations: osm.Relations{
+				routeRelation(20, "bicycle", "lcn", "3", 10),
+				routeRelation(21, "bicycle", "icn", "EV1", 10),
+			},
+			expected: geojson.Properties{
+				"bicycle_network":      "icn",
+				"bicycle_shield_text":  "EV1",
+				"all_bicycle_networks": []string{"icn", "lcn"},
+				"is_bicycle_related":   true,
+			},
+		},
+		{
+			name: "bus route",
+			relations: osm.Relations{
+				routeRelation(20, "bus", "Muni", "38", 10),
+				routeRelation(21, "bus", "Muni", "5", 10),
+			},
+			expected: geojson.Properties{
+				"is_bus_route":         true,
+				"bus_network":          "Muni",
+				"bus_shield_text":      "5",
+				"all_bus_shield_texts": []string{"5", "38"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := &osm.OSM{
+				Nodes:     nodes,
+				Ways:      osm.Ways{path},
+				Relations: tc.relations,
+			}
+
+			tile := processOSM(t, data, 16)
+			if l := len(tile["roads"].Features); l != 1 {
+				t.Fatalf("should have one road: %v", l)
+			}
+
+			partialMatch(t, tile["roads"].Features[0].Properties, tc.expected)
+		})
+	}
+}
+
+func TestRouteNetworksBusStopNotBusRoute(t *testing.T) {
+	// a bus stop node with the same id as the way should
+	// not make the way a bus route.
+	data := &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Lat: 0.0000, Lon: 0.0000, Visible: true},
+			{ID: 2, Lat: 0.0010, Lon: 0.0010, Visible: true},
+			{ID: 10, Lat: 0.0005, Lon: 0.0005, Visible: true},
+		},
+		Ways: osm.Ways{
+			{ID: 10, Visible: true,
+				Nodes: osm.WayNodes{{ID: 1}, {ID: 2}},
+				Tags:  osm.Tags{{Key: "highway", Value: "residential"}},
+			},
+		},
+		Relations: osm.Relations{
+			{ID: 20, Visible: true,
+				Members: osm.Members{{Type: osm.TypeNode, Ref: 10, Role: "stop"}},
+				Tags: osm.Tags{
+					{Key: "type", Value: "route"},
+					{Key: "route", Value: "bus"},
+				},
+			},
+		},
+	}
+
+	tile := processOSM(t, data, 16)
+	if l := len(tile["roads"].Features); l != 1 {
+		t.Fatalf("should have one road: %v", l)
+	}
+
+	if v, ok := tile["roads"].Features[0].Properties["is_bus_route"]; ok {
+		t.Errorf("should not be a bus route: %v", v)
+	}
+}
@@ -67,3 +67,16 @@ func processOSM(t *testing.T, o *osm.OSM, zooms ...int) map[string]*geojson.Feat
 
 	return tile
 }
+
+func findFeature(t *testing.T, features []*geojson.Feature, id int) *geojson.Feature {
+	t.Helper()
+
+	for _, f := range features {
+		if f.Properties["id"] == id {
+			return f
+		}
+	}
+
+	t.Fatalf("feature %d not found", id)
+	return nil
+}
@@ -0,0 +1,71 @@
+package osmzen
+
+import (
+	"github.com/paulmach/osmzen/filter"
+	"github.com/pkg/errors"
+)
+
+// A KindSource is a combination of tags and geometry types that
+// results in a kind and kind detail for a layer.
+type KindSource struct {
+	Layer string `json:"layer"`
+
+	// Filter is the index of the filter in the layer's yaml file.
+	Filter int `json:"filter"`
+
+	filter.Combination
+}
+
+// KindSources returns the tag combinations and geometry types that yield the
+// kind and kind detail in the layer. An empty layer will search all the layers,
+// an empty kind or kind detail will match any value. This is done statically
+// using the filter conditions and outputs, see filter.Filter.Combinations.
+// Earlier filters in a layer take precedence so some combinations can be
+// shadowed. Kinds set by the transforms and post processors are not included.
+func (c *Config) KindSources(layer, kind, kindDetail string) ([]KindSource, error) {
+	layers := c.All
+	if layer != "" {
+		if _, ok := c.Layers[layer]; !ok {
+			return nil, errors.Errorf("layer not defined: %v", layer)
+		}
+
+		layers = []string{layer}
+	}
+
+	values := map[string]string{"kind": kind}
+	if kindDetail != "" {
+		values["kind_detail"] = kindDetail
+	}
+
+	var result []KindSource
+	for _, name := range layers {
+		l := c.Layers[name]
+		for i, f := range l.filters {
+			for _, comb := range f.Combinations(values) {
+				if comb.GeometryTypes == nil {
+					comb.GeometryTypes = l.GeometryTypes
+				} else {
+					var types []string
+					for _, t := range comb.GeometryTypes {
+						if stringIn(t, l.GeometryTypes) {
+							types = append(types, t)
+						}
+					}
+
+					if len(types) == 0 {
+						continue
+					}
+					comb.GeometryTypes = types
+				}
+
+				result = append(result, KindSource{
+					Layer:       name,
+					Filter:      i,
+					Combination: comb,
+				})
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,62 @@
+package osmzen
+
+import (
+	"testing"
+)
+
+func TestConfigKindSources(t *testing.T) {
+	config, err := Load("config/queries.yaml")
+	if err != nil {
+		t.Fatalf("unable to load layer: %v", err)
+	}
+
+	cases := []struct {
+		name       string
+		layer      string
+		kind       string
+		kindDetail string
+		expected   string
+	}{
+		{
+			name:     "pois",
+			layer:    "pois",
+			kind:     "bicycle_rental",
+			expected: "amenity=bicycle_rental, operator!=*, geometry=Point|MultiPoint|Polygon|MultiPolygon",
+		},
+		{
+			name:       "kind detail in all layers",
+			kind:       "locality",
+			kindDetail: "city",
+			expected:   "name=*, place=city, geometry=Point|MultiPoint",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sources, err := config.KindSources(tc.layer, tc.kind, tc.kindDetail)
+			if err != nil {
+				t.Fatalf("lookup error: %v", err)
+			}
+
+			found := false
+			for _, s := range sources {
+				if tc.layer != "" && s.Layer != tc.layer {
+					t.Errorf("incorrect layer: %v", s.Layer)
+				}
+
+				if s.String() == tc.expected {
+					found = true
+				}
+			}
+
+			if !found {
+				t.Errorf("combination not found: %v", sources)
+			}
+		})
+	}
+
+	_, err = config.KindSources("not a layer", "cafe", "")
+	if err == nil {
+		t.Errorf("should error for undefined layer")
+	}
+}
@@ -3,6 +3,7 @@ package osmzen
 import (
 	"embed"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"path"
@@ -31,8 +32,23 @@ type Config struct {
 	Layers      map[string]*Layer     `yaml:"layers"`
 	PostProcess []*postprocess.Config `yaml:"post_process"`
 
-	postProcessors []postprocess.Function
-	clipFactors    map[string]float64
+	// postProcessors are the compiled PostProcess configs,
+	// nil if the function is not implemented.
+	postProcessors  []postprocess.Function
+	clipFactors     map[string]float64
+	countryResolver postprocess.CountryResolver
+}
+
+// A LoadOption sets optional config when loading.
+type LoadOption func(*Config)
+
+// WithCountryResolver sets the resolver used to find the country of features
+// for country specific processing, like road shield networks.
+// By default the country is guessed from the tags.
+func WithCountryResolver(r postprocess.CountryResolver) LoadOption {
+	return func(c *Config) {
+		c.countryResolver = r
+	}
 }
 
 // Layer defines config for a single layer.
@@ -41,16 +57,20 @@ type Layer struct {
 	GeometryTypes []string `yaml:"geometry_types"`
 	Transforms    []string `yaml:"transform"`
 
-	// Currently unused
+	// Sort is the order of the features, e.g. vectordatasource.sort.pois.
+	// AreaInclusionThreshold is the min area of polygons in square pixels.
+	// Both are applied before the post processing.
 	Sort                   string `yaml:"sort"`
 	AreaInclusionThreshold int    `yaml:"area-inclusion-threshold"`
 
 	filters    []*filter.Filter
+	index      *filter.Index
 	transforms []transform.Transform
+	sort       postprocess.Sort
 }
 
 // Load take a path to the queries.yaml file and load+compiles it.
-func Load(filename string) (*Config, error) {
+func Load(filename string, opts ...LoadOption) (*Config, error) {
 	data, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, errors.WithMessage(err, "failed to read config")
@@ -59,7 +79,7 @@ func Load(filename string) (*Config, error) {
 	dir, _ := path.Split(filename)
 	return loadConfig(data, func(name string) ([]byte, error) {
 		return os.ReadFile(path.Join(dir, name))
-	})
+	}, opts...)
 }
 
 // LoadEmbeddedConfig will load the config and layers using the compiled in assets.
@@ -75,24 +95,43 @@ func LoadEmbeddedConfig(asset func(string) ([]byte, error)) (*Config, error) {
 }
 
 // LoadDefaultConfig will load the default config embedded in this package.
-func LoadDefaultConfig() (*Config, error) {
-	data, err := DefaultConfig.ReadFile("config/queries.yaml")
+func LoadDefaultConfig(opts ...LoadOption) (*Config, error) {
+	return LoadFS(DefaultConfig, "config/queries.yaml", opts...)
+}
+
+// LoadFS loads+compiles the queries.yaml file at the path in the file system.
+// The layer and post process files are read relative to its directory.
+func LoadFS(fsys fs.FS, filename string, opts ...LoadOption) (*Config, error) {
+	data, err := fs.ReadFile(fsys, filename)
 	if err != nil {
-		return nil, err
+		return nil, errors.WithMessage(err, "failed to read config")
 	}
 
-	return loadConfig(data, func(name string) ([]byte, error) {
-		return DefaultConfig.ReadFile("config/" + name)
-	})
+	return loadConfig(data, fsAsset(fsys, filename), opts...)
+}
+
+func fsAsset(fsys fs.FS, filename string) func(string) ([]byte, error) {
+	dir, _ := path.Split(filename)
+	return func(name string) ([]byte, error) {
+		return fs.ReadFile(fsys, path.Join(dir, name))
+	}
 }
 
-func loadConfig(data []byte, asset func(name string) ([]byte, error)) (*Config, error) {
+func loadConfig(
+	data []byte,
+	asset func(name string) ([]byte, error),
+	opts ...LoadOption,
+) (*Config, error) {
 	c := &Config{}
 	err := yaml.Unmarshal(data, &c)
 	if err != nil {
 		return nil, errors.WithMessage(err, "failed to unmarshal")
 	}
 
+	for _, opt := range opts {
+		opt(c)
+	}
+
 	// clips factors is one, of potentially many things defined on the
 	// layer config that is needed by the post processors. All the information
 	// needs to be found here and passed to the compilers.
@@ -117,10 +156,6 @@ func loadConfig(data []byte, asset func(name string) ([]byte, error)) (*Config,
 			return nil, errors.WithMessage(err, fmt.Sprintf("post process %d", i))
 		}
 
-		if f == nil {
-			continue
-		}
-
 		c.postProcessors = append(c.postProcessors, f)
 	}
 
@@ -142,6 +177,14 @@ func (l *Layer) load(name string, asset func(string) ([]byte, error)) error {
 		return err
 	}
 
+	return l.compile()
+}
+
+// compile builds the index and transforms from the layer's
+// filters and transform names.
+func (l *Layer) compile() error {
+	l.index = filter.NewIndex(l.filters)
+
 	l.transforms = make([]transform.Transform, 0, len(l.Transforms))
 	for _, t := range l.Transforms {
 		tf, ok := transform.Map(t)
@@ -154,6 +197,15 @@ func (l *Layer) load(name string, asset func(string) ([]byte, error)) error {
 		}
 	}
 
+	l.sort = nil
+	if l.Sort != "" {
+		s, ok := postprocess.MapSort(l.Sort)
+		if !ok {
+			return errors.Errorf("sort undefined: %s", l.Sort)
+		}
+		l.sort = s
+	}
+
 	return nil
 }
 
@@ -48,6 +48,11 @@ func Compile(headers []string, rows [][]string) (*Matcher, error) {
 	return m, nil
 }
 
+// OutputKey returns the property set by the matcher, eg. sort_rank.
+func (m *Matcher) OutputKey() string {
+	return m.outputKey
+}
+
 // Eval will evaluate the matcher for the given geojson feature.
 // If there is a match it'll add the output property to the feature.
 func (m *Matcher) Eval(ctx *Context, feature *geojson.Feature) bool {
@@ -0,0 +1,72 @@
+package osmzen
+
+import (
+	"github.com/paulmach/osm"
+)
+
+// A MembershipIndex is a precomputed index of the ways and relations the
+// elements of a data set are members of, plus the lookups used to build the
+// element geometry. By default these are computed on every call to Process.
+// When processing many tiles from one large in-memory data set, the index can
+// be built once and passed to Process using WithMembershipIndex.
+// It is read only and safe for concurrent use.
+type MembershipIndex struct {
+	// Nodes and Ways are the lookups of the elements by id.
+	Nodes map[osm.NodeID]*osm.Node
+	Ways  map[osm.WayID]*osm.Way
+
+	// WayMembership is the ways each tagged node is a member of.
+	// Untagged nodes are not included since they are not features.
+	WayMembership map[osm.NodeID]osm.Ways
+
+	// RelationMembership is the relations each element is a direct member of.
+	// Relations that are members of other relations, e.g. a route in a
+	// route_master, are included but the membership is not transitive,
+	// the ways of the route are not members of the route_master.
+	RelationMembership map[osm.FeatureID]osm.Relations
+}
+
+// NewMembershipIndex builds the index for the data. The data should not
+// be changed after, as the index references the ways and relations.
+func NewMembershipIndex(data *osm.OSM) *MembershipIndex {
+	idx := &MembershipIndex{
+		Nodes:              make(map[osm.NodeID]*osm.Node, len(data.Nodes)),
+		Ways:               make(map[osm.WayID]*osm.Way, len(data.Ways)),
+		WayMembership:      make(map[osm.NodeID]osm.Ways),
+		RelationMembership: make(map[osm.FeatureID]osm.Relations),
+	}
+
+	for _, n := range data.Nodes {
+		idx.Nodes[n.ID] = n
+	}
+
+	for _, w := range data.Ways {
+		idx.Ways[w.ID] = w
+		for _, wn := range w.Nodes {
+			if n, ok := idx.Nodes[wn.ID]; ok && len(n.Tags) == 0 {
+				continue
+			}
+			idx.WayMembership[wn.ID] = append(idx.WayMembership[wn.ID], w)
+		}
+	}
+
+	for _, r := range data.Relations {
+		for _, m := range r.Members {
+			fid := m.FeatureID()
+			idx.RelationMembership[fid] = append(idx.RelationMembership[fid], r)
+		}
+	}
+
+	return idx
+}
+
+// WithMembershipIndex uses the precomputed index instead of computing it from
+// the data. The data passed to Process can be a subset, like a tile, of the
+// indexed data. The memberships and geometry then include the ways and relations
+// not in the subset, which gives better results for things like the road networks
+// of routes and the multipolygons that are partially in the tile.
+func WithMembershipIndex(idx *MembershipIndex) ProcessOption {
+	return func(o *processOptions) {
+		o.index = idx
+	}
+}
@@ -0,0 +1,204 @@
+package osmzen
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/osm"
+)
+
+func TestNewMembershipIndex(t *testing.T) {
+	route := &osm.Relation{
+		ID:   1,
+		Tags: osm.Tags{{Key: "type", Value: "route"}},
+		Members: osm.Members{
+			{Type: osm.TypeWay, Ref: 10},
+			{Type: osm.TypeNode, Ref: 2},
+		},
+	}
+	master := &osm.Relation{
+		ID:   2,
+		Tags: osm.Tags{{Key: "type", Value: "route_master"}},
+		Members: osm.Members{
+			{Type: osm.TypeRelation, Ref: 1},
+		},
+	}
+
+	data := &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1},
+			{ID: 2, Tags: osm.Tags{{Key: "highway", Value: "bus_stop"}}},
+		},
+		Ways: osm.Ways{
+			{ID: 10, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}}},
+		},
+		Relations: osm.Relations{route, master},
+	}
+
+	idx := NewMembershipIndex(data)
+
+	if len(idx.Nodes) != 2 || idx.Nodes[2] != data.Nodes[1] {
+		t.Errorf("incorrect nodes: %v", idx.Nodes)
+	}
+
+	if len(idx.Ways) != 1 || idx.Ways[10] != data.Ways[0] {
+		t.Errorf("incorrect ways: %v", idx.Ways)
+	}
+
+	// untagged nodes are not features
+	if _, ok := idx.WayMembership[1]; ok {
+		t.Errorf("untagged node should not have way membership")
+	}
+
+	for _, id := range []osm.NodeID{2, 3} {
+		if ws := idx.WayMembership[id]; len(ws) != 1 || ws[0].ID != 10 {
+			t.Errorf("node %d: incorrect way membership: %v", id, ws)
+		}
+	}
+
+	if rs := idx.RelationMembership[osm.WayID(10).FeatureID()]; len(rs) != 1 || rs[0] != route {
+		t.Errorf("incorrect way relation membership: %v", rs)
+	}
+
+	if rs := idx.RelationMembership[osm.RelationID(1).FeatureID()]; len(rs) != 1 || rs[0] != master {
+		t.Errorf("incorrect nested relation membership: %v", rs)
+	}
+
+	if rs := idx.RelationMembership[osm.RelationID(2).FeatureID()]; len(rs) != 0 {
+		t.Errorf("top level relation should not have membership: %v", rs)
+	}
+
+	// membership is direct, the members of the route are not members
+	// of the route_master.
+	for _, fid := range []osm.FeatureID{osm.WayID(10).FeatureID(), osm.NodeID(2).FeatureID()} {
+		rs := idx.RelationMembership[fid]
+		if len(rs) != 1 || rs[0] != route {
+			t.Errorf("%v: should only be a member of the route: %v", fid, rs)
+		}
+	}
+}
+
+func TestProcess_membershipIndex(t *testing.T) {
+	config, err := Load("config/queries.yaml")
+	if err != nil {
+		t.Fatalf("unable to load layer: %v", err)
+	}
+
+	tile := maptile.New(17896, 24450, 16)
+	data := loadFile(t, tile)
+
+	expected, err := config.Process(data, tile.Bound(), tile.Z)
+	if err != nil {
+		t.Fatalf("process error: %v", err)
+	}
+
+	idx := NewMembershipIndex(data)
+
+	// the index is shared by concurrent calls
+	var wg sync.WaitGroup
+	results := make([]map[string]*geojson.FeatureCollection, 4)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			result, err := config.Process(data, tile.Bound(), tile.Z, WithMembershipIndex(idx))
+			if err != nil {
+				t.Errorf("process error: %v", err)
+			}
+
+			results[i] = result
+		}(i)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		for name, fc := range expected {
+			if !reflect.DeepEqual(result[name], fc) {
+				t.Errorf("%s: results should be the same as computing the membership", name)
+			}
+		}
+	}
+}
+
+func TestProcess_membershipIndexSubset(t *testing.T) {
+	config, err := Load("config/queries.yaml")
+	if err != nil {
+		t.Fatalf("unable to load layer: %v", err)
+	}
+
+	road := &osm.Way{
+		ID:    10,
+		Nodes: osm.WayNodes{{ID: 1}, {ID: 2}},
+		Tags:  osm.Tags{{Key: "highway", Value: "residential"}},
+	}
+
+	data := &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Lon: 0.001, Lat: 0.001, Version: 1},
+			{ID: 2, Lon: 0.002, Lat: 0.002, Version: 1},
+		},
+		Ways: osm.Ways{road},
+	}
+	idx := NewMembershipIndex(data)
+
+	// the node locations are only in the index
+	subset := &osm.OSM{Ways: osm.Ways{road}}
+	tile := maptile.At(orb.Point{0.0015, 0.0015}, 16)
+
+	result, err := config.Process(subset, tile.Bound(), tile.Z, WithMembershipIndex(idx))
+	if err != nil {
+		t.Fatalf("process error: %v", err)
+	}
+
+	if l := len(result["roads"].Features); l != 1 {
+		t.Fatalf("should build the road from the index nodes: %v", l)
+	}
+
+	if ls, ok := result["roads"].Features[0].Geometry.(orb.LineString); !ok || len(ls) != 2 {
+		t.Errorf("incorrect geometry: %v", result["roads"].Features[0].Geometry)
+	}
+}
+
+func TestProcessZooms_membershipIndex(t *testing.T) {
+	config, err := Load("config/queries.yaml")
+	if err != nil {
+		t.Fatalf("unable to load layer: %v", err)
+	}
+
+	tile := maptile.New(17896, 24450, 16)
+	data := loadFile(t, tile)
+	idx := NewMembershipIndex(data)
+
+	expected, err := config.ProcessZooms(data, tile.Parent(), 15, 16)
+	if err != nil {
+		t.Fatalf("process error: %v", err)
+	}
+
+	result, err := config.ProcessZooms(data, tile.Parent(), 15, 16, WithMembershipIndex(idx))
+	if err != nil {
+		t.Fatalf("process error: %v", err)
+	}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("zooms should be the same with the index")
+	}
+
+	expected, err = config.ProcessMetatile(data, tile.Parent(), 16)
+	if err != nil {
+		t.Fatalf("process error: %v", err)
+	}
+
+	result, err = config.ProcessMetatile(data, tile.Parent(), 16, WithMembershipIndex(idx))
+	if err != nil {
+		t.Fatalf("process error: %v", err)
+	}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("metatile should be the same with the index")
+	}
+}
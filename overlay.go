@@ -0,0 +1,494 @@
+package osmzen
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/osmzen/filter"
+	"github.com/paulmach/osmzen/postprocess"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// An Overlay is a set of changes applied on top of a loaded config.
+// It allows for small customizations, like a few extra kinds, without
+// copying and patching the full config. An overlay yaml file looks like:
+//
+//	layers:
+//	  pois:
+//	    prepend_filters:
+//	      - id: kiosk_chain
+//	        filter: {shop: kiosk, brand: true}
+//	        min_zoom: 15
+//	        output: {kind: kiosk_chain}
+//	    replace_filters:
+//	      "210": { ... }
+//	    remove_filters: [kiosk_chain, "kind:zoo"]
+//	    add_transforms: [ ... ]
+//	    remove_transforms: [vectordatasource.transform.add_uic_ref]
+//	add_layers:
+//	  - name: trees
+//	    geometry_types: [Point]
+//	    filters: [ ... ]
+//	add_post_process:
+//	  - fn: vectordatasource.transform.drop_properties
+//	    params: { ... }
+//	remove_post_process:
+//	  - fn: vectordatasource.transform.merge_line_features
+//	    layer: buildings
+//	  - index: 12
+//
+// Filters are identified by their `id`, if set, by the constant kind they
+// output using `kind:<kind>`, or their index in the layer before the overlay
+// is applied, as listed by osmzen-kinds. It is an error if the id or kind
+// match more than one filter.
+type Overlay struct {
+	Layers            map[string]*LayerOverlay `yaml:"layers"`
+	AddLayers         []*OverlayLayer          `yaml:"add_layers"`
+	AddPostProcess    []*postprocess.Config    `yaml:"add_post_process"`
+	RemovePostProcess []*PostProcessRef        `yaml:"remove_post_process"`
+
+	asset func(string) ([]byte, error)
+}
+
+// LayerOverlay defines the changes to an existing layer.
+type LayerOverlay struct {
+	PrependFilters   []*filter.Filter          `yaml:"prepend_filters"`
+	AppendFilters    []*filter.Filter          `yaml:"append_filters"`
+	ReplaceFilters   map[string]*filter.Filter `yaml:"replace_filters"`
+	RemoveFilters    []string                  `yaml:"remove_filters"`
+	AddTransforms    []string                  `yaml:"add_transforms"`
+	RemoveTransforms []string                  `yaml:"remove_transforms"`
+}
+
+// PostProcessRef identifies one post process of the config, by its index
+// in the config before the overlay is applied, or by its function and
+// optionally the layer it applies to. It is an error if the function and
+// layer match more than one post process.
+type PostProcessRef struct {
+	Index *int   `yaml:"index"`
+	Func  string `yaml:"fn"`
+	Layer string `yaml:"layer"`
+}
+
+// OverlayLayer defines a new layer added by an overlay.
+type OverlayLayer struct {
+	Name    string `yaml:"name"`
+	Layer   `yaml:",inline"`
+	Filters []*filter.Filter `yaml:"filters"`
+}
+
+// LoadOverlay loads+compiles the overlay file at the path in the file system.
+// Post process resources are read relative to its directory.
+func LoadOverlay(fsys fs.FS, filename string) (*Overlay, error) {
+	data, err := fs.ReadFile(fsys, filename)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to read overlay")
+	}
+
+	o := &Overlay{}
+	err = yaml.Unmarshal(data, &o)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to unmarshal")
+	}
+	o.asset = fsAsset(fsys, filename)
+
+	for name, lo := range o.Layers {
+		if lo == nil {
+			return nil, errors.Errorf("layer %s: no changes defined", name)
+		}
+
+		err := compileFilters("prepend filter", lo.PrependFilters)
+		if err == nil {
+			err = compileFilters("append filter", lo.AppendFilters)
+		}
+		if err != nil {
+			return nil, errors.WithMessage(err, "layer "+name)
+		}
+
+		for id, f := range lo.ReplaceFilters {
+			if f == nil {
+				return nil, errors.Errorf("layer %s: replace filter %s: undefined, use remove_filters", name, id)
+			}
+
+			if err := f.Compile(); err != nil {
+				return nil, errors.WithMessage(err, fmt.Sprintf("layer %s: replace filter %s", name, id))
+			}
+		}
+	}
+
+	for i, nl := range o.AddLayers {
+		if nl == nil || nl.Name == "" {
+			return nil, errors.Errorf("add layer %d: name required", i)
+		}
+
+		if err := compileFilters("filter", nl.Filters); err != nil {
+			return nil, errors.WithMessage(err, "add layer "+nl.Name)
+		}
+	}
+
+	for i, p := range o.AddPostProcess {
+		if p == nil {
+			return nil, errors.Errorf("add post process %d: undefined", i)
+		}
+	}
+
+	for i, r := range o.RemovePostProcess {
+		if r == nil || (r.Index == nil && r.Func == "") {
+			return nil, errors.Errorf("remove post process %d: index or fn required", i)
+		}
+
+		if r.Index != nil && (r.Func != "" || r.Layer != "") {
+			return nil, errors.Errorf("remove post process %d: only one of index or fn allowed", i)
+		}
+	}
+
+	return o, nil
+}
+
+func compileFilters(what string, filters []*filter.Filter) error {
+	for i, f := range filters {
+		if f == nil {
+			return errors.Errorf("%s %d: undefined", what, i)
+		}
+
+		if err := f.Compile(); err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("%s %d", what, i))
+		}
+	}
+
+	return nil
+}
+
+// ApplyOverlay applies the overlay to the config. All the changes are
+// validated first, so on error the config is left unchanged. Overlays
+// are applied in order, each one on the result of the previous.
+func (c *Config) ApplyOverlay(o *Overlay) error {
+	names := make([]string, 0, len(o.Layers))
+	for name := range o.Layers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	changed := make(map[string]*Layer, len(names))
+	for _, name := range names {
+		l := c.Layers[name]
+		if l == nil {
+			return errors.Errorf("layer %s: not defined, use add_layers for new layers", name)
+		}
+
+		nl, err := l.overlay(o.Layers[name])
+		if err != nil {
+			return errors.WithMessage(err, "layer "+name)
+		}
+		changed[name] = nl
+	}
+
+	added := make(map[string]*Layer, len(o.AddLayers))
+	for _, ol := range o.AddLayers {
+		if c.Layers[ol.Name] != nil || added[ol.Name] != nil {
+			return errors.Errorf("add layer %s: already defined", ol.Name)
+		}
+
+		nl := ol.Layer
+		nl.filters = ol.Filters
+		if err := checkFilterIDs(nl.filters); err != nil {
+			return errors.WithMessage(err, "add layer "+ol.Name)
+		}
+
+		if err := nl.compile(); err != nil {
+			return errors.WithMessage(err, "add layer "+ol.Name)
+		}
+		added[ol.Name] = &nl
+	}
+
+	postProcess, postProcessors, err := c.overlayPostProcess(o)
+	if err != nil {
+		return err
+	}
+
+	// everything is valid, update the config
+	for name, nl := range changed {
+		*c.Layers[name] = *nl
+	}
+
+	for _, ol := range o.AddLayers {
+		c.All = append(c.All, ol.Name)
+		c.Layers[ol.Name] = added[ol.Name]
+		c.clipFactors[ol.Name] = ol.ClipFactor
+	}
+
+	c.PostProcess = postProcess
+	c.postProcessors = postProcessors
+
+	return nil
+}
+
+// overlay returns a copy of the layer with the overlay changes applied.
+func (l *Layer) overlay(lo *LayerOverlay) (*Layer, error) {
+	nl := *l
+
+	var err error
+	nl.filters, err = overlayFilters(l.filters, lo)
+	if err != nil {
+		return nil, err
+	}
+
+	nl.Transforms = append([]string(nil), l.Transforms...)
+	for _, t := range lo.RemoveTransforms {
+		i := transformIndex(nl.Transforms, t)
+		if i == -1 {
+			return nil, errors.Errorf("remove transform %s: not defined", t)
+		}
+		nl.Transforms = append(nl.Transforms[:i], nl.Transforms[i+1:]...)
+	}
+
+	for _, t := range lo.AddTransforms {
+		if transformIndex(nl.Transforms, t) != -1 {
+			return nil, errors.Errorf("add transform %s: already defined", t)
+		}
+		nl.Transforms = append(nl.Transforms, t)
+	}
+
+	if err := nl.compile(); err != nil {
+		return nil, err
+	}
+
+	return &nl, nil
+}
+
+func overlayFilters(filters []*filter.Filter, lo *LayerOverlay) ([]*filter.Filter, error) {
+	result := append([]*filter.Filter(nil), filters...)
+	removed := make([]bool, len(filters))
+	replaced := make([]bool, len(filters))
+
+	for _, id := range lo.RemoveFilters {
+		i, err := filterIndex(filters, id)
+		if err != nil {
+			return nil, errors.WithMessage(err, "remove filter")
+		}
+		removed[i] = true
+	}
+
+	ids := make([]string, 0, len(lo.ReplaceFilters))
+	for id := range lo.ReplaceFilters {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		i, err := filterIndex(filters, id)
+		if err != nil {
+			return nil, errors.WithMessage(err, "replace filter")
+		}
+
+		if removed[i] {
+			return nil, errors.Errorf("replace filter %s: also removed", id)
+		}
+
+		if replaced[i] {
+			return nil, errors.Errorf("replace filter %s: replaced more than once", id)
+		}
+
+		replaced[i] = true
+		result[i] = lo.ReplaceFilters[id]
+	}
+
+	kept := make([]*filter.Filter, 0, len(lo.PrependFilters)+len(result)+len(lo.AppendFilters))
+	kept = append(kept, lo.PrependFilters...)
+	for i, f := range result {
+		if !removed[i] {
+			kept = append(kept, f)
+		}
+	}
+	kept = append(kept, lo.AppendFilters...)
+
+	if err := checkFilterIDs(kept); err != nil {
+		return nil, err
+	}
+
+	return kept, nil
+}
+
+// filterIndex finds the filter by its id, the kind it outputs, using
+// "kind:<kind>", or its index if no filter has the id.
+func filterIndex(filters []*filter.Filter, id string) (int, error) {
+	index := -1
+	for i, f := range filters {
+		if f.ID != id {
+			continue
+		}
+
+		if index != -1 {
+			return 0, errors.Errorf("%s: id is not unique", id)
+		}
+		index = i
+	}
+
+	if index != -1 {
+		return index, nil
+	}
+
+	if kind := strings.TrimPrefix(id, "kind:"); kind != id {
+		var matches []int
+		for i, f := range filters {
+			if k, ok := f.RawOutput["kind"].(string); ok && k == kind {
+				matches = append(matches, i)
+			}
+		}
+
+		switch len(matches) {
+		case 0:
+			return 0, errors.Errorf("%s: not found", id)
+		case 1:
+			return matches[0], nil
+		default:
+			return 0, errors.Errorf("%s: matches filters %v, use the index", id, matches)
+		}
+	}
+
+	i, err := strconv.Atoi(id)
+	if err != nil || i < 0 || i >= len(filters) {
+		return 0, errors.Errorf("%s: not found", id)
+	}
+
+	return i, nil
+}
+
+func checkFilterIDs(filters []*filter.Filter) error {
+	seen := make(map[string]bool, len(filters))
+	for _, f := range filters {
+		if f.ID == "" {
+			continue
+		}
+
+		if seen[f.ID] {
+			return errors.Errorf("filter id %s: defined more than once", f.ID)
+		}
+		seen[f.ID] = true
+	}
+
+	return nil
+}
+
+func transformIndex(transforms []string, name string) int {
+	name = strings.TrimPrefix(name, "vectordatasource.transform.")
+	for i, t := range transforms {
+		if strings.TrimPrefix(t, "vectordatasource.transform.") == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// overlayPostProcess returns the post process config and functions
+// with the overlay changes applied.
+func (c *Config) overlayPostProcess(o *Overlay) ([]*postprocess.Config, []postprocess.Function, error) {
+	removed := make([]bool, len(c.PostProcess))
+	for _, r := range o.RemovePostProcess {
+		i, err := postProcessIndex(c.PostProcess, r)
+		if err != nil {
+			return nil, nil, errors.WithMessage(err, "remove post process")
+		}
+
+		if removed[i] {
+			return nil, nil, errors.Errorf("remove post process %d: removed more than once", i)
+		}
+		removed[i] = true
+	}
+
+	configs := make([]*postprocess.Config, 0, len(c.PostProcess)+len(o.AddPostProcess))
+	functions := make([]postprocess.Function, 0, len(c.PostProcess)+len(o.AddPostProcess))
+	for i, p := range c.PostProcess {
+		if !removed[i] {
+			configs = append(configs, p)
+			functions = append(functions, c.postProcessors[i])
+		}
+	}
+
+	if len(o.AddPostProcess) == 0 {
+		return configs, functions, nil
+	}
+
+	// The clip factors of the new layers are needed to compile the
+	// post processors. The map is shared with the existing post processors
+	// so the values are removed again if something fails.
+	for _, ol := range o.AddLayers {
+		c.clipFactors[ol.Name] = ol.ClipFactor
+	}
+
+	ppctx := &postprocess.CompileContext{
+		Asset:       o.asset,
+		ClipFactors: c.clipFactors,
+	}
+	for i, p := range o.AddPostProcess {
+		f, err := postprocess.Compile(ppctx, p)
+		if err != nil {
+			for _, ol := range o.AddLayers {
+				delete(c.clipFactors, ol.Name)
+			}
+			return nil, nil, errors.WithMessage(err, fmt.Sprintf("add post process %d", i))
+		}
+
+		configs = append(configs, p)
+		functions = append(functions, f)
+	}
+
+	return configs, functions, nil
+}
+
+// postProcessIndex finds the post process by its index, or its function
+// and layer. The layer is matched against the source_layer, layer and
+// base_layer params.
+func postProcessIndex(configs []*postprocess.Config, r *PostProcessRef) (int, error) {
+	if r.Index != nil {
+		if *r.Index < 0 || *r.Index >= len(configs) {
+			return 0, errors.Errorf("%d: not defined", *r.Index)
+		}
+
+		return *r.Index, nil
+	}
+
+	fn := strings.TrimPrefix(r.Func, "vectordatasource.transform.")
+	name := fn
+	if r.Layer != "" {
+		name += " " + r.Layer
+	}
+
+	var matches []int
+	for i, p := range configs {
+		if strings.TrimPrefix(p.Func, "vectordatasource.transform.") != fn {
+			continue
+		}
+
+		if r.Layer != "" && postProcessLayer(p) != r.Layer {
+			continue
+		}
+
+		matches = append(matches, i)
+	}
+
+	switch len(matches) {
+	case 0:
+		return 0, errors.Errorf("%s: not defined", name)
+	case 1:
+		return matches[0], nil
+	default:
+		return 0, errors.Errorf("%s: matches post processes %v, use the layer or index", name, matches)
+	}
+}
+
+func postProcessLayer(p *postprocess.Config) string {
+	for _, k := range []string{"source_layer", "layer", "base_layer"} {
+		if l, ok := p.Params[k].(string); ok {
+			return l
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,405 @@
+package osmzen
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/paulmach/osm"
+)
+
+func TestLoadFS(t *testing.T) {
+	config, err := LoadFS(DefaultConfig, "config/queries.yaml")
+	if err != nil {
+		t.Fatalf("unable to load config: %v", err)
+	}
+
+	if config.Layers["pois"] == nil {
+		t.Errorf("pois layer not loaded")
+	}
+
+	_, err = LoadFS(fstest.MapFS{}, "queries.yaml")
+	if err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
+
+func TestConfigApplyOverlay(t *testing.T) {
+	kiosk := &osm.Node{
+		ID:  1,
+		Lat: 1, Lon: 1,
+		Tags: osm.Tags{
+			{Key: "shop", Value: "kiosk"},
+			{Key: "brand", Value: "Kiosko"},
+			{Key: "name", Value: "Kiosko"},
+		},
+	}
+
+	tree := &osm.Node{
+		ID:  2,
+		Lat: 1, Lon: 1,
+		Tags: osm.Tags{
+			{Key: "natural", Value: "tree"},
+			{Key: "species", Value: "Quercus robur"},
+		},
+	}
+
+	fsys := fstest.MapFS{
+		"overlays/pois.yaml": &fstest.MapFile{Data: []byte(`
+layers:
+  pois:
+    prepend_filters:
+      - id: kiosk_chain
+        filter: {shop: kiosk, brand: true}
+        min_zoom: 15
+        output: {kind: kiosk_chain}
+add_layers:
+  - name: trees
+    geometry_types: [Point]
+    filters:
+      - filter: {natural: tree}
+        min_zoom: 16
+        output: {kind: tree, species: {col: species}}
+remove_post_process:
+  - fn: vectordatasource.transform.build_fence
+`)},
+		"overlays/remove.yaml": &fstest.MapFile{Data: []byte(`
+layers:
+  pois:
+    remove_filters: [kiosk_chain]
+`)},
+	}
+
+	config, err := LoadDefaultConfig()
+	if err != nil {
+		t.Fatalf("unable to load config: %v", err)
+	}
+
+	filters := len(config.Layers["pois"].filters)
+	postProcess := len(config.PostProcess)
+
+	overlay, err := LoadOverlay(fsys, "overlays/pois.yaml")
+	if err != nil {
+		t.Fatalf("unable to load overlay: %v", err)
+	}
+
+	if err := config.ApplyOverlay(overlay); err != nil {
+		t.Fatalf("unable to apply overlay: %v", err)
+	}
+
+	if l := len(config.Layers["pois"].filters); l != filters+1 {
+		t.Errorf("incorrect number of filters: %v != %v", l, filters+1)
+	}
+
+	if l := len(config.PostProcess); l != postProcess-1 {
+		t.Errorf("post process not removed: %v != %v", l, postProcess-1)
+	}
+
+	if l := len(config.postProcessors); l != postProcess-1 {
+		t.Errorf("post process function not removed: %v != %v", l, postProcess-1)
+	}
+
+	for _, p := range config.PostProcess {
+		if p.Func == "vectordatasource.transform.build_fence" {
+			t.Errorf("post process not removed")
+		}
+	}
+
+	if config.All[len(config.All)-1] != "trees" {
+		t.Errorf("new layer not added: %v", config.All)
+	}
+
+	layer, props, err := config.ProcessElement(kiosk)
+	if err != nil {
+		t.Fatalf("process error: %v", err)
+	}
+
+	if layer != "pois" || props["kind"] != "kiosk_chain" {
+		t.Errorf("incorrect kiosk: %v %v", layer, props)
+	}
+
+	layers, err := config.ProcessElementAll(tree, nil)
+	if err != nil {
+		t.Fatalf("process error: %v", err)
+	}
+
+	found := false
+	for _, l := range layers {
+		if l.Layer == "trees" {
+			found = true
+			if l.Properties["species"] != "Quercus robur" {
+				t.Errorf("incorrect tree properties: %v", l.Properties)
+			}
+		}
+	}
+
+	if !found {
+		t.Errorf("tree not in new layer")
+	}
+
+	// the second overlay can remove filters by id added in the first
+	overlay, err = LoadOverlay(fsys, "overlays/remove.yaml")
+	if err != nil {
+		t.Fatalf("unable to load overlay: %v", err)
+	}
+
+	if err := config.ApplyOverlay(overlay); err != nil {
+		t.Fatalf("unable to apply overlay: %v", err)
+	}
+
+	_, props, err = config.ProcessElement(kiosk)
+	if err != nil {
+		t.Fatalf("process error: %v", err)
+	}
+
+	if props["kind"] != "shop" {
+		t.Errorf("filter not removed: %v", props)
+	}
+}
+
+func TestConfigApplyOverlay_targets(t *testing.T) {
+	zoo := &osm.Node{
+		ID:  1,
+		Lat: 1, Lon: 1,
+		Tags: osm.Tags{
+			{Key: "tourism", Value: "zoo"},
+			{Key: "name", Value: "Zoo"},
+		},
+	}
+
+	fsys := fstest.MapFS{
+		"overlay.yaml": &fstest.MapFile{Data: []byte(`
+layers:
+  pois:
+    replace_filters:
+      "kind:zoo": {filter: {tourism: zoo}, min_zoom: 15, output: {kind: animal_park}}
+remove_post_process:
+  - {fn: vectordatasource.transform.palettize_colours, layer: transit}
+`)},
+	}
+
+	config, err := LoadDefaultConfig()
+	if err != nil {
+		t.Fatalf("unable to load config: %v", err)
+	}
+
+	palettize := func() (total, transit int) {
+		for _, p := range config.PostProcess {
+			if p.Func == "vectordatasource.transform.palettize_colours" {
+				total++
+				if postProcessLayer(p) == "transit" {
+					transit++
+				}
+			}
+		}
+
+		return total, transit
+	}
+
+	total, transit := palettize()
+	if transit != 1 {
+		t.Fatalf("expected one transit palettize_colours: %v", transit)
+	}
+
+	overlay, err := LoadOverlay(fsys, "overlay.yaml")
+	if err != nil {
+		t.Fatalf("unable to load overlay: %v", err)
+	}
+
+	if err := config.ApplyOverlay(overlay); err != nil {
+		t.Fatalf("unable to apply overlay: %v", err)
+	}
+
+	if tl, tr := palettize(); tl != total-1 || tr != 0 {
+		t.Errorf("should only remove the transit palettize_colours: %v %v", tl, tr)
+	}
+
+	_, props, err := config.ProcessElement(zoo)
+	if err != nil {
+		t.Fatalf("process error: %v", err)
+	}
+
+	if props["kind"] != "animal_park" {
+		t.Errorf("filter not replaced: %v", props)
+	}
+}
+
+func TestConfigApplyOverlay_errors(t *testing.T) {
+	cases := []struct {
+		name    string
+		overlay string
+		err     string
+	}{
+		{
+			name: "undefined layer",
+			overlay: `
+layers:
+  trees:
+    remove_filters: ["0"]`,
+			err: "layer trees: not defined",
+		},
+		{
+			name: "layer already defined",
+			overlay: `
+add_layers:
+  - name: pois`,
+			err: "add layer pois: already defined",
+		},
+		{
+			name: "unknown filter id",
+			overlay: `
+layers:
+  pois:
+    remove_filters: [missing]`,
+			err: "layer pois: remove filter: missing: not found",
+		},
+		{
+			name: "filter index out of range",
+			overlay: `
+layers:
+  pois:
+    replace_filters:
+      "100000": {filter: {shop: kiosk}, min_zoom: 15, output: {kind: kiosk}}`,
+			err: "layer pois: replace filter: 100000: not found",
+		},
+		{
+			name: "replaced and removed",
+			overlay: `
+layers:
+  pois:
+    remove_filters: ["0"]
+    replace_filters:
+      "0": {filter: {shop: kiosk}, min_zoom: 15, output: {kind: kiosk}}`,
+			err: "layer pois: replace filter 0: also removed",
+		},
+		{
+			name: "duplicate id",
+			overlay: `
+layers:
+  pois:
+    prepend_filters:
+      - {id: kiosk, filter: {shop: kiosk}, min_zoom: 15, output: {kind: kiosk}}
+    append_filters:
+      - {id: kiosk, filter: {shop: kiosk}, min_zoom: 15, output: {kind: kiosk}}`,
+			err: "layer pois: filter id kiosk: defined more than once",
+		},
+		{
+			name: "transform already defined",
+			overlay: `
+layers:
+  pois:
+    add_transforms: [tags_name_i18n]`,
+			err: "layer pois: add transform tags_name_i18n: already defined",
+		},
+		{
+			name: "undefined transform",
+			overlay: `
+layers:
+  pois:
+    add_transforms: [make_it_pretty]`,
+			err: "layer pois: transform undefined: make_it_pretty",
+		},
+		{
+			name: "undefined sort",
+			overlay: `
+add_layers:
+  - name: trees
+    sort: vectordatasource.sort.trees`,
+			err: "add layer trees: sort undefined: vectordatasource.sort.trees",
+		},
+		{
+			name: "remove undefined post process",
+			overlay: `
+remove_post_process: [{fn: make_it_pretty}]`,
+			err: "remove post process: make_it_pretty: not defined",
+		},
+		{
+			name: "remove ambiguous post process",
+			overlay: `
+remove_post_process: [{fn: vectordatasource.transform.drop_properties}]`,
+			err: "remove post process: drop_properties: matches post processes",
+		},
+		{
+			name: "remove ambiguous post process for layer",
+			overlay: `
+remove_post_process: [{fn: drop_properties, layer: roads}]`,
+			err: "remove post process: drop_properties roads: matches post processes",
+		},
+		{
+			name: "remove post process twice",
+			overlay: `
+remove_post_process: [{fn: build_fence}, {index: 0}, {index: 0}]`,
+			err: "remove post process 0: removed more than once",
+		},
+		{
+			name: "remove post process index out of range",
+			overlay: `
+remove_post_process: [{index: 10000}]`,
+			err: "remove post process: 10000: not defined",
+		},
+		{
+			name: "ambiguous kind",
+			overlay: `
+layers:
+  pois:
+    remove_filters: ["kind:forest"]`,
+			err: "layer pois: remove filter: kind:forest: matches filters",
+		},
+		{
+			name: "undefined kind",
+			overlay: `
+layers:
+  pois:
+    remove_filters: ["kind:make_it_pretty"]`,
+			err: "layer pois: remove filter: kind:make_it_pretty: not found",
+		},
+		{
+			name: "invalid post process",
+			overlay: `
+add_layers:
+  - name: trees
+add_post_process:
+  - fn: vectordatasource.transform.make_it_pretty`,
+			err: "add post process 0",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := LoadDefaultConfig()
+			if err != nil {
+				t.Fatalf("unable to load config: %v", err)
+			}
+
+			fsys := fstest.MapFS{
+				"overlay.yaml": &fstest.MapFile{Data: []byte(tc.overlay)},
+			}
+
+			overlay, err := LoadOverlay(fsys, "overlay.yaml")
+			if err != nil {
+				t.Fatalf("unable to load overlay: %v", err)
+			}
+
+			filters := len(config.Layers["pois"].filters)
+			layers := len(config.All)
+
+			err = config.ApplyOverlay(overlay)
+			if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+				t.Errorf("incorrect error: %v", err)
+			}
+
+			// config should not be changed
+			if l := len(config.Layers["pois"].filters); l != filters {
+				t.Errorf("filters changed: %v != %v", l, filters)
+			}
+
+			if l := len(config.All); l != layers {
+				t.Errorf("layers changed: %v != %v", l, layers)
+			}
+
+			if _, ok := config.clipFactors["trees"]; ok {
+				t.Errorf("clip factors changed")
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package postprocess
+
+import (
+	"sort"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/clip"
+	"github.com/paulmach/orb/geojson"
+	"github.com/pkg/errors"
+)
+
+// Some polygons in the base layer have a barrier tag. This includes
+// landuse areas with an extra `barrier=fence` as well as fences, walls
+// and hedges mapped as closed areas. In those cases we want line features
+// for the edges of the polygon so they render like any other barrier.
+//
+// Only the properties in the prop_transform, like `kind`, are copied to
+// the new line and the barrier value, e.g. `fence`, is in the `barrier`
+// property. Polygons that are themselves the barrier, i.e. the kind matches
+// the barrier value, are replaced by the lines. Otherwise the polygon is kept
+// without the `barrier` property.
+type buildFence struct {
+	Layer       string
+	OutputLayer string
+	StartZoom   float64
+	Properties  []string
+}
+
+func (f *buildFence) Eval(ctx *Context, layers map[string]*geojson.FeatureCollection) {
+	if ctx.Zoom < f.StartZoom {
+		return
+	}
+
+	layer := layers[f.Layer]
+	if layer == nil {
+		return
+	}
+
+	var fences []*geojson.Feature
+
+	at := 0
+	for _, feature := range layer.Features {
+		barrier, _ := feature.Properties["barrier"].(string)
+		if barrier == "" || !isPolygonal(feature.Geometry) {
+			layer.Features[at] = feature
+			at++
+			continue
+		}
+
+		kind, _ := feature.Properties["kind"].(string)
+		if kind != barrier {
+			// keep landuse areas, the barrier is just around the edge.
+			delete(feature.Properties, "barrier")
+			layer.Features[at] = feature
+			at++
+		}
+
+		// clip uses the input as scratch space and the rings are shared
+		// with the polygon, so a copy is clipped.
+		lines := clip.Geometry(ctx.Bound, polygonBoundary(feature.Geometry).Clone())
+		if lines == nil {
+			continue
+		}
+
+		fence := geojson.NewFeature(lines)
+		for _, p := range f.Properties {
+			if v, ok := feature.Properties[p]; ok {
+				fence.Properties[p] = v
+			}
+		}
+		fence.Properties["barrier"] = barrier
+
+		// keep around so other post processors work as expected.
+		if t, ok := feature.Properties["type"]; ok {
+			fence.Properties["type"] = t
+		}
+		if t, ok := feature.Properties["tags"]; ok {
+			fence.Properties["tags"] = t
+		}
+
+		fences = append(fences, fence)
+	}
+
+	layer.Features = layer.Features[:at]
+
+	if len(fences) == 0 {
+		return
+	}
+
+	output := layers[f.OutputLayer]
+	if output == nil {
+		output = geojson.NewFeatureCollection()
+		layers[f.OutputLayer] = output
+	}
+	output.Features = append(output.Features, fences...)
+}
+
+// polygonBoundary returns all the rings of the polygon as a multi line string.
+func polygonBoundary(g orb.Geometry) orb.MultiLineString {
+	var result orb.MultiLineString
+	switch g := g.(type) {
+	case orb.Polygon:
+		for _, r := range g {
+			result = append(result, orb.LineString(r))
+		}
+	case orb.MultiPolygon:
+		for _, p := range g {
+			for _, r := range p {
+				result = append(result, orb.LineString(r))
+			}
+		}
+	}
+
+	return result
+}
+
+func compileBuildFence(ctx *CompileContext, c *Config) (Function, error) {
+	f := &buildFence{StartZoom: 16}
+
+	var ok bool
+	if f.Layer, ok = c.Params["base_layer"].(string); !ok {
+		return nil, errors.New("build_fence: base_layer must be defined")
+	}
+
+	f.OutputLayer = f.Layer
+	if l, ok := c.Params["output_layer"]; ok {
+		if f.OutputLayer, ok = l.(string); !ok {
+			return nil, errors.New("build_fence: output_layer must be a string")
+		}
+	}
+
+	zs, ok := c.Params["start_zoom"]
+	if ok {
+		z, ok := zs.(int)
+		if !ok {
+			return nil, errors.New("build_fence: start_zoom must be an integer")
+		}
+
+		f.StartZoom = float64(z)
+	}
+
+	pt, ok := c.Params["prop_transform"].(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("build_fence: prop_transform must be a map")
+	}
+
+	for k, v := range pt {
+		name, ok := k.(string)
+		if !ok {
+			return nil, errors.Errorf("build_fence: prop_transform key must be a string: %v", k)
+		}
+
+		if keep, ok := v.(bool); ok && keep {
+			f.Properties = append(f.Properties, name)
+		}
+	}
+	sort.Strings(f.Properties)
+
+	return f, nil
+}
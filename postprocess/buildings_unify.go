@@ -0,0 +1,212 @@
+package postprocess
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/planar"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+// Unify buildings with their parts. Building parts will get a `root_id`
+// property with the id of the building they are associated with.
+// Parts that are members of a `type=building` relation are linked to
+// the relation's outline, otherwise the smallest building containing
+// the part is used.
+type buildingsUnify struct {
+	Layer     string
+	StartZoom float64
+}
+
+func (f *buildingsUnify) Eval(ctx *Context, layers map[string]*geojson.FeatureCollection) {
+	if ctx.Zoom < f.StartZoom {
+		return
+	}
+
+	layer := layers[f.Layer]
+	if layer == nil {
+		return
+	}
+
+	var buildings, parts []*geojson.Feature
+	for _, feature := range layer.Features {
+		switch feature.Properties["kind"] {
+		case "building":
+			if _, ok := feature.Properties["id"]; ok && isPolygonal(feature.Geometry) {
+				buildings = append(buildings, feature)
+			}
+		case "building_part":
+			parts = append(parts, feature)
+		}
+	}
+
+	if len(parts) == 0 {
+		return
+	}
+
+	bounds := make([]orb.Bound, len(buildings))
+	areas := make([]float64, len(buildings))
+	for i, b := range buildings {
+		bounds[i] = b.Geometry.Bound()
+		areas[i] = planar.Area(b.Geometry)
+	}
+
+	for _, part := range parts {
+		if rootID, ok := relationRootID(ctx, part); ok {
+			part.Properties["root_id"] = rootID
+			continue
+		}
+
+		points := outerPoints(part.Geometry)
+		if len(points) == 0 {
+			continue
+		}
+
+		pbound := part.Geometry.Bound()
+
+		best := -1
+		for i, b := range buildings {
+			if !bounds[i].Contains(pbound.Min) || !bounds[i].Contains(pbound.Max) {
+				continue
+			}
+
+			if !containsAll(b.Geometry, points) {
+				continue
+			}
+
+			if best == -1 || areas[i] < areas[best] {
+				best = i
+			}
+		}
+
+		if best == -1 {
+			// a part can stick out of its building a little, so try
+			// to find a building that contains the part's centroid.
+			c, _ := planar.CentroidArea(part.Geometry)
+			for i, b := range buildings {
+				if !bounds[i].Contains(c) || !containsAll(b.Geometry, []orb.Point{c}) {
+					continue
+				}
+
+				if best == -1 || areas[i] < areas[best] {
+					best = i
+				}
+			}
+		}
+
+		if best != -1 {
+			part.Properties["root_id"] = buildings[best].Properties["id"]
+		}
+	}
+}
+
+// relationRootID returns the root id of the part if it is a member
+// of a `type=building` relation. If the relation has an `outline`
+// member, that id is used, otherwise the relation id.
+func relationRootID(ctx *Context, part *geojson.Feature) (int, bool) {
+	if ctx.RelationMembership == nil {
+		return 0, false
+	}
+
+	id := part.Properties.MustInt("id", 0)
+	if id == 0 {
+		return 0, false
+	}
+
+	var fid osm.FeatureID
+	switch part.Properties.MustString("type", "") {
+	case "way":
+		fid = osm.WayID(id).FeatureID()
+	case "relation":
+		// relation ids are negated in the output
+		fid = osm.RelationID(-id).FeatureID()
+	default:
+		return 0, false
+	}
+
+	for _, r := range ctx.RelationMembership[fid] {
+		if r.Tags.Find("type") != "building" {
+			continue
+		}
+
+		for _, m := range r.Members {
+			if m.Role != "outline" {
+				continue
+			}
+
+			switch m.Type {
+			case osm.TypeWay:
+				return int(m.Ref), true
+			case osm.TypeRelation:
+				return -int(m.Ref), true
+			}
+		}
+
+		return -int(r.ID), true
+	}
+
+	return 0, false
+}
+
+// outerPoints returns the points of the outer rings of the polygonal geometry.
+func outerPoints(g orb.Geometry) []orb.Point {
+	switch g := g.(type) {
+	case orb.Polygon:
+		if len(g) == 0 {
+			return nil
+		}
+		return g[0]
+	case orb.MultiPolygon:
+		var points []orb.Point
+		for _, p := range g {
+			if len(p) > 0 {
+				points = append(points, p[0]...)
+			}
+		}
+		return points
+	}
+
+	return nil
+}
+
+// containsAll returns true if all the points are within the polygonal
+// geometry. Points on the boundary are considered inside.
+func containsAll(g orb.Geometry, points []orb.Point) bool {
+	for _, p := range points {
+		switch g := g.(type) {
+		case orb.Polygon:
+			if !planar.PolygonContains(g, p) {
+				return false
+			}
+		case orb.MultiPolygon:
+			if !planar.MultiPolygonContains(g, p) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func compileBuildingsUnify(ctx *CompileContext, c *Config) (Function, error) {
+	f := &buildingsUnify{}
+
+	var ok bool
+	if f.Layer, ok = c.Params["source_layer"].(string); !ok {
+		return nil, errors.New("buildings_unify: source_layer must be defined")
+	}
+
+	zs, ok := c.Params["start_zoom"]
+	if ok {
+		z, ok := zs.(int)
+		if !ok {
+			return nil, errors.New("buildings_unify: start_zoom must be an integer")
+		}
+
+		f.StartZoom = float64(z)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,460 @@
+package postprocess
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// A CountryResolver returns the ISO 3166-1 alpha-2 country code,
+// e.g. "US", for a location. It should return an empty string if the
+// country is unknown. It can be implemented using a local file of
+// admin polygons or any other lookup the caller has available.
+type CountryResolver interface {
+	CountryCode(p orb.Point) string
+}
+
+// CountryResolverFunc is an adapter to allow the use of ordinary
+// functions as country resolvers.
+type CountryResolverFunc func(orb.Point) string
+
+// CountryCode calls f(p).
+func (f CountryResolverFunc) CountryCode(p orb.Point) string {
+	return f(p)
+}
+
+// featureCountryCode returns the country of the feature. If no resolver
+// is provided, or it doesn't know, the country is guessed from the
+// network prefix, e.g. `US:I`, the operator or the ref prefix of the road.
+func featureCountryCode(ctx *Context, feature *geojson.Feature) string {
+	if ctx.CountryResolver != nil && feature.Geometry != nil {
+		if cc := ctx.CountryResolver.CountryCode(representativePoint(feature.Geometry)); cc != "" {
+			return strings.ToUpper(cc)
+		}
+	}
+
+	if cc := networkCountryCode(feature.Properties.MustString("network", "")); cc != "" {
+		return cc
+	}
+
+	mzNetworks, _ := feature.Properties["mz_networks"].([]string)
+	for i := 0; i+2 < len(mzNetworks); i += 3 {
+		if mzNetworks[i] != "road" {
+			continue
+		}
+
+		if cc := networkCountryCode(mzNetworks[i+1]); cc != "" {
+			return cc
+		}
+	}
+
+	if cc := networkOperators[feature.Properties.MustString("operator", "")]; cc != "" {
+		return cc
+	}
+
+	if cc := refCountryCode(feature.Properties.MustString("ref", "")); cc != "" {
+		return cc
+	}
+
+	for i := 0; i+2 < len(mzNetworks); i += 3 {
+		if mzNetworks[i] != "road" {
+			continue
+		}
+
+		if cc := refCountryCode(mzNetworks[i+2]); cc != "" {
+			return cc
+		}
+	}
+
+	return ""
+}
+
+// refPrefixCountries are the ref prefixes only used in one country.
+// Prefixes like `A` or `M` are used in many countries so they
+// can't be used to guess the country.
+var refPrefixCountries = map[string]string{
+	"BR": "BR",
+	"I":  "US",
+	"US": "US",
+}
+
+// refCountryCode returns the country of the ref prefix,
+// e.g. `US` for `I 95` or `BR` for `BR-101`.
+func refCountryCode(ref string) string {
+	if ref == "" {
+		return ""
+	}
+
+	prefix, _ := splitRef(ref)
+	return refPrefixCountries[prefix]
+}
+
+// networkCountryCode returns the country code prefix of the network,
+// e.g. `US` for `US:I` or `GB` for `GB`.
+func networkCountryCode(network string) string {
+	if len(network) == 2 && isLetters(network) {
+		return strings.ToUpper(network)
+	}
+
+	matches := countryCode.FindStringSubmatch(network)
+	if len(matches) == 0 {
+		return ""
+	}
+
+	return strings.ToUpper(matches[1])
+}
+
+func isLetters(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || 'z' < r) && (r < 'A' || 'Z' < r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// representativePoint returns a point on, or near, the geometry
+// to use for looking up the country.
+func representativePoint(g orb.Geometry) orb.Point {
+	switch g := g.(type) {
+	case orb.Point:
+		return g
+	case orb.LineString:
+		if len(g) > 0 {
+			return g[len(g)/2]
+		}
+	case orb.MultiLineString:
+		if len(g) > 0 && len(g[0]) > 0 {
+			return g[0][len(g[0])/2]
+		}
+	}
+
+	return g.Bound().Center()
+}
+
+// countryNetworkFixup normalizes the network and ref of a road in a
+// specific country. The network can be empty if it is unknown, the
+// country specific function will try to figure it out from the ref.
+type countryNetworkFixup func(props geojson.Properties, network, ref string) (string, string)
+
+var countryNetworkFixups = map[string]countryNetworkFixup{
+	"AU": fixupAUNetwork,
+	"BR": fixupBRNetwork,
+	"CA": fixupCANetwork,
+	"DE": fixupDENetwork,
+	"FR": fixupFRNetwork,
+	"GB": fixupGBNetwork,
+	"IT": fixupITNetwork,
+	"JP": fixupJPNetwork,
+	"KR": fixupKRNetwork,
+	"US": fixupUSNetwork,
+}
+
+// fixupCountrySpecificNetworks applies the country specific fixups to the
+// road networks in `mz_networks`. Networks that belong to another country,
+// e.g. `e-road`, are left alone.
+func fixupCountrySpecificNetworks(feature *geojson.Feature, country string) {
+	fixup := countryNetworkFixups[country]
+	if fixup == nil {
+		return
+	}
+
+	mzNetworks, _ := feature.Properties["mz_networks"].([]string)
+
+	l := len(mzNetworks) - (len(mzNetworks) % 3)
+	for i := 0; i < l; i += 3 {
+		t, n, r := mzNetworks[i], mzNetworks[i+1], mzNetworks[i+2]
+		if t != "road" {
+			continue
+		}
+
+		if n != "" && networkCountryCode(n) != country {
+			continue
+		}
+
+		if n == country {
+			// the network was backfilled from the country.
+			n = ""
+		}
+
+		n, r = fixup(feature.Properties, n, r)
+		if n == "" {
+			n = country
+		}
+
+		mzNetworks[i+1], mzNetworks[i+2] = n, r
+	}
+}
+
+// countryNetworkRanks are the relative importance of some country
+// specific networks. Lower numbers are more important.
+var countryNetworkRanks = map[string]int{
+	"AU:M-road": 1,
+	"AU:A-road": 2,
+	"AU:B-road": 3,
+	"AU:C-road": 4,
+
+	"BR": 1,
+
+	"CA:transcanada": 1,
+
+	"DE:BAB": 1,
+	"DE:BS":  2,
+	"DE:LS":  3,
+	"DE:KS":  4,
+
+	"FR:A-road": 1,
+	"FR:N-road": 2,
+	"FR:D-road": 3,
+
+	"GB:M-road":       1,
+	"GB:A-road-green": 2,
+	"GB:A-road-white": 3,
+	"GB:B-road":       4,
+
+	"IT:A-road": 1,
+	"IT:S-road": 2,
+	"IT:R-road": 3,
+	"IT:P-road": 4,
+
+	"JP:expressway":  1,
+	"JP:national":    2,
+	"JP:prefectural": 3,
+
+	"KR:expressway":   1,
+	"KR:national":     2,
+	"KR:metropolitan": 3,
+	"KR:local":        4,
+}
+
+var (
+	refNumber         = regexp.MustCompile(`^[0-9]+[A-Za-z]?$`)
+	refLetterNumber   = regexp.MustCompile(`^([A-Za-z]+)[ -]?([0-9]+[A-Za-z]?)`)
+	usStateRefPattern = regexp.MustCompile(`^([A-Za-z]{2})[ -]([0-9]+[A-Za-z]?)$`)
+)
+
+// splitRef splits a ref like "A 1", "M25" or "BR-101" into
+// its letters and number parts.
+func splitRef(ref string) (string, string) {
+	matches := refLetterNumber.FindStringSubmatch(strings.TrimSpace(ref))
+	if len(matches) == 0 {
+		return "", ref
+	}
+
+	return strings.ToUpper(matches[1]), matches[2]
+}
+
+func fixupUSNetwork(props geojson.Properties, network, ref string) (string, string) {
+	prefix, num := splitRef(ref)
+
+	switch network {
+	case "":
+		switch prefix {
+		case "I":
+			return "US:I", num
+		case "US":
+			return "US:US", num
+		}
+	case "US:I":
+		if prefix == "I" {
+			return network, num
+		}
+	case "US:US":
+		if prefix == "US" {
+			return network, num
+		}
+	default:
+		// state routes, e.g. US:CA with ref "CA 82"
+		state := strings.TrimPrefix(network, "US:")
+		if m := usStateRefPattern.FindStringSubmatch(ref); len(m) != 0 &&
+			strings.EqualFold(m[1], state) {
+			return network, m[2]
+		}
+	}
+
+	return network, ref
+}
+
+var caProvinces = []string{
+	"AB", "BC", "MB", "NB", "NL", "NS", "NT", "NU", "ON", "PE", "QC", "SK", "YT",
+}
+
+func fixupCANetwork(props geojson.Properties, network, ref string) (string, string) {
+	if strings.Contains(strings.ToUpper(ref), "TCH") || strings.Contains(ref, "Trans-Canada") {
+		return "CA:transcanada", ref
+	}
+
+	prefix, num := splitRef(ref)
+	if network == "" && stringIn(prefix, caProvinces) {
+		return "CA:" + prefix, num
+	}
+
+	if strings.HasPrefix(network, "CA:") && prefix == strings.ToUpper(strings.TrimPrefix(network, "CA:")) {
+		return network, num
+	}
+
+	return network, ref
+}
+
+func fixupGBNetwork(props geojson.Properties, network, ref string) (string, string) {
+	if network != "" {
+		return network, ref
+	}
+
+	prefix, _ := splitRef(ref)
+	switch prefix {
+	case "M":
+		return "GB:M-road", ref
+	case "A":
+		// A roads on the primary route network, trunk roads, are signed green.
+		if strings.Contains(ref, "(M)") || props["kind_detail"] == "trunk" || props["kind_detail"] == "motorway" {
+			return "GB:A-road-green", ref
+		}
+		return "GB:A-road-white", ref
+	case "B":
+		return "GB:B-road", ref
+	}
+
+	return network, ref
+}
+
+func fixupDENetwork(props geojson.Properties, network, ref string) (string, string) {
+	if network != "" {
+		return network, ref
+	}
+
+	prefix, _ := splitRef(ref)
+	switch prefix {
+	case "A":
+		return "DE:BAB", ref
+	case "B":
+		return "DE:BS", ref
+	case "L", "S", "ST":
+		return "DE:LS", ref
+	case "K":
+		return "DE:KS", ref
+	}
+
+	return network, ref
+}
+
+func fixupFRNetwork(props geojson.Properties, network, ref string) (string, string) {
+	if network != "" {
+		return network, ref
+	}
+
+	prefix, _ := splitRef(ref)
+	switch prefix {
+	case "A":
+		return "FR:A-road", ref
+	case "N", "RN":
+		return "FR:N-road", ref
+	case "D", "RD":
+		return "FR:D-road", ref
+	}
+
+	return network, ref
+}
+
+func fixupITNetwork(props geojson.Properties, network, ref string) (string, string) {
+	if network != "" {
+		return network, ref
+	}
+
+	prefix, _ := splitRef(ref)
+	switch prefix {
+	case "A", "RA":
+		return "IT:A-road", ref
+	case "SS":
+		return "IT:S-road", ref
+	case "SR":
+		return "IT:R-road", ref
+	case "SP":
+		return "IT:P-road", ref
+	}
+
+	return network, ref
+}
+
+func fixupJPNetwork(props geojson.Properties, network, ref string) (string, string) {
+	prefix, num := splitRef(ref)
+	if prefix == "E" || prefix == "C" {
+		return "JP:expressway", prefix + num
+	}
+
+	switch {
+	case strings.HasPrefix(network, "JP:prefectural"):
+		return "JP:prefectural", ref
+	case network != "":
+		return network, ref
+	case props["kind_detail"] == "motorway":
+		return "JP:expressway", ref
+	case refNumber.MatchString(ref) && (props["kind_detail"] == "trunk" || props["kind_detail"] == "primary"):
+		return "JP:national", ref
+	}
+
+	return network, ref
+}
+
+func fixupKRNetwork(props geojson.Properties, network, ref string) (string, string) {
+	if network != "" {
+		return network, ref
+	}
+
+	switch {
+	case props["kind_detail"] == "motorway":
+		return "KR:expressway", ref
+	case refNumber.MatchString(ref) && props["kind_detail"] == "trunk":
+		return "KR:national", ref
+	case refNumber.MatchString(ref):
+		return "KR:local", ref
+	}
+
+	return network, ref
+}
+
+func fixupAUNetwork(props geojson.Properties, network, ref string) (string, string) {
+	if network != "" {
+		return network, ref
+	}
+
+	prefix, _ := splitRef(ref)
+	switch prefix {
+	case "M":
+		return "AU:M-road", ref
+	case "A":
+		return "AU:A-road", ref
+	case "B":
+		return "AU:B-road", ref
+	case "C":
+		return "AU:C-road", ref
+	}
+
+	return network, ref
+}
+
+var brStates = []string{
+	"AC", "AL", "AP", "AM", "BA", "CE", "DF", "ES", "GO", "MA", "MT", "MS", "MG", "PA",
+	"PB", "PR", "PE", "PI", "RJ", "RN", "RS", "RO", "RR", "SC", "SP", "SE", "TO",
+}
+
+func fixupBRNetwork(props geojson.Properties, network, ref string) (string, string) {
+	prefix, num := splitRef(ref)
+	if prefix == "" {
+		return network, ref
+	}
+
+	// federal roads are BR-xxx, state roads use the state code, e.g. SP-280.
+	if prefix == "BR" && (network == "" || network == "BR") {
+		return "BR", num
+	}
+
+	if stringIn(prefix, brStates) && (network == "" || strings.EqualFold(network, "BR:"+prefix)) {
+		return "BR:" + prefix, num
+	}
+
+	return network, ref
+}
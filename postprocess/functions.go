@@ -2,6 +2,7 @@ package postprocess
 
 import (
 	"bytes"
+	"math"
 	"regexp"
 	"strings"
 
@@ -24,11 +25,11 @@ var functions = map[string]func(*CompileContext, *Config) (Function, error){
 	// nil values have not been implemented.
 	"numeric_min_filter":                 compileNumericMinFilter,
 	"road_networks":                      compileRoadNetworks,
-	"build_fence":                        nil,
+	"build_fence":                        compileBuildFence,
 	"drop_properties":                    nil, // TODO
 	"csv_match_properties":               compileCSVMatchProperties,
 	"exterior_boundaries":                nil,
-	"drop_features_mz_min_pixels":        nil,
+	"drop_features_mz_min_pixels":        compileDropFeaturesMZMinPixels,
 	"overlap":                            nil, // look into
 	"admin_boundaries":                   nil,
 	"apply_disputed_boundary_viewpoints": nil,
@@ -46,13 +47,13 @@ var functions = map[string]func(*CompileContext, *Config) (Function, error){
 	"update_parenthetical_properties":    compileUpdateParentheticalProperties,
 	"keep_n_features":                    nil,
 	"drop_properties_with_prefix":        nil,
-	"drop_small_inners":                  nil,
+	"drop_small_inners":                  compileDropSmallInners,
 	"simplify_and_clip":                  nil,
 	"intercut":                           nil,
 	"simplify_layer":                     nil,
 	"backfill_from_other_layer":          compileBackfillFromOtherLayers,
-	"buildings_unify":                    nil,
-	"palettize_colours":                  nil,
+	"buildings_unify":                    compileBuildingsUnify,
+	"palettize_colours":                  compilePalettizeColours,
 	"point_in_country_logic":             nil,
 	"tags_set_ne_min_max_zoom":           nil,
 	"drop_layer":                         nil, // drops admin_areas layer, which we completely ignore
@@ -273,6 +274,17 @@ type handleLabelPlacement struct {
 	ClipFactors map[string]float64
 	StartZoom   float64
 	Condition   filter.Condition
+
+	// Placements is the label placement method by layer,
+	// "centroid", the default, or "polylabel".
+	Placements map[string]string
+	Precision  float64 // of polylabel in meters, at least a pixel at the zoom
+
+	// GridZoom, if set, places a label point in each cell of a grid of tiles
+	// this many zooms below the tile zoom, from 1 to 3, e.g. 1 is the tile quadrants.
+	// Parts closer than GridMinDistance meters to an edge are not labeled.
+	GridZoom        maptile.Zoom
+	GridMinDistance float64
 }
 
 func (f *handleLabelPlacement) Eval(ctx *Context, layers map[string]*geojson.FeatureCollection) {
@@ -284,12 +296,17 @@ func (f *handleLabelPlacement) Eval(ctx *Context, layers map[string]*geojson.Fea
 		layer := layers[l]
 		if layer != nil {
 			paddedBound := padBoundByFactor(ctx.Bound, f.ClipFactors[l])
-			f.evalLayer(ctx, paddedBound, layer)
+			f.evalLayer(ctx, paddedBound, layer, f.Placements[l] == "polylabel")
 		}
 	}
 }
 
-func (f *handleLabelPlacement) evalLayer(ctx *Context, paddedBound orb.Bound, layer *geojson.FeatureCollection) {
+func (f *handleLabelPlacement) evalLayer(
+	ctx *Context,
+	paddedBound orb.Bound,
+	layer *geojson.FeatureCollection,
+	polylabel bool,
+) {
 	end := len(layer.Features)
 	for i := 0; i < end; i++ {
 		feature := layer.Features[i]
@@ -311,25 +328,119 @@ func (f *handleLabelPlacement) evalLayer(ctx *Context, paddedBound orb.Bound, la
 			}
 		}
 
-		centroid, _ := planar.CentroidArea(feature.Geometry)
-		if !paddedBound.Contains(centroid) {
+		if f.GridZoom > 0 {
+			labels, ok := gridLabelPoints(ctx, feature.Geometry, f.GridZoom, f.Precision, f.GridMinDistance)
+			if ok {
+				for _, l := range labels {
+					layer.Features = append(layer.Features, newLabel(feature, l.Point, l.Distance, true))
+				}
+				continue
+			}
+		}
+
+		point, dist, ok := f.labelPoint(feature.Geometry, ctx.Zoom, polylabel)
+		if !paddedBound.Contains(point) {
 			continue
 		}
 
-		nf := geojson.NewFeature(centroid)
-		nf.Properties = feature.Properties.Clone()
-		nf.Properties["label_placement"] = true
+		layer.Features = append(layer.Features, newLabel(feature, point, dist, ok))
+	}
+}
 
-		layer.Features = append(layer.Features, nf)
+// newLabel returns the label point feature with the properties of the feature.
+func newLabel(feature *geojson.Feature, point orb.Point, dist float64, hasDist bool) *geojson.Feature {
+	nf := geojson.NewFeature(point)
+	nf.Properties = feature.Properties.Clone()
+	nf.Properties["label_placement"] = true
+	if hasDist {
+		nf.Properties["label_distance"] = math.Round(dist*10) / 10
 	}
+
+	return nf
+}
+
+// labelPoint returns the label point of the geometry. For polylabel placement
+// of polygons it also returns the distance in meters to the closest edge.
+func (f *handleLabelPlacement) labelPoint(g orb.Geometry, zoom float64, polylabel bool) (orb.Point, float64, bool) {
+	if polylabel {
+		if p, dist, ok := polylabelPoint(g, f.Precision, zoom); ok {
+			return p, dist, true
+		}
+	}
+
+	centroid, _ := planar.CentroidArea(g)
+	return centroid, 0, false
 }
 
 func compileHandleLabelPlacement(ctx *CompileContext, c *Config) (Function, error) {
-	f := &handleLabelPlacement{}
+	f := &handleLabelPlacement{
+		Placements: make(map[string]string),
+		Precision:  defaultPolylabelPrecision,
+	}
 	if c.Params["layers"] != nil {
 		f.Layers = parseStrings(c.Params["layers"])
 	}
 
+	// placement is one method for all the layers or a map by layer.
+	switch p := c.Params["placement"].(type) {
+	case nil:
+	case string:
+		for _, l := range f.Layers {
+			f.Placements[l] = p
+		}
+	case map[interface{}]interface{}:
+		for l, m := range p {
+			layer, ok := l.(string)
+			method, ok2 := m.(string)
+			if !ok || !ok2 {
+				return nil, errors.Errorf("handle_label_placement: invalid placement: %v: %v", l, m)
+			}
+			f.Placements[layer] = method
+		}
+	default:
+		return nil, errors.Errorf("handle_label_placement: invalid placement: (%T, %v)", p, p)
+	}
+
+	for l, m := range f.Placements {
+		if m != "centroid" && m != "polylabel" {
+			return nil, errors.Errorf("handle_label_placement: %s: unsupported placement: %s", l, m)
+		}
+	}
+
+	if v, ok := c.Params["grid_zoom"]; ok {
+		z, ok := v.(int)
+		if !ok || z < 1 || z > 3 {
+			return nil, errors.Errorf("handle_label_placement: grid_zoom must be an int from 1 to 3: (%T, %v)", v, v)
+		}
+		f.GridZoom = maptile.Zoom(z)
+	}
+
+	if v, ok := c.Params["grid_min_distance"]; ok {
+		switch v := v.(type) {
+		case int:
+			f.GridMinDistance = float64(v)
+		case float64:
+			f.GridMinDistance = v
+		default:
+			return nil, errors.Errorf("handle_label_placement: grid_min_distance must be a number: (%T, %v)", v, v)
+		}
+	}
+
+	if v, ok := c.Params["polylabel_precision"]; ok {
+		switch v := v.(type) {
+		case int:
+			f.Precision = float64(v)
+		case float64:
+			f.Precision = v
+		default:
+			return nil, errors.Errorf("handle_label_placement: polylabel_precision must be a number: (%T, %v)", v, v)
+		}
+
+		if f.Precision <= 0 {
+			return nil, errors.Errorf("handle_label_placement: polylabel_precision must be positive: %v", f.Precision)
+		}
+	}
+
 	if c.Params["start_zoom"] != nil {
 		f.StartZoom = float64(c.Params["start_zoom"].(int))
 	}
@@ -882,7 +993,9 @@ func compileBackfillFromOtherLayers(ctx *CompileContext, c *Config) (Function, e
 
 // ClipAndWrapGeometry clips the geometry in the layers, removing features that are
 // clipped out. If possible it'll also wrap open polygon rings around the boundary
-// so they look okay within the context of the boundary.
+// so they look okay within the context of the boundary. The clip factors can
+// override the default factor of 2.0 for a layer, zero or missing values use
+// the default. The clip factors can be nil.
 func ClipAndWrapGeometry(
 	bound orb.Bound,
 	clipFactors map[string]float64,
@@ -895,8 +1008,13 @@ func ClipAndWrapGeometry(
 	//
 	// Other geometry we clip to a +50% on each side bound. Since input for a tile
 	// currently only includes ways with a node in the tile we need some overlap.
-	for _, layer := range layers {
-		paddedBound := padBoundByFactor(bound, 2.0)
+	for name, layer := range layers {
+		factor := clipFactors[name]
+		if factor == 0 {
+			// not defined for the layer
+			factor = 2.0
+		}
+		paddedBound := padBoundByFactor(bound, factor)
 
 		at := 0
 		for _, f := range layer.Features {
@@ -0,0 +1,121 @@
+package postprocess
+
+import (
+	"math"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/clip"
+	"github.com/paulmach/orb/maptile"
+)
+
+// maxGridCells is the max number of grid cells to check for one feature,
+// the cells in a tile for the max grid zoom of 3. Above this, like processing
+// a big area at a high zoom, a single label point is used.
+const maxGridCells = 64
+
+// gridLabel is a label point for the part of a polygon in a grid cell.
+type gridLabel struct {
+	Point    orb.Point
+	Distance float64
+}
+
+// gridLabelPoints returns label points for the polygon on a grid of tiles
+// gridZoom zooms below the context zoom, e.g. 1 is the tile quadrants.
+// Each point is the polylabel of the part of the polygon in the cell, so
+// it's inside the polygon and the same for all the tiles that include the cell.
+// Only the cells with their center in the bound are used, so adjacent tiles
+// don't duplicate the points. Returns false if the polygon fits in one cell
+// and a single label point should be used.
+func gridLabelPoints(
+	ctx *Context,
+	g orb.Geometry,
+	gridZoom maptile.Zoom,
+	precision float64,
+	minDistance float64,
+) ([]gridLabel, bool) {
+	switch g.(type) {
+	case orb.Polygon, orb.MultiPolygon:
+	default:
+		return nil, false
+	}
+
+	z := maptile.Zoom(ctx.Zoom) + gridZoom
+	if z > 32 {
+		return nil, false
+	}
+
+	gb := g.Bound()
+	if maptile.At(gb.Min, z) == maptile.At(gb.Max, z) {
+		return nil, false
+	}
+
+	if !gb.Intersects(ctx.Bound) {
+		return nil, true
+	}
+
+	minX, minY, maxX, maxY := cellRange(ctx.Bound, z)
+
+	// limit to the cells the polygon could be in.
+	gmin := maptile.At(orb.Point{gb.Left(), gb.Top()}, z)
+	gmax := maptile.At(orb.Point{gb.Right(), gb.Bottom()}, z)
+	if v := int(gmin.X); v > minX {
+		minX = v
+	}
+	if v := int(gmin.Y); v > minY {
+		minY = v
+	}
+	if v := int(gmax.X); v < maxX {
+		maxX = v
+	}
+	if v := int(gmax.Y); v < maxY {
+		maxY = v
+	}
+
+	if minX > maxX || minY > maxY {
+		return nil, true
+	}
+
+	if (maxX-minX+1)*(maxY-minY+1) > maxGridCells {
+		return nil, false
+	}
+
+	var result []gridLabel
+	for x := uint32(minX); x <= uint32(maxX); x++ {
+		for y := uint32(minY); y <= uint32(maxY); y++ {
+			cell := maptile.New(x, y, z).Bound()
+			if !ctx.Bound.Contains(cell.Center()) {
+				continue
+			}
+
+			part := clip.Geometry(cell, orb.Clone(g))
+			if part == nil {
+				continue
+			}
+
+			p, dist, ok := polylabelPoint(part, precision, ctx.Zoom)
+			if !ok || dist <= minDistance {
+				continue
+			}
+
+			result = append(result, gridLabel{Point: p, Distance: dist})
+		}
+	}
+
+	return result, true
+}
+
+// cellRange returns the range of cells at the zoom with their center in
+// the bound. A cell on the edge of the bound is not included unless its
+// center is in the bound. The range is empty, min > max, if there are none.
+func cellRange(b orb.Bound, z maptile.Zoom) (minX, minY, maxX, maxY int) {
+	// y is flipped, the tile with the max lat has the min y.
+	fmin := maptile.Fraction(orb.Point{b.Left(), b.Top()}, z)
+	fmax := maptile.Fraction(orb.Point{b.Right(), b.Bottom()}, z)
+
+	minX = int(math.Ceil(fmin[0] - 0.5))
+	minY = int(math.Ceil(fmin[1] - 0.5))
+	maxX = int(math.Floor(fmax[0] - 0.5))
+	maxY = int(math.Floor(fmax[1] - 0.5))
+
+	return minX, minY, maxX, maxY
+}
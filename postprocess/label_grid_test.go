@@ -0,0 +1,140 @@
+package postprocess
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/orb/planar"
+)
+
+func TestHandleLabelPlacement_grid(t *testing.T) {
+	c := &Config{
+		Params: map[interface{}]interface{}{
+			"layers":            []interface{}{"landuse"},
+			"label_where":       map[interface{}]interface{}{"name": true},
+			"grid_zoom":         1,
+			"grid_min_distance": 10,
+		},
+	}
+
+	f, err := compileHandleLabelPlacement(&CompileContext{}, c)
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+
+	left := maptile.New(9000, 12000, 15)
+	right := maptile.New(9001, 12000, 15)
+
+	// a park covering most of the two tiles
+	b := left.Bound()
+	b = b.Union(right.Bound())
+	park := orb.Bound{
+		Min: orb.Point{b.Left() + 0.001, b.Bottom() + 0.001},
+		Max: orb.Point{b.Right() - 0.001, b.Top() - 0.001},
+	}.ToPolygon()
+
+	labels := func(bound orb.Bound) []orb.Point {
+		feature := geojson.NewFeature(park)
+		feature.Properties["name"] = "park"
+		layers := map[string]*geojson.FeatureCollection{
+			"landuse": {Features: []*geojson.Feature{feature}},
+		}
+		f.Eval(&Context{Zoom: 15, Bound: bound}, layers)
+
+		var result []orb.Point
+		for _, lf := range layers["landuse"].Features[1:] {
+			if !planar.PolygonContains(park, lf.Point()) {
+				t.Errorf("label should be in the park: %v", lf.Point())
+			}
+
+			result = append(result, lf.Point())
+		}
+
+		return result
+	}
+
+	l := labels(left.Bound())
+	if len(l) != 4 {
+		t.Errorf("should have a label in each quadrant: %v", len(l))
+	}
+
+	// the points of adjacent tiles should be the same as for both tiles
+	r := labels(right.Bound())
+	both := labels(b)
+	if !reflect.DeepEqual(append(l, r...), both) {
+		t.Errorf("labels should be the same across tiles")
+		t.Logf("%v", append(l, r...))
+		t.Logf("%v", both)
+	}
+
+	// small parks in one quadrant get the single label
+	corner := left.Bound().Min
+	park = orb.Bound{Min: orb.Point{corner[0] + 0.001, corner[1] + 0.001}, Max: orb.Point{corner[0] + 0.002, corner[1] + 0.002}}.ToPolygon()
+	if l := labels(left.Bound()); len(l) != 1 {
+		t.Errorf("small park should have one label: %v", len(l))
+	}
+}
+
+func TestHandleLabelPlacement_gridZoom(t *testing.T) {
+	tile := maptile.New(9000, 12000, 15)
+
+	// a park covering the whole tile
+	b := tile.Bound()
+	park := orb.Bound{
+		Min: orb.Point{b.Left() - 0.001, b.Bottom() - 0.001},
+		Max: orb.Point{b.Right() + 0.001, b.Top() + 0.001},
+	}.ToPolygon()
+
+	cases := []struct {
+		zoom   int
+		labels int
+	}{
+		{zoom: 1, labels: 4},
+		{zoom: 2, labels: 16},
+		{zoom: 3, labels: 64},
+	}
+
+	for _, tc := range cases {
+		c := &Config{
+			Params: map[interface{}]interface{}{
+				"layers":      []interface{}{"landuse"},
+				"label_where": map[interface{}]interface{}{"name": true},
+				"grid_zoom":   tc.zoom,
+			},
+		}
+
+		f, err := compileHandleLabelPlacement(&CompileContext{}, c)
+		if err != nil {
+			t.Fatalf("compile error: %v", err)
+		}
+
+		feature := geojson.NewFeature(park)
+		feature.Properties["name"] = "park"
+		layers := map[string]*geojson.FeatureCollection{
+			"landuse": {Features: []*geojson.Feature{feature}},
+		}
+		f.Eval(&Context{Zoom: 15, Bound: b}, layers)
+
+		if l := len(layers["landuse"].Features) - 1; l != tc.labels {
+			t.Errorf("zoom %d: incorrect number of labels: %v != %v", tc.zoom, l, tc.labels)
+		}
+	}
+
+	for _, z := range []int{0, 4} {
+		c := &Config{
+			Params: map[interface{}]interface{}{
+				"layers":      []interface{}{"landuse"},
+				"label_where": map[interface{}]interface{}{"name": true},
+				"grid_zoom":   z,
+			},
+		}
+
+		_, err := compileHandleLabelPlacement(&CompileContext{}, c)
+		if err == nil {
+			t.Errorf("zoom %d: should be invalid", z)
+		}
+	}
+}
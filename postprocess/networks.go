@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osmzen/util"
 	"github.com/pkg/errors"
 )
 
@@ -23,12 +24,15 @@ type roadNetworks struct {
 func (f *roadNetworks) Eval(ctx *Context, layers map[string]*geojson.FeatureCollection) {
 
 	layer := layers[f.Layer]
+	if layer == nil {
+		return
+	}
 
 	for _, feature := range layer.Features {
-		mergeNetworksFromTags(feature)
+		country := featureCountryCode(ctx, feature)
 
-		// don't have country codes so skip this.
-		// _fixup_country_specific_networks(feature)
+		mergeNetworksFromTags(feature, country)
+		fixupCountrySpecificNetworks(feature, country)
 
 		extractNetworkInformation(feature)
 		chooseMostImportantNetwork(feature)
@@ -101,7 +105,7 @@ var networkOperators = map[string]string{
 // Take the network and ref tags from the feature and, if they both exist, add
 // them to the mz_networks list. This is to make handling of networks and refs
 // more consistent across elements.
-func mergeNetworksFromTags(feature *geojson.Feature) {
+func mergeNetworksFromTags(feature *geojson.Feature, country string) {
 	network := feature.Properties.MustString("network", "")
 	ref := feature.Properties.MustString("ref", "")
 	mzNetworks, _ := feature.Properties["mz_networks"].([]string)
@@ -129,8 +133,6 @@ func mergeNetworksFromTags(feature *geojson.Feature) {
 		}
 	}
 
-	// skip country code stuff
-
 	// if there's no network, but the operator indicates a network, then we can
 	// back-fill an approximate network tag from the operator. this can mean
 	// that extra refs are available for road networks.
@@ -141,6 +143,12 @@ func mergeNetworksFromTags(feature *geojson.Feature) {
 		}
 	}
 
+	// otherwise use the country, the country specific fixups
+	// will try to figure out the network from the ref.
+	if network == "" && countryNetworkFixups[country] != nil {
+		network = country
+	}
+
 	if network == "" || ref == "" {
 		return
 	}
@@ -367,13 +375,10 @@ func roadNetworkImportance(network, ref string) int {
 	var nc int
 	if network == "" {
 		return 9999
-	} else if network == "US:I" || strings.Contains(network, ":national") {
-		nc = 1
-	} else if network == "US:US" || strings.Contains(network, "regional") {
-		nc = 2
+	} else if r, ok := countryNetworkRanks[network]; ok {
+		nc = r
 	} else {
-		nc = len(strings.Split(network, ":")) + 3
-
+		nc = util.NetworkImportance(network)
 	}
 
 	rc, err := strconv.Atoi(ref)
@@ -1,6 +1,11 @@
 package postprocess
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
 
 func TestRoadShieldText(t *testing.T) {
 	cases := []struct {
@@ -69,3 +74,202 @@ func TestRoadShieldText(t *testing.T) {
 		})
 	}
 }
+
+func TestCountryNetworkFixups(t *testing.T) {
+	cases := []struct {
+		name         string
+		country      string
+		kindDetail   string
+		network, ref string
+		rNetwork     string
+		rRef         string
+	}{
+		{
+			name:     "us interstate from ref",
+			country:  "US",
+			ref:      "I-280",
+			rNetwork: "US:I",
+			rRef:     "280",
+		},
+		{
+			name:     "us state route strips prefix",
+			country:  "US",
+			network:  "US:CA",
+			ref:      "CA 82",
+			rNetwork: "US:CA",
+			rRef:     "82",
+		},
+		{
+			name:     "gb motorway",
+			country:  "GB",
+			ref:      "M25",
+			rNetwork: "GB:M-road",
+			rRef:     "M25",
+		},
+		{
+			name:       "gb primary a road",
+			country:    "GB",
+			kindDetail: "trunk",
+			ref:        "A1",
+			rNetwork:   "GB:A-road-green",
+			rRef:       "A1",
+		},
+		{
+			name:       "gb non-primary a road",
+			country:    "GB",
+			kindDetail: "primary",
+			ref:        "A413",
+			rNetwork:   "GB:A-road-white",
+			rRef:       "A413",
+		},
+		{
+			name:     "de autobahn",
+			country:  "DE",
+			ref:      "A 7",
+			rNetwork: "DE:BAB",
+			rRef:     "A 7",
+		},
+		{
+			name:     "fr national",
+			country:  "FR",
+			ref:      "N 7",
+			rNetwork: "FR:N-road",
+			rRef:     "N 7",
+		},
+		{
+			name:     "br federal",
+			country:  "BR",
+			ref:      "BR-101",
+			rNetwork: "BR",
+			rRef:     "101",
+		},
+		{
+			name:     "br state",
+			country:  "BR",
+			ref:      "SP-280",
+			rNetwork: "BR:SP",
+			rRef:     "280",
+		},
+		{
+			name:       "kr expressway",
+			country:    "KR",
+			kindDetail: "motorway",
+			ref:        "1",
+			rNetwork:   "KR:expressway",
+			rRef:       "1",
+		},
+		{
+			name:     "unknown ref keeps country",
+			country:  "DE",
+			ref:      "1234",
+			rNetwork: "DE",
+			rRef:     "1234",
+		},
+		{
+			name:     "network from another country",
+			country:  "DE",
+			network:  "e-road",
+			ref:      "E 45",
+			rNetwork: "e-road",
+			rRef:     "E 45",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			network := tc.network
+			if network == "" {
+				network = tc.country
+			}
+
+			f := geojson.NewFeature(nil)
+			f.Properties["kind_detail"] = tc.kindDetail
+			f.Properties["mz_networks"] = []string{"road", network, tc.ref}
+
+			fixupCountrySpecificNetworks(f, tc.country)
+
+			mzNetworks := f.Properties["mz_networks"].([]string)
+			if mzNetworks[1] != tc.rNetwork {
+				t.Errorf("incorrect network: %v != %v", mzNetworks[1], tc.rNetwork)
+			}
+
+			if mzNetworks[2] != tc.rRef {
+				t.Errorf("incorrect ref: %v != %v", mzNetworks[2], tc.rRef)
+			}
+		})
+	}
+}
+
+func TestFeatureCountryCode(t *testing.T) {
+	resolver := CountryResolverFunc(func(p orb.Point) string {
+		if p[0] > 0 {
+			return "gb"
+		}
+		return ""
+	})
+
+	cases := []struct {
+		name     string
+		resolver CountryResolver
+		point    orb.Point
+		props    geojson.Properties
+		result   string
+	}{
+		{
+			name:     "from resolver",
+			resolver: resolver,
+			point:    orb.Point{1, 1},
+			props:    geojson.Properties{"network": "US:I"},
+			result:   "GB",
+		},
+		{
+			name:     "resolver does not know",
+			resolver: resolver,
+			point:    orb.Point{-1, 1},
+			props:    geojson.Properties{"network": "US:I"},
+			result:   "US",
+		},
+		{
+			name:   "from relation network",
+			props:  geojson.Properties{"mz_networks": []string{"bicycle", "ncn", "1", "road", "ca:on", "401"}},
+			result: "CA",
+		},
+		{
+			name:   "from operator",
+			props:  geojson.Properties{"operator": "Highways England"},
+			result: "GB",
+		},
+		{
+			name:   "from ref",
+			props:  geojson.Properties{"ref": "I 95"},
+			result: "US",
+		},
+		{
+			name:   "from relation ref",
+			props:  geojson.Properties{"mz_networks": []string{"road", "", "BR-101"}},
+			result: "BR",
+		},
+		{
+			name:   "ambiguous ref",
+			props:  geojson.Properties{"ref": "M25"},
+			result: "",
+		},
+		{
+			name:   "unknown",
+			props:  geojson.Properties{"operator": "someone"},
+			result: "",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := geojson.NewFeature(tc.point)
+			f.Properties = tc.props
+
+			cc := featureCountryCode(&Context{CountryResolver: tc.resolver}, f)
+			if cc != tc.result {
+				t.Errorf("incorrect country: %v != %v", cc, tc.result)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package postprocess
+
+import (
+	"sort"
+
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osmzen/util"
+	"github.com/pkg/errors"
+)
+
+// Derive a colour for each feature by parsing the first set input
+// attribute, `colour` by default, and snapping it to the closest colour
+// in the palette. The colour is normalized to a `#rrggbb` hex value and
+// saved in the first input attribute, or removed if it can't be parsed.
+// The other input attributes are alternate spellings, e.g. `roof_color`,
+// and are removed. The palette colour is output in the `attribute`
+// property as its name, or as hex if the format is `hex`.
+type palettizeColours struct {
+	Layer           string
+	Attribute       string
+	InputAttributes []string
+	Hex             bool
+	Palette         []paletteColour
+}
+
+type paletteColour struct {
+	Name   string
+	Colour util.Colour
+}
+
+func (f *palettizeColours) Eval(ctx *Context, layers map[string]*geojson.FeatureCollection) {
+	layer := layers[f.Layer]
+	if layer == nil {
+		return
+	}
+
+	for _, feature := range layer.Features {
+		c, ok := f.colour(feature)
+		for _, attr := range f.InputAttributes {
+			delete(feature.Properties, attr)
+		}
+
+		if !ok {
+			continue
+		}
+
+		feature.Properties[f.InputAttributes[0]] = c.Hex()
+
+		p := f.closest(c)
+		if f.Hex {
+			feature.Properties[f.Attribute] = p.Colour.Hex()
+		} else {
+			feature.Properties[f.Attribute] = p.Name
+		}
+	}
+}
+
+// colour returns the first input attribute that can be parsed.
+func (f *palettizeColours) colour(feature *geojson.Feature) (util.Colour, bool) {
+	for _, attr := range f.InputAttributes {
+		v, ok := feature.Properties[attr].(string)
+		if !ok || v == "" {
+			continue
+		}
+
+		if c, ok := util.ParseColour(v); ok {
+			return c, true
+		}
+	}
+
+	return util.Colour{}, false
+}
+
+func (f *palettizeColours) closest(c util.Colour) paletteColour {
+	best := 0
+	bestDist := f.Palette[0].Colour.Distance(c)
+	for i, p := range f.Palette[1:] {
+		if d := p.Colour.Distance(c); d < bestDist {
+			best = i + 1
+			bestDist = d
+		}
+	}
+
+	return f.Palette[best]
+}
+
+func compilePalettizeColours(ctx *CompileContext, c *Config) (Function, error) {
+	f := &palettizeColours{InputAttributes: []string{"colour"}}
+
+	var ok bool
+	if f.Layer, ok = c.Params["layer"].(string); !ok {
+		return nil, errors.New("palettize_colours: layer must be defined")
+	}
+
+	if f.Attribute, ok = c.Params["attribute"].(string); !ok {
+		return nil, errors.New("palettize_colours: attribute must be defined")
+	}
+
+	if c.Params["input_attributes"] != nil {
+		f.InputAttributes = parseStrings(c.Params["input_attributes"])
+		if len(f.InputAttributes) == 0 {
+			return nil, errors.New("palettize_colours: input_attributes must not be empty")
+		}
+	}
+
+	if format, ok := c.Params["format"]; ok {
+		switch format {
+		case "name":
+		case "hex":
+			f.Hex = true
+		default:
+			return nil, errors.Errorf("palettize_colours: format must be 'name' or 'hex': %v", format)
+		}
+	}
+
+	colours, ok := c.Params["colours"].(map[interface{}]interface{})
+	if !ok || len(colours) == 0 {
+		return nil, errors.New("palettize_colours: colours must be a map of names to rgb values")
+	}
+
+	for k, v := range colours {
+		name, ok := k.(string)
+		if !ok {
+			return nil, errors.Errorf("palettize_colours: colour name must be a string: %v", k)
+		}
+
+		rgb, ok := v.([]interface{})
+		if !ok || len(rgb) != 3 {
+			return nil, errors.Errorf("palettize_colours: %s: must be an [r, g, b] array", name)
+		}
+
+		var vals [3]uint8
+		for i, val := range rgb {
+			n, ok := val.(int)
+			if !ok || n < 0 || n > 255 {
+				return nil, errors.Errorf("palettize_colours: %s: values must be integers between 0 and 255", name)
+			}
+			vals[i] = uint8(n)
+		}
+
+		f.Palette = append(f.Palette, paletteColour{
+			Name:   name,
+			Colour: util.Colour{R: vals[0], G: vals[1], B: vals[2]},
+		})
+	}
+
+	// map iteration order is random, sort so ties are resolved the same every time.
+	sort.Slice(f.Palette, func(i, j int) bool {
+		return f.Palette[i].Name < f.Palette[j].Name
+	})
+
+	return f, nil
+}
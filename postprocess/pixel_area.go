@@ -0,0 +1,243 @@
+package postprocess
+
+import (
+	"math"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osmzen/filter"
+	"github.com/pkg/errors"
+)
+
+// earthCircumference is the circumference of the earth in mercator meters.
+const earthCircumference = 2 * math.Pi * 6378137
+
+// metersPerPixelDim returns the number of mercator meters per pixel, in
+// one dimension, at the given zoom. Assumes 256x256 pixel tiles.
+func metersPerPixelDim(zoom float64) float64 {
+	return earthCircumference / 256 / math.Pow(2, zoom)
+}
+
+// metersPerPixelArea returns the number of square mercator meters
+// that make up one pixel at the given zoom.
+func metersPerPixelArea(zoom float64) float64 {
+	d := metersPerPixelDim(zoom)
+	return d * d
+}
+
+// Drop the inner rings (holes) of polygons that are smaller
+// than a given pixel area at the zoom of the tile.
+type dropSmallInners struct {
+	Layers    []string
+	StartZoom float64
+	EndZoom   float64
+	PixelArea float64
+}
+
+func (f *dropSmallInners) Eval(ctx *Context, layers map[string]*geojson.FeatureCollection) {
+	// end_zoom is exclusive, as in the original tilezen/vector-datasource
+	if ctx.Zoom < f.StartZoom || f.EndZoom <= ctx.Zoom {
+		return
+	}
+
+	tolerance := metersPerPixelArea(ctx.Zoom) * f.PixelArea
+
+	for _, l := range f.Layers {
+		layer := layers[l]
+		if layer == nil {
+			continue
+		}
+
+		for _, feature := range layer.Features {
+			switch g := feature.Geometry.(type) {
+			case orb.Polygon:
+				feature.Geometry = dropSmallPolygonInners(g, tolerance)
+			case orb.MultiPolygon:
+				mp := make(orb.MultiPolygon, len(g))
+				for i, p := range g {
+					mp[i] = dropSmallPolygonInners(p, tolerance)
+				}
+				feature.Geometry = mp
+			}
+		}
+	}
+}
+
+func dropSmallPolygonInners(p orb.Polygon, tolerance float64) orb.Polygon {
+	if len(p) <= 1 {
+		return p
+	}
+
+	// the same geometry can be shared by features in different layers
+	// so a new polygon is created instead of updating in place.
+	var result orb.Polygon
+	for i, inner := range p[1:] {
+		if filter.MercatorArea(inner) >= tolerance {
+			if result != nil {
+				result = append(result, inner)
+			}
+			continue
+		}
+
+		if result == nil {
+			result = make(orb.Polygon, 0, len(p)-1)
+			result = append(result, p[:i+1]...)
+		}
+	}
+
+	if result == nil {
+		return p
+	}
+
+	return result
+}
+
+func compileDropSmallInners(ctx *CompileContext, c *Config) (Function, error) {
+	f := &dropSmallInners{EndZoom: 50}
+
+	if c.Params["source_layers"] == nil {
+		return nil, errors.New("drop_small_inners: source_layers is required")
+	}
+	f.Layers = parseStrings(c.Params["source_layers"])
+
+	zs, ok := c.Params["start_zoom"]
+	if ok {
+		z, ok := zs.(int)
+		if !ok {
+			return nil, errors.New("drop_small_inners: start_zoom must be an integer")
+		}
+
+		f.StartZoom = float64(z)
+	}
+
+	ze, ok := c.Params["end_zoom"]
+	if ok {
+		z, ok := ze.(int)
+		if !ok {
+			return nil, errors.New("drop_small_inners: end_zoom must be an integer")
+		}
+
+		f.EndZoom = float64(z)
+	}
+
+	f.PixelArea, ok = parseFloat64(c.Params["pixel_area"])
+	if !ok {
+		return nil, errors.Errorf("drop_small_inners: pixel_area required and must be a number: (%T, %v)",
+			c.Params["pixel_area"], c.Params["pixel_area"])
+	}
+
+	return f, nil
+}
+
+// Drop features whose area, in pixels at the zoom of the tile, is less than
+// a minimum. The minimum is read from a property on the feature, `mz_min_pixels`
+// by default, falling back to the `min_pixels` parameter if one is configured.
+type dropFeaturesMZMinPixels struct {
+	Layer     string
+	StartZoom float64
+	EndZoom   float64
+	Property  string
+	MinPixels float64
+}
+
+func (f *dropFeaturesMZMinPixels) Eval(ctx *Context, layers map[string]*geojson.FeatureCollection) {
+	// end_zoom is exclusive, as in the original tilezen/vector-datasource
+	if ctx.Zoom < f.StartZoom || f.EndZoom <= ctx.Zoom {
+		return
+	}
+
+	layer := layers[f.Layer]
+	if layer == nil {
+		return
+	}
+
+	pixelArea := metersPerPixelArea(ctx.Zoom)
+
+	at := 0
+	for _, feature := range layer.Features {
+		min := f.MinPixels
+		if v, ok := parseFloat64(feature.Properties[f.Property]); ok {
+			min = v
+		}
+
+		if min > 0 && isPolygonal(feature.Geometry) {
+			ctx.fctx = filter.NewContextFromProperties(ctx.fctx, feature.Properties)
+			ctx.fctx.Geometry = feature.Geometry
+
+			if ctx.fctx.Area()/pixelArea < min {
+				continue
+			}
+		}
+
+		layer.Features[at] = feature
+		at++
+	}
+
+	layer.Features = layer.Features[:at]
+}
+
+func compileDropFeaturesMZMinPixels(ctx *CompileContext, c *Config) (Function, error) {
+	f := &dropFeaturesMZMinPixels{
+		EndZoom:  50,
+		Property: "mz_min_pixels",
+	}
+
+	var ok bool
+	if f.Layer, ok = c.Params["source_layer"].(string); !ok {
+		return nil, errors.New("drop_features_mz_min_pixels: source_layer must be defined")
+	}
+
+	zs, ok := c.Params["start_zoom"]
+	if ok {
+		z, ok := zs.(int)
+		if !ok {
+			return nil, errors.New("drop_features_mz_min_pixels: start_zoom must be an integer")
+		}
+
+		f.StartZoom = float64(z)
+	}
+
+	ze, ok := c.Params["end_zoom"]
+	if ok {
+		z, ok := ze.(int)
+		if !ok {
+			return nil, errors.New("drop_features_mz_min_pixels: end_zoom must be an integer")
+		}
+
+		f.EndZoom = float64(z)
+	}
+
+	if p, ok := c.Params["property"]; ok {
+		if f.Property, ok = p.(string); !ok {
+			return nil, errors.New("drop_features_mz_min_pixels: property must be a string")
+		}
+	}
+
+	if mp, ok := c.Params["min_pixels"]; ok {
+		if f.MinPixels, ok = parseFloat64(mp); !ok {
+			return nil, errors.New("drop_features_mz_min_pixels: min_pixels must be a number")
+		}
+	}
+
+	return f, nil
+}
+
+func isPolygonal(g orb.Geometry) bool {
+	switch g.(type) {
+	case orb.Polygon, orb.MultiPolygon:
+		return true
+	}
+
+	return false
+}
+
+func parseFloat64(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,92 @@
+package postprocess
+
+import (
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+func TestDropSmallInners(t *testing.T) {
+	// at zoom 15 a pixel is about 4.8 meters, or about 0.00004 degrees at the equator.
+	outer := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{0.01, 0.01}}.ToRing()
+	small := orb.Bound{Min: orb.Point{0.001, 0.001}, Max: orb.Point{0.00101, 0.00101}}.ToRing()
+	large := orb.Bound{Min: orb.Point{0.002, 0.002}, Max: orb.Point{0.003, 0.003}}.ToRing()
+
+	polygon := orb.Polygon{outer, small, large}
+	layers := map[string]*geojson.FeatureCollection{
+		"buildings": {Features: []*geojson.Feature{
+			geojson.NewFeature(polygon),
+			geojson.NewFeature(orb.MultiPolygon{polygon}),
+		}},
+	}
+
+	f := &dropSmallInners{
+		Layers:    []string{"buildings"},
+		EndZoom:   16,
+		PixelArea: 1,
+	}
+
+	f.Eval(&Context{Zoom: 16}, layers)
+	if l := len(layers["buildings"].Features[0].Geometry.(orb.Polygon)); l != 3 {
+		t.Errorf("should not drop at end zoom: %v", l)
+	}
+
+	f.Eval(&Context{Zoom: 15}, layers)
+	p := layers["buildings"].Features[0].Geometry.(orb.Polygon)
+	if len(p) != 2 {
+		t.Fatalf("should drop small inner: %v", len(p))
+	}
+
+	if !p[1].Equal(large) {
+		t.Errorf("should keep the large inner")
+	}
+
+	mp := layers["buildings"].Features[1].Geometry.(orb.MultiPolygon)
+	if len(mp[0]) != 2 {
+		t.Errorf("should drop small inner in multipolygon: %v", len(mp[0]))
+	}
+
+	// the original shared geometry should not be modified
+	if len(polygon) != 3 || !polygon[1].Equal(small) {
+		t.Errorf("should not modify the original geometry")
+	}
+}
+
+func TestDropFeaturesMZMinPixels(t *testing.T) {
+	small := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{0.0001, 0.0001}}
+	large := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{0.01, 0.01}}
+
+	newFeature := func(g orb.Geometry, props geojson.Properties) *geojson.Feature {
+		f := geojson.NewFeature(g)
+		f.Properties = props
+		return f
+	}
+
+	layers := map[string]*geojson.FeatureCollection{
+		"landuse": {Features: []*geojson.Feature{
+			newFeature(small.ToPolygon(), geojson.Properties{"id": 1}),
+			newFeature(large.ToPolygon(), geojson.Properties{"id": 2}),
+			newFeature(small.ToPolygon(), geojson.Properties{"id": 3, "mz_min_pixels": 1}),
+			newFeature(orb.Point{0, 0}, geojson.Properties{"id": 4}),
+		}},
+	}
+
+	f := &dropFeaturesMZMinPixels{
+		Layer:     "landuse",
+		EndZoom:   50,
+		Property:  "mz_min_pixels",
+		MinPixels: 10,
+	}
+
+	f.Eval(&Context{Zoom: 15}, layers)
+
+	var ids []int
+	for _, f := range layers["landuse"].Features {
+		ids = append(ids, f.Properties.MustInt("id"))
+	}
+
+	if len(ids) != 3 || ids[0] != 2 || ids[1] != 3 || ids[2] != 4 {
+		t.Errorf("incorrect features kept: %v", ids)
+	}
+}
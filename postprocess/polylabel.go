@@ -0,0 +1,173 @@
+package postprocess
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/planar"
+	"github.com/paulmach/orb/project"
+)
+
+// defaultPolylabelPrecision is the default precision, in meters,
+// of the polylabel label placement. The precision used is at least
+// one pixel at the zoom, so big polygons at low zooms are fast.
+const defaultPolylabelPrecision = 1.0
+
+// polylabelPoint returns the pole of inaccessibility of the polygon, the point
+// inside it furthest from its edges, and the distance in meters to the
+// closest edge. This is a better label point than the centroid for concave
+// shapes, like U-shaped lakes, that have their centroid outside.
+// The search stops when the result is within precision meters, or one pixel
+// at the zoom if larger, of the best.
+// Based on https://github.com/mapbox/polylabel
+func polylabelPoint(g orb.Geometry, precision, zoom float64) (orb.Point, float64, bool) {
+	var polygons []orb.Polygon
+	switch g := g.(type) {
+	case orb.Polygon:
+		polygons = []orb.Polygon{g}
+	case orb.MultiPolygon:
+		polygons = g
+	default:
+		return orb.Point{}, 0, false
+	}
+
+	found := false
+	var best orb.Point
+	bestDist := -1.0
+	for _, p := range polygons {
+		if len(p) == 0 || len(p[0]) < 4 {
+			continue
+		}
+
+		point, dist := polygonLabel(p, precision, zoom)
+		if dist > bestDist {
+			best, bestDist, found = point, dist, true
+		}
+	}
+
+	return best, bestDist, found
+}
+
+// polygonLabel finds the label point in mercator to have
+// the same distance in all directions.
+func polygonLabel(p orb.Polygon, precision, zoom float64) (orb.Point, float64) {
+	// mercator meters are stretched by the scale factor,
+	// it's about constant over the size of a polygon.
+	scale := project.MercatorScaleFactor(p[0].Bound().Center())
+	merc := project.Polygon(p.Clone(), project.WGS84.ToMercator)
+
+	point, dist := polylabelPlanar(merc, mercatorPrecision(precision, scale, zoom))
+	return project.Mercator.ToWGS84(point), dist / scale
+}
+
+// mercatorPrecision returns the polylabel precision in mercator meters.
+// It's at least one pixel at the zoom, a more precise point can't be seen
+// and the cost of the search grows with the number of cells.
+func mercatorPrecision(precision, scale, zoom float64) float64 {
+	return math.Max(precision*scale, metersPerPixelDim(zoom))
+}
+
+func polylabelPlanar(p orb.Polygon, precision float64) (orb.Point, float64) {
+	bound := p[0].Bound()
+	size := math.Min(bound.Right()-bound.Left(), bound.Top()-bound.Bottom())
+	if size == 0 {
+		return bound.Min, 0
+	}
+
+	h := size / 2
+	cells := &cellQueue{}
+	for x := bound.Left(); x < bound.Right(); x += size {
+		for y := bound.Bottom(); y < bound.Top(); y += size {
+			heap.Push(cells, newCell(orb.Point{x + h, y + h}, h, p))
+		}
+	}
+
+	// the centroid is a good first guess for most shapes
+	centroid, _ := planar.CentroidArea(p)
+	best := newCell(centroid, 0, p)
+
+	if c := newCell(bound.Center(), 0, p); c.dist > best.dist {
+		best = c
+	}
+
+	for cells.Len() > 0 {
+		c := heap.Pop(cells).(*cell)
+
+		if c.dist > best.dist {
+			best = c
+		}
+
+		// no better solution in this cell
+		if c.max-best.dist <= precision {
+			continue
+		}
+
+		h := c.h / 2
+		heap.Push(cells, newCell(orb.Point{c.center[0] - h, c.center[1] - h}, h, p))
+		heap.Push(cells, newCell(orb.Point{c.center[0] + h, c.center[1] - h}, h, p))
+		heap.Push(cells, newCell(orb.Point{c.center[0] - h, c.center[1] + h}, h, p))
+		heap.Push(cells, newCell(orb.Point{c.center[0] + h, c.center[1] + h}, h, p))
+	}
+
+	return best.center, math.Max(best.dist, 0)
+}
+
+type cell struct {
+	center orb.Point
+	h      float64 // half the cell size
+	dist   float64 // distance from the center to the polygon, negative if outside
+	max    float64 // max possible distance of a point in the cell
+}
+
+func newCell(center orb.Point, h float64, p orb.Polygon) *cell {
+	d := pointToPolygonDistance(center, p)
+	return &cell{
+		center: center,
+		h:      h,
+		dist:   d,
+		max:    d + h*math.Sqrt2,
+	}
+}
+
+// pointToPolygonDistance returns the distance from the point to the
+// polygon edges, negative if the point is outside the polygon.
+func pointToPolygonDistance(point orb.Point, p orb.Polygon) float64 {
+	inside := false
+	minDist := math.Inf(1)
+
+	for _, r := range p {
+		for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+			a, b := r[i], r[j]
+
+			if (a[1] > point[1]) != (b[1] > point[1]) &&
+				point[0] < (b[0]-a[0])*(point[1]-a[1])/(b[1]-a[1])+a[0] {
+				inside = !inside
+			}
+
+			minDist = math.Min(minDist, planar.DistanceFromSegmentSquared(a, b, point))
+		}
+	}
+
+	if inside {
+		return math.Sqrt(minDist)
+	}
+
+	return -math.Sqrt(minDist)
+}
+
+// cellQueue is a max heap of cells by their max possible distance.
+type cellQueue []*cell
+
+func (q cellQueue) Len() int            { return len(q) }
+func (q cellQueue) Less(i, j int) bool  { return q[i].max > q[j].max }
+func (q cellQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *cellQueue) Push(x interface{}) { *q = append(*q, x.(*cell)) }
+
+func (q *cellQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	c := old[n-1]
+	*q = old[:n-1]
+	return c
+}
@@ -0,0 +1,117 @@
+package postprocess
+
+import (
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/planar"
+)
+
+// uShape is a U shaped polygon, about 1.1km across at the equator,
+// with the centroid in the gap between the arms.
+var uShape = orb.Polygon{{
+	{0, 0}, {0.01, 0}, {0.01, 0.01}, {0.008, 0.01}, {0.008, 0.002},
+	{0.002, 0.002}, {0.002, 0.01}, {0, 0.01}, {0, 0},
+}}
+
+func TestPolylabelPoint(t *testing.T) {
+	centroid, _ := planar.CentroidArea(uShape)
+	if planar.PolygonContains(uShape, centroid) {
+		t.Fatalf("centroid should be outside the polygon: %v", centroid)
+	}
+
+	point, dist, ok := polylabelPoint(uShape, 1, 20)
+	if !ok {
+		t.Fatalf("should find a point")
+	}
+
+	if !planar.PolygonContains(uShape, point) {
+		t.Errorf("label should be in the polygon: %v", point)
+	}
+
+	// the arms and base are 0.002 degrees, about 222 meters, wide.
+	// The best points are in the corners, a bit further from the edges.
+	if dist < 111 || dist > 150 {
+		t.Errorf("incorrect distance: %v", dist)
+	}
+
+	// multi polygons use the polygon with the best label
+	small := orb.Bound{Min: orb.Point{1, 1}, Max: orb.Point{1.001, 1.001}}.ToPolygon()
+	point, _, _ = polylabelPoint(orb.MultiPolygon{small, uShape}, 1, 20)
+	if !planar.PolygonContains(uShape, point) {
+		t.Errorf("label should be in the larger polygon: %v", point)
+	}
+
+	_, _, ok = polylabelPoint(orb.LineString{{0, 0}, {1, 1}}, 1, 20)
+	if ok {
+		t.Errorf("should not find a point for a line string")
+	}
+}
+
+func TestMercatorPrecision(t *testing.T) {
+	// at high zooms the configured precision is used
+	if v := mercatorPrecision(1, 1, 20); v != 1 {
+		t.Errorf("incorrect precision: %v", v)
+	}
+
+	// at low zooms it is one pixel
+	if v := mercatorPrecision(1, 1, 4); v != metersPerPixelDim(4) {
+		t.Errorf("incorrect precision: %v", v)
+	}
+
+	// a pixel at zoom 12 is about the width of the arms,
+	// the label should still be in the polygon.
+	point, _, _ := polylabelPoint(uShape, 1, 12)
+	if !planar.PolygonContains(uShape, point) {
+		t.Errorf("label should be in the polygon: %v", point)
+	}
+}
+
+func TestHandleLabelPlacement_polylabel(t *testing.T) {
+	c := &Config{
+		Params: map[interface{}]interface{}{
+			"layers":      []interface{}{"water", "landuse"},
+			"placement":   map[interface{}]interface{}{"water": "polylabel"},
+			"label_where": map[interface{}]interface{}{"name": true},
+		},
+	}
+
+	f, err := compileHandleLabelPlacement(&CompileContext{}, c)
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+
+	feature := geojson.NewFeature(uShape)
+	feature.Properties["name"] = "U"
+
+	layers := map[string]*geojson.FeatureCollection{
+		"water":   {Features: []*geojson.Feature{feature}},
+		"landuse": {Features: []*geojson.Feature{feature}},
+	}
+	f.Eval(&Context{Zoom: 16, Bound: uShape.Bound()}, layers)
+
+	water := layers["water"].Features
+	if len(water) != 2 || !planar.PolygonContains(uShape, water[1].Point()) {
+		t.Errorf("water label should be in the polygon")
+	}
+
+	if v := water[1].Properties["label_distance"]; v == nil {
+		t.Errorf("label distance not set")
+	}
+
+	landuse := layers["landuse"].Features
+	if len(landuse) != 2 || planar.PolygonContains(uShape, landuse[1].Point()) {
+		t.Errorf("landuse label should use the centroid")
+	}
+
+	if v, ok := landuse[1].Properties["label_distance"]; ok {
+		t.Errorf("label distance should not be set: %v", v)
+	}
+
+	c.Params["placement"] = "pole"
+	_, err = compileHandleLabelPlacement(&CompileContext{}, c)
+	if err == nil {
+		t.Errorf("expected error for unsupported placement")
+	}
+}
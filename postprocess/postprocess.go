@@ -6,6 +6,7 @@ import (
 
 	"github.com/paulmach/orb"
 	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osm"
 	"github.com/paulmach/osmzen/filter"
 )
 
@@ -20,6 +21,14 @@ type Context struct {
 	Zoom  float64 // zoom of the tile request
 	Bound orb.Bound
 
+	// RelationMembership is the set of relations each of the original
+	// osm elements is a member of. Can be nil if unknown.
+	RelationMembership map[osm.FeatureID]osm.Relations
+
+	// CountryResolver is used to find the country of roads to apply
+	// country specific network fixups. Can be nil.
+	CountryResolver CountryResolver
+
 	// cache the object, save the allocs.
 	fctx *filter.Context
 }
@@ -62,5 +71,5 @@ func Compile(ctx *CompileContext, c *Config) (Function, error) {
 		return nil, nil
 	}
 
-	panic(fmt.Sprintf("unsupported function: %s", name))
+	return nil, fmt.Errorf("unsupported function: %s", name)
 }
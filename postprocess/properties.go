@@ -0,0 +1,151 @@
+package postprocess
+
+import "sort"
+
+// A Property is a feature property set by a post process function.
+type Property struct {
+	// Layer is the layer of the features, empty for all the layers.
+	Layer string
+	Key   string
+
+	// Type is the json type of the values, eg. string, number, boolean
+	// or array. Empty if unknown, eg. copied from another property.
+	Type string
+
+	// Values are the constant values set by the function. Computed is true
+	// if the function can also set other values.
+	Values   []interface{}
+	Computed bool
+}
+
+// A PropertySetter is implemented by the post process functions that set
+// feature properties. It is used to build the catalog of the properties.
+type PropertySetter interface {
+	OutputProperties() []Property
+}
+
+// SetConditionalNamesProperties are the properties set by SetConditionalNames.
+var SetConditionalNamesProperties = []Property{
+	{Layer: "buildings", Key: "name", Type: "string", Computed: true},
+	{Layer: "landuse", Key: "name", Type: "string", Computed: true},
+}
+
+func (f *buildFence) OutputProperties() []Property {
+	return []Property{
+		{Layer: f.OutputLayer, Key: "barrier", Type: "string", Computed: true},
+	}
+}
+
+func (f *buildingsUnify) OutputProperties() []Property {
+	return []Property{
+		{Layer: f.Layer, Key: "root_id", Type: "number", Computed: true},
+	}
+}
+
+func (f *clampMinZoom) OutputProperties() []Property {
+	return []Property{
+		{Layer: f.Layer, Key: f.Property, Type: "number", Computed: true},
+	}
+}
+
+func (f *csvMatchProperties) OutputProperties() []Property {
+	return []Property{
+		{Layer: f.SourceLayer, Key: f.Matcher.OutputKey(), Type: "number", Computed: true},
+	}
+}
+
+func (f *addCollisionRank) OutputProperties() []Property {
+	return []Property{
+		{Key: "collision_rank", Type: "number", Computed: true},
+	}
+}
+
+func (f *handleLabelPlacement) OutputProperties() []Property {
+	result := make([]Property, 0, len(f.Layers))
+	for _, l := range f.Layers {
+		result = append(result, Property{
+			Layer:  l,
+			Key:    "label_placement",
+			Type:   "boolean",
+			Values: []interface{}{true},
+		})
+
+		if f.Placements[l] == "polylabel" || f.GridZoom > 0 {
+			result = append(result, Property{
+				Layer:    l,
+				Key:      "label_distance",
+				Type:     "number",
+				Computed: true,
+			})
+		}
+	}
+
+	return result
+}
+
+func (f *updateParentheticalProperties) OutputProperties() []Property {
+	values := make([]interface{}, len(f.Values))
+	for i, v := range f.Values {
+		values[i] = v
+	}
+
+	return []Property{
+		{Layer: f.Layer, Key: "kind", Type: "string", Values: values},
+		{Layer: f.Layer, Key: "min_zoom", Type: "number", Values: []interface{}{f.TargetMinZoom}},
+	}
+}
+
+func (f *backfillFromOtherLayers) OutputProperties() []Property {
+	return []Property{
+		{Layer: f.DstLayer, Key: f.DstKey, Computed: true},
+	}
+}
+
+func (f *roadNetworks) OutputProperties() []Property {
+	prefixes := make([]string, 0, len(networksByType))
+	for _, n := range networksByType {
+		prefixes = append(prefixes, n.Prefix)
+	}
+	sort.Strings(prefixes)
+
+	var result []Property
+	for _, p := range prefixes {
+		result = append(result,
+			Property{Layer: f.Layer, Key: p + "network", Type: "string", Computed: true},
+			Property{Layer: f.Layer, Key: p + "shield_text", Type: "string", Computed: true},
+			Property{Layer: f.Layer, Key: "all_" + p + "networks", Type: "array", Computed: true},
+			Property{Layer: f.Layer, Key: "all_" + p + "shield_texts", Type: "array", Computed: true},
+		)
+	}
+
+	return result
+}
+
+func (f *palettizeColours) OutputProperties() []Property {
+	return []Property{
+		{Layer: f.Layer, Key: f.Attribute, Type: "string", Computed: true},
+	}
+}
+
+func (f *quantizeHeight) OutputProperties() []Property {
+	return []Property{
+		{Layer: f.Layer, Key: "height", Type: "number", Computed: true},
+	}
+}
+
+func (f *remap) OutputProperties() []Property {
+	values := make([]string, 0, len(f.Remap))
+	for _, v := range f.Remap {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+
+	result := Property{Layer: f.Layer, Key: f.Property, Type: "string"}
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			result.Values = append(result.Values, v)
+		}
+	}
+
+	return []Property{result}
+}
@@ -0,0 +1,114 @@
+package postprocess
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osmzen/filter"
+)
+
+// A Sort orders the features of a layer. It's the `sort` of the layer
+// config and is applied before the post processing.
+type Sort func(features []*geojson.Feature, zoom float64)
+
+// MapSort converts the sort name found in the layer config to the concrete
+// Sort function. These are based on the vectordatasource.sort functions,
+// with the feature id as the last key so the order is deterministic.
+// The generic sort_rank, area, min_zoom and id sorts are also supported.
+func MapSort(name string) (Sort, bool) {
+	name = strings.TrimPrefix(name, "vectordatasource.sort.")
+	s, ok := sorts[name]
+	return s, ok
+}
+
+var sorts = map[string]Sort{
+	// larger areas first so the smaller ones are drawn on top
+	"buildings": sortBy(desc("area"), asc("id")),
+	"earth":     sortBy(desc("area"), asc("id")),
+	"landuse":   sortBy(desc("area"), asc("id")),
+	"water":     sortBy(desc("area"), asc("id")),
+
+	"places":  sortBy(asc("scalerank"), desc("population"), asc("id")),
+	"pois":    sortBy(desc("mz_transit_score"), desc("elevation"), asc("id")),
+	"roads":   sortBy(asc("id")),
+	"transit": sortBy(asc("id")),
+
+	"sort_rank": sortBy(asc("sort_rank"), asc("id")),
+	"area":      sortBy(desc("area"), asc("id")),
+	"min_zoom":  sortBy(asc("min_zoom"), asc("id")),
+	"id":        sortBy(asc("id")),
+}
+
+// sortKey compares the numeric property of two features,
+// returning -1, 0 or 1. Missing values are sorted last.
+type sortKey func(a, b *geojson.Feature) int
+
+func asc(key string) sortKey {
+	return func(a, b *geojson.Feature) int {
+		return compareProperty(a, b, key, false)
+	}
+}
+
+func desc(key string) sortKey {
+	return func(a, b *geojson.Feature) int {
+		return compareProperty(a, b, key, true)
+	}
+}
+
+func compareProperty(a, b *geojson.Feature, key string, desc bool) int {
+	av, aok := parseFloat64(a.Properties[key])
+	bv, bok := parseFloat64(b.Properties[key])
+
+	switch {
+	case !aok && !bok:
+		return 0
+	case !aok:
+		return 1
+	case !bok:
+		return -1
+	case av == bv:
+		return 0
+	case (av < bv) != desc:
+		return -1
+	}
+
+	return 1
+}
+
+func sortBy(keys ...sortKey) Sort {
+	return func(features []*geojson.Feature, zoom float64) {
+		sort.SliceStable(features, func(i, j int) bool {
+			for _, k := range keys {
+				if c := k(features[i], features[j]); c != 0 {
+					return c < 0
+				}
+			}
+
+			return false
+		})
+	}
+}
+
+// DropSmallAreas removes the polygons with an area less than the
+// threshold, in square pixels at the zoom. It's the `area-inclusion-threshold`
+// of the layer config and is applied before the post processing.
+func DropSmallAreas(fc *geojson.FeatureCollection, zoom, threshold float64) {
+	if threshold <= 0 {
+		return
+	}
+
+	min := threshold * metersPerPixelArea(zoom)
+
+	at := 0
+	for _, f := range fc.Features {
+		if isPolygonal(f.Geometry) && filter.MercatorArea(f.Geometry) < min {
+			continue
+		}
+
+		fc.Features[at] = f
+		at++
+	}
+
+	fc.Features = fc.Features[:at]
+}
@@ -0,0 +1,127 @@
+package postprocess
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+func TestMapSort(t *testing.T) {
+	feature := func(id int, props geojson.Properties) *geojson.Feature {
+		f := geojson.NewFeature(orb.Point{})
+		f.Properties = props
+		f.Properties["id"] = id
+		return f
+	}
+
+	cases := []struct {
+		name     string
+		sort     string
+		features []*geojson.Feature
+		expected []int
+	}{
+		{
+			name: "area then id",
+			sort: "vectordatasource.sort.landuse",
+			features: []*geojson.Feature{
+				feature(3, geojson.Properties{"area": 10.0}),
+				feature(2, geojson.Properties{"area": 100}),
+				feature(1, geojson.Properties{"area": 10.0}),
+				feature(4, geojson.Properties{}),
+			},
+			expected: []int{2, 1, 3, 4},
+		},
+		{
+			name: "roads by id",
+			sort: "vectordatasource.sort.roads",
+			features: []*geojson.Feature{
+				feature(3, geojson.Properties{"sort_rank": 350.0}),
+				feature(1, geojson.Properties{"sort_rank": 400.0}),
+				feature(2, geojson.Properties{"sort_rank": 350.0}),
+			},
+			expected: []int{1, 2, 3},
+		},
+		{
+			name: "sort rank",
+			sort: "sort_rank",
+			features: []*geojson.Feature{
+				feature(1, geojson.Properties{"sort_rank": 400.0}),
+				feature(2, geojson.Properties{"sort_rank": 350.0}),
+				feature(3, geojson.Properties{"sort_rank": 400.0}),
+			},
+			expected: []int{2, 1, 3},
+		},
+		{
+			name: "places",
+			sort: "vectordatasource.sort.places",
+			features: []*geojson.Feature{
+				feature(1, geojson.Properties{"scalerank": 8, "population": 1000}),
+				feature(2, geojson.Properties{"scalerank": 8, "population": 5000}),
+				feature(3, geojson.Properties{"scalerank": 4}),
+				feature(4, geojson.Properties{"population": 9000}),
+			},
+			expected: []int{3, 2, 1, 4},
+		},
+		{
+			name: "pois",
+			sort: "vectordatasource.sort.pois",
+			features: []*geojson.Feature{
+				feature(1, geojson.Properties{}),
+				feature(2, geojson.Properties{"elevation": 1200.0}),
+				feature(3, geojson.Properties{"mz_transit_score": 50.0}),
+			},
+			expected: []int{3, 2, 1},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, ok := MapSort(tc.sort)
+			if !ok {
+				t.Fatalf("sort not found: %v", tc.sort)
+			}
+
+			s(tc.features, 16)
+
+			var ids []int
+			for _, f := range tc.features {
+				ids = append(ids, f.Properties["id"].(int))
+			}
+
+			if !reflect.DeepEqual(ids, tc.expected) {
+				t.Errorf("incorrect order: %v != %v", ids, tc.expected)
+			}
+		})
+	}
+
+	if _, ok := MapSort("vectordatasource.sort.unknown"); ok {
+		t.Errorf("should not find unknown sort")
+	}
+}
+
+func TestDropSmallAreas(t *testing.T) {
+	// at zoom 16 a pixel is about 2.4 meters, or 0.00002 degrees, at the equator.
+	small := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{0.00001, 0.00001}}.ToPolygon()
+	large := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{0.0001, 0.0001}}.ToPolygon()
+
+	fc := geojson.NewFeatureCollection()
+	fc.Append(geojson.NewFeature(small))
+	fc.Append(geojson.NewFeature(large))
+	fc.Append(geojson.NewFeature(orb.Point{0, 0}))
+
+	DropSmallAreas(fc, 16, 1)
+	if len(fc.Features) != 2 {
+		t.Fatalf("should drop the small polygon: %v", len(fc.Features))
+	}
+
+	if _, ok := fc.Features[0].Geometry.(orb.Polygon); !ok {
+		t.Errorf("should keep the large polygon")
+	}
+
+	DropSmallAreas(fc, 12, 1)
+	if len(fc.Features) != 1 {
+		t.Errorf("should drop the large polygon at a lower zoom: %v", len(fc.Features))
+	}
+}
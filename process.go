@@ -1,17 +1,16 @@
 package osmzen
 
 import (
+	"context"
 	"math"
 
 	"github.com/paulmach/osmzen/filter"
 	"github.com/paulmach/osmzen/postprocess"
 
 	"github.com/paulmach/orb"
-	"github.com/paulmach/orb/geo"
 	"github.com/paulmach/orb/geojson"
 	"github.com/paulmach/orb/maptile"
 	"github.com/paulmach/osm"
-	"github.com/paulmach/osm/osmgeojson"
 
 	"github.com/pkg/errors"
 )
@@ -19,77 +18,75 @@ import (
 // Process will convert OSM data into geojson layers.
 // The bound is used for clipping large geometry and only returning label "points"
 // if they're in the bound.  The zoom is used to do the correct post process filtering.
-func (c *Config) Process(data *osm.OSM, bound orb.Bound, z maptile.Zoom) (map[string]*geojson.FeatureCollection, error) {
-	return c.process(data, bound, z)
+// Options can be used to limit the layers or change the output, see WithLayers etc.
+func (c *Config) Process(
+	data *osm.OSM,
+	bound orb.Bound,
+	z maptile.Zoom,
+	opts ...ProcessOption,
+) (map[string]*geojson.FeatureCollection, error) {
+	return c.process(context.Background(), data, bound, z, opts...)
 }
 
-// order is the preferred order to process a single element.
-// Try to match the most reasonable first.
-var order = []string{
-	"pois",
-	"roads",
-	"buildings",
-	"landuse",
-	"water",
-	"places",
-
-	"boundaries",
-	"transit",
-	"earth",
+// ProcessContext is the same as Process but will stop and return ctx.Err()
+// if the context is canceled. It is checked between layers, every few
+// features within a layer and between post processors.
+func (c *Config) ProcessContext(
+	ctx context.Context,
+	data *osm.OSM,
+	bound orb.Bound,
+	z maptile.Zoom,
+	opts ...ProcessOption,
+) (map[string]*geojson.FeatureCollection, error) {
+	return c.process(ctx, data, bound, z, opts...)
 }
 
-// ProcessElement will convert a single osm element to [layer, properties].
-// It will return the first matching layer.
-func (c *Config) ProcessElement(e osm.Element) (layer string, props geojson.Properties, err error) {
-	data := &osm.OSM{}
-	data.Append(e)
-
-	layers, err := c.process(data, orb.Bound{Min: orb.Point{-180, -90}, Max: orb.Point{180, 90}}, 20)
+func (c *Config) process(
+	goctx context.Context,
+	data *osm.OSM,
+	bound orb.Bound,
+	z maptile.Zoom,
+	opts ...ProcessOption,
+) (map[string]*geojson.FeatureCollection, error) {
+	options, err := newProcessOptions(opts)
 	if err != nil {
-		return "", nil, err
-	}
-
-	for _, o := range order {
-		if layer := layers[o]; layer != nil {
-			return o, layer.Features[0].Properties, nil
-		}
-	}
-
-	// an extra check in case the list of layers does not
-	// match the `order` list above.
-	for _, o := range c.All {
-		if !stringIn(o, order) {
-			if layer := layers[o]; layer != nil {
-				return o, layer.Features[0].Properties, nil
-			}
-		}
+		return nil, err
 	}
+	z += maptile.Zoom(options.zoomOffset())
 
-	return "", nil, errors.New("not found")
-}
-
-func (c *Config) process(data *osm.OSM, bound orb.Bound, z maptile.Zoom) (map[string]*geojson.FeatureCollection, error) {
-	input, err := convertToGeoJSON(data, bound)
-	if err != nil {
-		return nil, errors.WithStack(err)
+	idx := options.membershipIndex(data)
+	ctx := newZenContext(goctx, data, bound, z, idx)
+	ctx.options = options
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	ctx := newZenContext(data, bound, z)
-	return c.processGeoJSON(ctx, input, z)
+	return c.processElements(ctx, buildElements(data, bound, idx), z)
 }
 
-func (c *Config) processGeoJSON(
+func (c *Config) processElements(
 	ctx *zenContext,
-	input *geojson.FeatureCollection,
+	input []element,
 	z maptile.Zoom,
 ) (map[string]*geojson.FeatureCollection, error) {
 	result := make(map[string]*geojson.FeatureCollection, len(c.Layers))
 	for _, name := range c.All {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		lc, ok := c.Layers[name]
 		if !ok {
 			return nil, errors.Errorf("layer not defined: %v", name)
 		}
 
+		if !ctx.options.includeLayer(name) {
+			// empty so the post processors don't need to check,
+			// removed from the result after the post processing.
+			result[name] = geojson.NewFeatureCollection()
+			continue
+		}
+
 		f, err := lc.evalFeatures(ctx, input)
 		if err != nil {
 			return nil, err
@@ -97,25 +94,66 @@ func (c *Config) processGeoJSON(
 		result[name] = f
 	}
 
-	// apply post processing
+	return c.postProcess(ctx, result, z)
+}
+
+// postProcess applies the post processors, clips the geometry to
+// the context bound and removes the original element tags.
+func (c *Config) postProcess(
+	ctx *zenContext,
+	result map[string]*geojson.FeatureCollection,
+	z maptile.Zoom,
+) (map[string]*geojson.FeatureCollection, error) {
 	ppctx := &postprocess.Context{
-		Zoom:  float64(z),
-		Bound: ctx.Bound,
+		Zoom:               float64(z),
+		Bound:              ctx.Bound,
+		RelationMembership: ctx.RelationMembership,
+		CountryResolver:    c.countryResolver,
+	}
+
+	// Small polygons are removed and the features sorted
+	// before the post processing, as done by tilezen/tilequeue.
+	for name, fc := range result {
+		if lc := c.Layers[name]; lc != nil {
+			postprocess.DropSmallAreas(fc, ppctx.Zoom, float64(lc.AreaInclusionThreshold))
+			if lc.sort != nil {
+				lc.sort(fc.Features, ppctx.Zoom)
+			}
+		}
 	}
 
 	// This does some "what is the name really" logic that is part
 	// of the initial SQL query in the tilezen/vector-datasource.
 	postprocess.SetConditionalNames(ppctx, result)
+	ctx.options.setLanguages(result)
 
 	for _, pp := range c.postProcessors {
+		if pp == nil {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		pp.Eval(ppctx, result)
 	}
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// clip and fix open polygons (tained multipolygon relations)
-	postprocess.ClipAndWrapGeometry(ppctx.Bound, c.clipFactors, result)
+	postprocess.ClipAndWrapGeometry(ppctx.Bound, ctx.options.layerClipFactors(c.clipFactors), result)
+	ctx.options.round(result)
+
+	// remove tags and the layers not requested
+	for name, l := range result {
+		if !ctx.options.includeLayer(name) {
+			delete(result, name)
+			continue
+		}
 
-	// remove tags
-	for _, l := range result {
 		for _, f := range l.Features {
 			delete(f.Properties, "tags")
 		}
@@ -127,34 +165,56 @@ func (c *Config) processGeoJSON(
 // Process will convert OSM data into a feature collection for that layer.
 // The zoom is used to do the correct post process filtering.
 func (l *Layer) Process(data *osm.OSM, bound orb.Bound, z maptile.Zoom) (*geojson.FeatureCollection, error) {
-	input, err := convertToGeoJSON(data, bound)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
+	return l.ProcessContext(context.Background(), data, bound, z)
+}
 
-	ctx := newZenContext(data, bound, z)
-	return l.evalFeatures(ctx, input)
+// ProcessContext is the same as Process but will stop and return ctx.Err()
+// if the context is canceled.
+func (l *Layer) ProcessContext(
+	goctx context.Context,
+	data *osm.OSM,
+	bound orb.Bound,
+	z maptile.Zoom,
+) (*geojson.FeatureCollection, error) {
+	idx := NewMembershipIndex(data)
+	ctx := newZenContext(goctx, data, bound, z, idx)
+	return l.evalFeatures(ctx, buildElements(data, bound, idx))
 }
 
+// cancelCheckInterval is how often, in number of features,
+// the context is checked for cancellation while evaluating a layer.
+const cancelCheckInterval = 500
+
 func (l *Layer) evalFeatures(
 	ctx *zenContext,
-	input *geojson.FeatureCollection,
+	input []element,
 ) (*geojson.FeatureCollection, error) {
 	output := geojson.NewFeatureCollection()
-	for _, f := range input.Features {
-		// ways that intersect the tile many have interesting nodes outside the tile.
-		// these nodes become geojson points that we want to skip.
-		if p, ok := f.Geometry.(orb.Point); ok {
-			if !ctx.Bound.Contains(p) {
-				continue
-			}
-		}
+	err := l.eachFeature(ctx, input, func(f *geojson.Feature, minZoom float64) {
+		output.Append(f)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		feature, err := l.evalFeature(ctx, f)
-		if err != nil {
-			return nil, err
+	return output, nil
+}
+
+// eachFeature evaluates the elements and calls fn with the matched
+// features and their unrounded min zoom.
+func (l *Layer) eachFeature(
+	ctx *zenContext,
+	input []element,
+	fn func(f *geojson.Feature, minZoom float64),
+) error {
+	for i := range input {
+		if i%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 		}
 
+		feature, minZoom := l.evalFeature(ctx, &input[i])
 		if feature == nil {
 			continue // no match
 		}
@@ -166,32 +226,34 @@ func (l *Layer) evalFeatures(
 			}
 		}
 
-		output.Append(feature)
+		fn(feature, minZoom)
 	}
 
-	return output, nil
+	return nil
 }
 
-func (l *Layer) evalFeature(ctx *zenContext, feature *geojson.Feature) (*geojson.Feature, error) {
-	ctx.fctx = filter.NewContext(ctx.fctx, feature)
-	fctx := ctx.fctx
-
-	if !stringIn(fctx.Geometry.GeoJSONType(), l.GeometryTypes) {
-		return nil, nil
+func (l *Layer) evalFeature(ctx *zenContext, e *element) (*geojson.Feature, float64) {
+	// the geometry type of relations is only known once the geometry
+	// is built, so they're checked after the filters match.
+	if e.gtype != "" && !stringIn(e.gtype, l.GeometryTypes) {
+		return nil, 0
 	}
 
-	result, err := l.filterMatch(fctx)
-	if err != nil {
-		return nil, err
-	}
+	ctx.fctx = filter.NewContextFromElement(ctx.fctx, e)
+	fctx := ctx.fctx
 
+	result := l.filterMatch(fctx)
 	if result == nil {
-		return nil, nil
+		return nil, 0
+	}
+
+	if !stringIn(e.GeometryType(), l.GeometryTypes) {
+		return nil, 0
 	}
 
 	if result.MinZoom == nil {
 		// skip this feature, see pois.yaml for an example
-		return nil, nil
+		return nil, 0
 	}
 
 	minZoom := result.MinZoom.EvalNum(fctx)
@@ -199,26 +261,26 @@ func (l *Layer) evalFeature(ctx *zenContext, feature *geojson.Feature) (*geojson
 	// zoom 12 tile, return all features with [0, 13) min_zoom
 	// zoom 12 tile, do not return min_zoom features [13 inf)
 	if float64(ctx.Zoom+1) < minZoom {
-		return nil, nil
+		return nil, 0
 	}
 
-	output := geojson.NewFeature(fctx.Geometry)
+	output := geojson.NewFeature(fctx.LoadGeometry())
 	output.Properties = result.Properties(fctx)
 	output.Properties["min_zoom"] = math.Floor(minZoom*100) / 100.0
 
 	// tilezen/vector-datasource has relations have negative ids, not sure why exactly.
-	if feature.Properties.MustString("type") == "relation" {
-		output.Properties["id"] = -feature.Properties.MustInt("id")
+	if e.id.Type() == osm.TypeRelation {
+		output.Properties["id"] = -int(e.id.Ref())
 	} else {
-		output.Properties["id"] = feature.Properties.MustInt("id")
+		output.Properties["id"] = int(e.id.Ref())
 	}
-	output.Properties["type"] = string(feature.Properties.MustString("type"))
+	output.Properties["type"] = string(e.id.Type())
 
 	// original element tags used a few places as part of post processing.
-	output.Properties["tags"] = feature.Properties["tags"]
+	output.Properties["tags"] = e.TagMap()
 
 	l.applyTransforms(fctx, output)
-	return output, nil
+	return output, minZoom
 }
 
 func (l *Layer) applyTransforms(fctx *filter.Context, feature *geojson.Feature) {
@@ -227,36 +289,46 @@ func (l *Layer) applyTransforms(fctx *filter.Context, feature *geojson.Feature)
 	}
 }
 
-func (l *Layer) filterMatch(fctx *filter.Context) (*filter.Filter, error) {
-	for _, f := range l.filters {
-		if f.Match(fctx) {
-			return f, nil
-		}
-	}
-
-	return nil, nil
+func (l *Layer) filterMatch(fctx *filter.Context) *filter.Filter {
+	return l.index.Match(fctx)
 }
 
 type zenContext struct {
+	// Context is used to cancel the processing, can be nil.
+	Context context.Context
+
 	Zoom               maptile.Zoom
 	Bound              orb.Bound
 	OSM                *osm.OSM
 	WayMembership      map[osm.NodeID]osm.Ways
 	RelationMembership map[osm.FeatureID]osm.Relations
 
+	options processOptions
+
 	// cache the object, save the allocs.
 	fctx *filter.Context
 }
 
-func newZenContext(data *osm.OSM, bound orb.Bound, z maptile.Zoom) *zenContext {
+// newZenContext creates the context for processing the data
+// using the membership of the index.
+func newZenContext(
+	goctx context.Context,
+	data *osm.OSM,
+	bound orb.Bound,
+	z maptile.Zoom,
+	idx *MembershipIndex,
+) *zenContext {
 	ctx := &zenContext{
-		Zoom:  z,
-		Bound: bound,
-		OSM:   data,
+		Context: goctx,
+		Zoom:    z,
+		Bound:   bound,
+		OSM:     data,
+		options: defaultProcessOptions(),
+
+		WayMembership:      idx.WayMembership,
+		RelationMembership: idx.RelationMembership,
 	}
 
-	ctx.ComputeMembership()
-
 	// This is a cached, and reused version of the filter context
 	// to help reduce memory allocations.
 	ctx.fctx = &filter.Context{
@@ -268,69 +340,13 @@ func newZenContext(data *osm.OSM, bound orb.Bound, z maptile.Zoom) *zenContext {
 	return ctx
 }
 
-func (ctx *zenContext) ComputeMembership() {
-	if ctx.OSM == nil {
-		return
-	}
-
-	// TODO: I wish you could pass all this stuff in.
-	// it's kind of messy as is.
-	nodes := make(map[osm.NodeID]*osm.Node, len(ctx.OSM.Nodes))
-	for _, n := range ctx.OSM.Nodes {
-		nodes[n.ID] = n
-	}
-
-	ctx.WayMembership = make(map[osm.NodeID]osm.Ways)
-	for _, w := range ctx.OSM.Ways {
-		for _, wn := range w.Nodes {
-			if n, ok := nodes[wn.ID]; ok && len(n.Tags) == 0 {
-				continue
-			}
-			ctx.WayMembership[wn.ID] = append(ctx.WayMembership[wn.ID], w)
-		}
-	}
-
-	ctx.RelationMembership = make(map[osm.FeatureID]osm.Relations)
-	for _, r := range ctx.OSM.Relations {
-		for _, m := range r.Members {
-			ctx.RelationMembership[m.FeatureID()] = append(ctx.RelationMembership[m.FeatureID()], r)
-		}
-	}
-}
-
-func convertToGeoJSON(data *osm.OSM, bound orb.Bound) (*geojson.FeatureCollection, error) {
-	fc, err := osmgeojson.Convert(data,
-		osmgeojson.IncludeInvalidPolygons(true),
-		osmgeojson.NoID(true),
-		osmgeojson.NoMeta(true),
-		osmgeojson.NoRelationMembership(true),
-	)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-
-	// The osmgeojson.IncludeInvalidPolygons option will allow us to get
-	// polygons with open outer rings or even completely missing outer rings
-	// if just the inners intersect the bounds. The missing outer rings need to be
-	// replaced with the bound. Open outer rings will "cropped and wrapped" towards
-	// the end of the whole process.
-	padded := geo.BoundPad(bound, geo.BoundWidth(bound))
-	for _, f := range fc.Features {
-		switch g := f.Geometry.(type) {
-		case orb.MultiPolygon:
-			for _, p := range g {
-				if len(p) > 0 && p[0] == nil {
-					p[0] = padded.ToRing()
-				}
-			}
-		case orb.Polygon:
-			if len(g) > 0 && g[0] == nil {
-				g[0] = padded.ToRing()
-			}
-		}
+// Err returns the error of the context if it's done.
+func (ctx *zenContext) Err() error {
+	if ctx.Context == nil {
+		return nil
 	}
 
-	return fc, nil
+	return ctx.Context.Err()
 }
 
 func stringIn(val string, list []string) bool {
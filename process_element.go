@@ -0,0 +1,142 @@
+package osmzen
+
+import (
+	"context"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+// DefaultLayerOrder is the default priority order of the layers when
+// processing a single element. Try to match the most reasonable first.
+var DefaultLayerOrder = []string{
+	"pois",
+	"roads",
+	"buildings",
+	"landuse",
+	"water",
+	"places",
+
+	"boundaries",
+	"transit",
+	"earth",
+}
+
+// ElementOptions define how a single element is processed.
+type ElementOptions struct {
+	// Zoom is used for the min_zoom cut and the post processing.
+	// Defaults to 20, to include everything, if nil.
+	Zoom *maptile.Zoom
+
+	// Bound is used for clipping and to check if the label points are included.
+	// Defaults to the whole world.
+	Bound orb.Bound
+
+	// LayerOrder is the priority order of the layers in the result.
+	// Layers not in the list are after, in the config order.
+	// Defaults to DefaultLayerOrder.
+	LayerOrder []string
+}
+
+// ElementLayer is the result of processing an element for one layer.
+type ElementLayer struct {
+	Layer      string
+	MinZoom    float64
+	Properties geojson.Properties
+
+	// Labels are the label points generated for the element
+	// by the post processing.
+	Labels []*geojson.Feature
+}
+
+// ProcessElement will convert a single osm element to [layer, properties].
+// It will return the first matching layer using the DefaultLayerOrder.
+func (c *Config) ProcessElement(e osm.Element) (layer string, props geojson.Properties, err error) {
+	layers, err := c.ProcessElementAll(e, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(layers) == 0 {
+		return "", nil, errors.New("not found")
+	}
+
+	return layers[0].Layer, layers[0].Properties, nil
+}
+
+// ProcessElementAll will convert a single osm element and return every layer
+// it is in, sorted by the layer order. For example, a school building will
+// be in the pois and buildings layers. Ways must have the node locations
+// set on the way nodes. Options can be nil to use the defaults.
+func (c *Config) ProcessElementAll(e osm.Element, opts *ElementOptions) ([]*ElementLayer, error) {
+	o := ElementOptions{}
+	if opts != nil {
+		o = *opts
+	}
+
+	zoom := maptile.Zoom(20)
+	if o.Zoom != nil {
+		zoom = *o.Zoom
+	}
+
+	if o.Bound.IsZero() {
+		o.Bound = orb.Bound{Min: orb.Point{-180, -90}, Max: orb.Point{180, 90}}
+	}
+
+	if o.LayerOrder == nil {
+		o.LayerOrder = DefaultLayerOrder
+	}
+
+	data := &osm.OSM{}
+	data.Append(e)
+
+	layers, err := c.process(context.Background(), data, o.Bound, zoom)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*ElementLayer
+	add := func(name string) {
+		layer := layers[name]
+		if layer == nil {
+			return
+		}
+
+		var el *ElementLayer
+		var labels []*geojson.Feature
+		for _, f := range layer.Features {
+			if f.Properties.MustBool("label_placement", false) {
+				labels = append(labels, f)
+			} else if el == nil {
+				el = &ElementLayer{
+					Layer:      name,
+					MinZoom:    f.Properties.MustFloat64("min_zoom", 0),
+					Properties: f.Properties,
+				}
+			}
+		}
+
+		if el != nil {
+			el.Labels = labels
+			result = append(result, el)
+		}
+	}
+
+	for _, name := range o.LayerOrder {
+		if _, ok := c.Layers[name]; ok {
+			add(name)
+		}
+	}
+
+	// layers not in the order are after, in the config order.
+	for _, name := range c.All {
+		if !stringIn(name, o.LayerOrder) {
+			add(name)
+		}
+	}
+
+	return result, nil
+}
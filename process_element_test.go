@@ -0,0 +1,149 @@
+package osmzen
+
+import (
+	"testing"
+
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/osm"
+)
+
+func TestProcessElementAll(t *testing.T) {
+	config, err := Load("config/queries.yaml")
+	if err != nil {
+		t.Fatalf("unable to load layer: %v", err)
+	}
+
+	zoom := func(z maptile.Zoom) *maptile.Zoom { return &z }
+
+	square := osm.WayNodes{
+		{ID: 1, Lat: 0, Lon: 0},
+		{ID: 2, Lat: 0, Lon: 0.001},
+		{ID: 3, Lat: 0.001, Lon: 0.001},
+		{ID: 4, Lat: 0.001, Lon: 0},
+		{ID: 1, Lat: 0, Lon: 0},
+	}
+
+	school := &osm.Way{
+		ID:    1,
+		Nodes: square,
+		Tags: osm.Tags{
+			{Key: "amenity", Value: "school"},
+			{Key: "building", Value: "yes"},
+			{Key: "name", Value: "School"},
+		},
+	}
+
+	lake := &osm.Way{
+		ID:    2,
+		Nodes: square,
+		Tags: osm.Tags{
+			{Key: "natural", Value: "water"},
+			{Key: "name", Value: "Lake"},
+		},
+	}
+
+	cases := []struct {
+		name    string
+		element osm.Element
+		opts    *ElementOptions
+		layers  []string
+		labels  int
+	}{
+		{
+			name:    "all layers",
+			element: school,
+			layers:  []string{"pois", "buildings"},
+		},
+		{
+			name:    "layer order",
+			element: school,
+			opts:    &ElementOptions{LayerOrder: []string{"buildings"}},
+			layers:  []string{"buildings", "pois"},
+		},
+		{
+			name:    "zoom",
+			element: school,
+			opts:    &ElementOptions{Zoom: zoom(14)},
+			layers:  []string{"buildings"},
+		},
+		{
+			name:    "zoom 0",
+			element: school,
+			opts:    &ElementOptions{Zoom: zoom(0)},
+			layers:  nil,
+		},
+		{
+			name:    "labels",
+			element: lake,
+			layers:  []string{"water"},
+			labels:  1,
+		},
+		{
+			name:    "no layers",
+			element: &osm.Node{ID: 1, Lat: 1, Lon: 1, Version: 1},
+			layers:  nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			layers, err := config.ProcessElementAll(tc.element, tc.opts)
+			if err != nil {
+				t.Fatalf("process error: %v", err)
+			}
+
+			if len(layers) != len(tc.layers) {
+				t.Fatalf("incorrect number of layers: %v", len(layers))
+			}
+
+			labels := 0
+			for i, l := range layers {
+				if l.Layer != tc.layers[i] {
+					t.Errorf("incorrect layer: %v != %v", l.Layer, tc.layers[i])
+				}
+
+				if l.MinZoom != l.Properties["min_zoom"] {
+					t.Errorf("incorrect min zoom: %v", l.MinZoom)
+				}
+
+				labels += len(l.Labels)
+			}
+
+			if labels != tc.labels {
+				t.Errorf("incorrect number of labels: %v", labels)
+			}
+		})
+	}
+}
+
+func TestProcessElement(t *testing.T) {
+	config, err := Load("config/queries.yaml")
+	if err != nil {
+		t.Fatalf("unable to load layer: %v", err)
+	}
+
+	node := &osm.Node{
+		ID:      1,
+		Lat:     1,
+		Lon:     1,
+		Version: 1,
+		Tags: osm.Tags{
+			{Key: "amenity", Value: "cafe"},
+			{Key: "name", Value: "Cafe"},
+		},
+	}
+
+	layer, props, err := config.ProcessElement(node)
+	if err != nil {
+		t.Fatalf("process error: %v", err)
+	}
+
+	if layer != "pois" || props["kind"] != "cafe" {
+		t.Errorf("incorrect result: %v %v", layer, props)
+	}
+
+	_, _, err = config.ProcessElement(&osm.Node{ID: 2, Lat: 1, Lon: 1, Version: 1})
+	if err == nil {
+		t.Errorf("should return error if not found")
+	}
+}
@@ -0,0 +1,145 @@
+package osmzen
+
+import (
+	"context"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/clip/smartclip"
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+// defaultClipFactor is the padding used by postprocess.ClipAndWrapGeometry,
+// +50% on each side, for layers without a clip factor.
+const defaultClipFactor = 2.0
+
+// ProcessMetatile will convert the OSM data for the metatile, usually a z13 or
+// z14 tile, into the geojson layers of its children at zoom z. The data is
+// processed, including the post processing, once for the whole metatile and
+// then clipped to each child tile using the layer's clip factor. Since label
+// placements are computed once they are consistent across tile edges.
+// The options are the same as for Process and apply to every tile.
+func (c *Config) ProcessMetatile(
+	data *osm.OSM,
+	metatile maptile.Tile,
+	z maptile.Zoom,
+	opts ...ProcessOption,
+) (map[maptile.Tile]map[string]*geojson.FeatureCollection, error) {
+	return c.ProcessMetatileContext(context.Background(), data, metatile, z, opts...)
+}
+
+// ProcessMetatileContext is the same as ProcessMetatile but will stop and
+// return ctx.Err() if the context is canceled.
+func (c *Config) ProcessMetatileContext(
+	goctx context.Context,
+	data *osm.OSM,
+	metatile maptile.Tile,
+	z maptile.Zoom,
+	opts ...ProcessOption,
+) (map[maptile.Tile]map[string]*geojson.FeatureCollection, error) {
+	if z < metatile.Z {
+		return nil, errors.Errorf("zoom %d less than metatile zoom %d", z, metatile.Z)
+	}
+
+	options, err := newProcessOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	pz := z + maptile.Zoom(options.zoomOffset())
+
+	// rounding is done after clipping to the child tiles,
+	// so the vertices added by the clip are also rounded.
+	processOptions := options
+	processOptions.rounded = false
+
+	bound := metatile.Bound()
+	idx := options.membershipIndex(data)
+	ctx := newZenContext(goctx, data, bound, pz, idx)
+	ctx.options = processOptions
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	layers, err := c.processElements(ctx, buildElements(data, bound, idx), pz)
+	if err != nil {
+		return nil, err
+	}
+
+	min, max := metatile.Range(z)
+
+	result := make(map[maptile.Tile]map[string]*geojson.FeatureCollection)
+	for x := min.X; x <= max.X; x++ {
+		for y := min.Y; y <= max.Y; y++ {
+			t := maptile.New(x, y, z)
+
+			result[t] = make(map[string]*geojson.FeatureCollection, len(layers))
+			for name := range layers {
+				result[t][name] = geojson.NewFeatureCollection()
+			}
+		}
+	}
+
+	factors := options.layerClipFactors(c.clipFactors)
+	for name, layer := range layers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		factor := clipFactor(factors, name)
+
+		for _, f := range layer.Features {
+			fb := f.Geometry.Bound()
+
+			minX, minY, maxX, maxY := tileRange(fb, z, (factor-1)/2, min, max)
+			for x := minX; x <= maxX; x++ {
+				for y := minY; y <= maxY; y++ {
+					t := maptile.New(x, y, z)
+
+					tb := t.Bound()
+					cb := geo.BoundPad(tb, geo.BoundHeight(tb)*(factor-1)/2)
+					if !cb.Intersects(fb) {
+						continue
+					}
+
+					if p, ok := f.Geometry.(orb.Point); ok {
+						// points are only in the padding of layers with a clip factor,
+						// e.g. building label placements.
+						if !cb.Contains(p) || (factors[name] == 0 && !tb.Contains(p)) {
+							continue
+						}
+
+						result[t][name].Append(copyFeature(f))
+						continue
+					}
+
+					nf := copyFeature(f)
+					nf.Geometry = smartclip.Geometry(cb, nf.Geometry, orb.CCW)
+					if nf.Geometry == nil {
+						continue
+					}
+
+					result[t][name].Append(nf)
+				}
+			}
+		}
+	}
+
+	for _, layers := range result {
+		options.round(layers)
+	}
+
+	return result, nil
+}
+
+// clipFactor returns the clip factor of the layer or the default
+// if the layer doesn't define one.
+func clipFactor(factors map[string]float64, name string) float64 {
+	if f := factors[name]; f != 0 {
+		return f
+	}
+
+	return defaultClipFactor
+}
@@ -0,0 +1,122 @@
+package osmzen
+
+import (
+	"context"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/orb/maptile"
+)
+
+func TestProcessMetatile(t *testing.T) {
+	config, err := Load("config/queries.yaml")
+	if err != nil {
+		t.Fatalf("unable to load layer: %v", err)
+	}
+
+	tile := maptile.New(17896, 24450, 16)
+	data := loadFile(t, tile)
+
+	metatile := tile.Parent()
+	tiles, err := config.ProcessMetatile(data, metatile, 17)
+	if err != nil {
+		t.Fatalf("process error: %v", err)
+	}
+
+	if len(tiles) != 16 {
+		t.Fatalf("incorrect number of tiles: %v", len(tiles))
+	}
+
+	labels := map[interface{}]orb.Point{}
+	for tl, layers := range tiles {
+		if len(layers) != len(config.All) {
+			t.Errorf("%v: should have all the layers: %v", tl, len(layers))
+		}
+
+		for name, fc := range layers {
+			factor := config.clipFactors[name]
+			if factor == 0 {
+				factor = defaultClipFactor
+			}
+
+			b := tl.Bound()
+			b = geo.BoundPad(b, geo.BoundHeight(b)*(factor-1)/2)
+
+			for _, f := range fc.Features {
+				if !b.Contains(f.Geometry.Bound().Min) || !b.Contains(f.Geometry.Bound().Max) {
+					t.Errorf("%v: %v: feature not clipped to the tile", tl, name)
+				}
+
+				if !f.Properties.MustBool("label_placement", false) {
+					continue
+				}
+
+				// label placements in the padding of many tiles should be the same.
+				p := f.Geometry.(orb.Point)
+				id := f.Properties["id"]
+				if l, ok := labels[id]; ok && l != p {
+					t.Errorf("%v: %v: label placement not consistent: %v != %v", tl, name, l, p)
+				}
+				labels[id] = p
+			}
+		}
+	}
+
+	if len(labels) == 0 {
+		t.Errorf("should have label placements")
+	}
+
+	if len(tiles[maptile.New(tile.X*2, tile.Y*2, 17)]["buildings"].Features) == 0 {
+		t.Errorf("should have buildings")
+	}
+
+	_, err = config.ProcessMetatile(data, metatile, 14)
+	if err == nil {
+		t.Errorf("should error if zoom less than metatile zoom")
+	}
+}
+
+func TestProcessMetatile_precision(t *testing.T) {
+	config, err := Load("config/queries.yaml")
+	if err != nil {
+		t.Fatalf("unable to load layer: %v", err)
+	}
+
+	tile := maptile.New(17896, 24450, 16)
+	data := loadFile(t, tile)
+
+	tiles, err := config.ProcessMetatile(data, tile.Parent(), 17, WithPrecision(5))
+	if err != nil {
+		t.Fatalf("process error: %v", err)
+	}
+
+	// the points added by clipping to the child tiles should also be rounded.
+	for tl, layers := range tiles {
+		for name, fc := range layers {
+			for _, f := range fc.Features {
+				if !orb.Equal(f.Geometry, orb.Round(orb.Clone(f.Geometry), 1e5)) {
+					t.Fatalf("%v: %v: geometry not rounded", tl, name)
+				}
+			}
+		}
+	}
+}
+
+func TestProcessMetatileContext(t *testing.T) {
+	config, err := Load("config/queries.yaml")
+	if err != nil {
+		t.Fatalf("unable to load layer: %v", err)
+	}
+
+	tile := maptile.New(17896, 24450, 16)
+	data := loadFile(t, tile)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = config.ProcessMetatileContext(ctx, data, tile.Parent(), 17)
+	if err != context.Canceled {
+		t.Errorf("incorrect error: %v", err)
+	}
+}
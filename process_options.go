@@ -0,0 +1,195 @@
+package osmzen
+
+import (
+	"math"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osmzen/util"
+	"github.com/pkg/errors"
+)
+
+// A ProcessOption changes how a single call to Process is done.
+type ProcessOption func(*processOptions)
+
+type processOptions struct {
+	layers      map[string]bool
+	languages   []string
+	tileSize    int
+	clipFactors map[string]float64
+	precision   int
+	rounded     bool
+	index       *MembershipIndex
+}
+
+// WithLayers limits the processing to the given layers. The other layers
+// are not computed and not in the result. Post processors that use features
+// from other layers, like the landuse overlap of pois, will only see the
+// computed layers.
+func WithLayers(names ...string) ProcessOption {
+	return func(o *processOptions) {
+		o.layers = make(map[string]bool, len(names))
+		for _, n := range names {
+			o.layers[n] = true
+		}
+	}
+}
+
+// WithLanguages keeps the `name:<lang>` properties, set by the tags_name_i18n
+// transform, for the given languages, e.g. "en" or "zh-Hans", and removes
+// the others. At least one language is required. By default all the
+// translations are included.
+func WithLanguages(langs ...string) ProcessOption {
+	return func(o *processOptions) {
+		// not nil so an empty list is an error and not the default.
+		o.languages = append([]string{}, langs...)
+	}
+}
+
+// WithTileSize sets the tile size, in pixels, the data is for. It must
+// be a power of 2 of at least 256, the default. A 512 pixel tile at zoom
+// 14 has the same level of detail, min zoom cuts and pixel area thresholds,
+// as a 256 pixel tile at zoom 15.
+func WithTileSize(size int) ProcessOption {
+	return func(o *processOptions) {
+		o.tileSize = size
+	}
+}
+
+// WithClipFactor sets the size of the bound the layer's geometry is clipped
+// to, as a ratio of the bound size. It overrides the layer's clip_factor,
+// the default is 2.0, half the bound on each side. A factor of 1.0 clips
+// to the bound.
+func WithClipFactor(layer string, factor float64) ProcessOption {
+	return func(o *processOptions) {
+		if o.clipFactors == nil {
+			o.clipFactors = make(map[string]float64)
+		}
+		o.clipFactors[layer] = factor
+	}
+}
+
+// WithPrecision rounds the output coordinates to the number of decimal places.
+// By default the coordinates are not rounded.
+func WithPrecision(digits int) ProcessOption {
+	return func(o *processOptions) {
+		o.precision = digits
+		o.rounded = true
+	}
+}
+
+func defaultProcessOptions() processOptions {
+	return processOptions{
+		tileSize: 256,
+	}
+}
+
+func newProcessOptions(opts []ProcessOption) (processOptions, error) {
+	o := defaultProcessOptions()
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.tileSize < 256 || o.tileSize&(o.tileSize-1) != 0 {
+		return o, errors.Errorf("tile size must be a power of 2 of at least 256: %d", o.tileSize)
+	}
+
+	if o.languages != nil && len(o.languages) == 0 {
+		return o, errors.New("languages must not be empty")
+	}
+
+	for _, lang := range o.languages {
+		if lang == "" {
+			return o, errors.New("language must not be empty")
+		}
+	}
+
+	if o.rounded && (o.precision < 0 || o.precision > 15) {
+		return o, errors.Errorf("precision must be from 0 to 15: %d", o.precision)
+	}
+
+	return o, nil
+}
+
+// layerClipFactors returns the clip factors of the layers in the config
+// with the WithClipFactor overrides applied.
+func (o *processOptions) layerClipFactors(config map[string]float64) map[string]float64 {
+	if len(o.clipFactors) == 0 {
+		return config
+	}
+
+	result := make(map[string]float64, len(config)+len(o.clipFactors))
+	for name, f := range config {
+		result[name] = f
+	}
+
+	for name, f := range o.clipFactors {
+		result[name] = f
+	}
+
+	return result
+}
+
+// membershipIndex returns the WithMembershipIndex index,
+// or builds one for the data.
+func (o *processOptions) membershipIndex(data *osm.OSM) *MembershipIndex {
+	if o.index != nil {
+		return o.index
+	}
+
+	return NewMembershipIndex(data)
+}
+
+// includeLayer returns true if the layer should be computed.
+func (o *processOptions) includeLayer(name string) bool {
+	return o.layers == nil || o.layers[name]
+}
+
+// zoomOffset is the number of zooms to add to get the 256 pixel tile
+// zoom with the same level of detail.
+func (o *processOptions) zoomOffset() int {
+	offset := 0
+	for s := o.tileSize; s > 256; s /= 2 {
+		offset++
+	}
+
+	return offset
+}
+
+// setLanguages removes the translations that were not requested.
+func (o *processOptions) setLanguages(result map[string]*geojson.FeatureCollection) {
+	if o.languages == nil {
+		return
+	}
+
+	keep := make(map[string]bool, len(o.languages))
+	for _, lang := range o.languages {
+		keep["name:"+lang] = true
+	}
+
+	for _, fc := range result {
+		for _, f := range fc.Features {
+			for k := range f.Properties {
+				if util.IsNameTranslation(k) && !keep[k] {
+					delete(f.Properties, k)
+				}
+			}
+		}
+	}
+}
+
+// round rounds the coordinates to the precision, if set.
+func (o *processOptions) round(result map[string]*geojson.FeatureCollection) {
+	if !o.rounded {
+		return
+	}
+
+	factor := int(math.Pow10(o.precision))
+	for _, fc := range result {
+		for _, f := range fc.Features {
+			f.Geometry = orb.Round(f.Geometry, factor)
+		}
+	}
+}
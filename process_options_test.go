@@ -0,0 +1,208 @@
+package osmzen
+
+import (
+	"math"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/osm"
+)
+
+func TestProcess_options(t *testing.T) {
+	config, err := Load("config/queries.yaml")
+	if err != nil {
+		t.Fatalf("unable to load layer: %v", err)
+	}
+
+	tile := maptile.New(17896, 24450, 16)
+	data := loadFile(t, tile)
+
+	t.Run("layers", func(t *testing.T) {
+		result, err := config.Process(data, tile.Bound(), tile.Z, WithLayers("pois", "roads"))
+		if err != nil {
+			t.Fatalf("process error: %v", err)
+		}
+
+		if len(result) != 2 || result["pois"] == nil || result["roads"] == nil {
+			t.Errorf("incorrect layers: %v", len(result))
+		}
+
+		if len(result["roads"].Features) == 0 {
+			t.Errorf("no roads")
+		}
+	})
+
+	t.Run("tile size", func(t *testing.T) {
+		parent := tile.Parent()
+		expected, err := config.Process(data, parent.Bound(), parent.Z+1)
+		if err != nil {
+			t.Fatalf("process error: %v", err)
+		}
+
+		result, err := config.Process(data, parent.Bound(), parent.Z, WithTileSize(512))
+		if err != nil {
+			t.Fatalf("process error: %v", err)
+		}
+
+		for name, fc := range expected {
+			if l := len(result[name].Features); l != len(fc.Features) {
+				t.Errorf("%s: incorrect number of features: %v != %v", name, l, len(fc.Features))
+			}
+		}
+
+		_, err = config.Process(data, tile.Bound(), tile.Z, WithTileSize(300))
+		if err == nil {
+			t.Errorf("expected error for invalid tile size")
+		}
+	})
+
+	t.Run("clip factor", func(t *testing.T) {
+		result, err := config.Process(data, tile.Bound(), tile.Z, WithClipFactor("roads", 1))
+		if err != nil {
+			t.Fatalf("process error: %v", err)
+		}
+
+		bound := tile.Bound()
+		for _, f := range result["roads"].Features {
+			b := f.Geometry.Bound()
+			if !bound.Contains(b.Min) || !bound.Contains(b.Max) {
+				t.Errorf("road not clipped to the bound: %v", b)
+				break
+			}
+		}
+	})
+
+	t.Run("config clip factor", func(t *testing.T) {
+		// a child tile so the buildings extend past the clip bound
+		child := tile.Children()[0]
+		padded := func(factor float64) orb.Bound {
+			b := child.Bound()
+			return geo.BoundPad(b, geo.BoundHeight(b)*(factor-1)/2)
+		}
+
+		// buildings have a clip_factor of 3.0 in the config
+		result, err := config.Process(data, child.Bound(), child.Z)
+		if err != nil {
+			t.Fatalf("process error: %v", err)
+		}
+
+		outside := false
+		for _, f := range result["buildings"].Features {
+			b := f.Geometry.Bound()
+			if !padded(3.0).Contains(b.Min) || !padded(3.0).Contains(b.Max) {
+				t.Fatalf("building not clipped to the bound: %v", b)
+			}
+
+			if !padded(2.0).Contains(b.Min) || !padded(2.0).Contains(b.Max) {
+				outside = true
+			}
+		}
+
+		if !outside {
+			t.Errorf("should use the config clip factor of 3.0")
+		}
+
+		// the option overrides the config
+		result, err = config.Process(data, child.Bound(), child.Z, WithClipFactor("buildings", 2.0))
+		if err != nil {
+			t.Fatalf("process error: %v", err)
+		}
+
+		for _, f := range result["buildings"].Features {
+			b := f.Geometry.Bound()
+			if !padded(2.0).Contains(b.Min) || !padded(2.0).Contains(b.Max) {
+				t.Fatalf("building not clipped to the option bound: %v", b)
+			}
+		}
+	})
+
+	t.Run("precision", func(t *testing.T) {
+		result, err := config.Process(data, tile.Bound(), tile.Z, WithPrecision(3))
+		if err != nil {
+			t.Fatalf("process error: %v", err)
+		}
+
+		for _, f := range result["roads"].Features {
+			b := f.Geometry.Bound()
+			for _, v := range []float64{b.Min[0], b.Min[1], b.Max[0], b.Max[1]} {
+				if math.Abs(v*1000-math.Round(v*1000)) > 1e-6 {
+					t.Fatalf("coordinate not rounded: %v", v)
+				}
+			}
+		}
+
+		for _, p := range []int{-1, 16} {
+			_, err = config.Process(data, tile.Bound(), tile.Z, WithPrecision(p))
+			if err == nil {
+				t.Errorf("expected error for precision %d", p)
+			}
+		}
+	})
+}
+
+func TestProcess_languages(t *testing.T) {
+	config, err := Load("config/queries.yaml")
+	if err != nil {
+		t.Fatalf("unable to load layer: %v", err)
+	}
+
+	data := &osm.OSM{
+		Nodes: osm.Nodes{
+			{
+				ID:  1,
+				Lat: 1, Lon: 1,
+				Tags: osm.Tags{
+					{Key: "amenity", Value: "cafe"},
+					{Key: "name", Value: "Café"},
+					{Key: "name:en", Value: "Cafe"},
+					{Key: "name:de", Value: "Kaffee"},
+					{Key: "name:fr", Value: "Café"},
+				},
+			},
+		},
+	}
+
+	bound := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{2, 2}}
+	result, err := config.Process(data, bound, 18, WithLanguages("en", "de", "ja"))
+	if err != nil {
+		t.Fatalf("process error: %v", err)
+	}
+
+	props := result["pois"].Features[0].Properties
+	if v := props["name:en"]; v != "Cafe" {
+		t.Errorf("incorrect name:en: %v", v)
+	}
+
+	if v := props["name:de"]; v != "Kaffee" {
+		t.Errorf("incorrect name:de: %v", v)
+	}
+
+	if v, ok := props["name:fr"]; ok {
+		t.Errorf("name:fr should not be set: %v", v)
+	}
+
+	if v, ok := props["name:ja"]; ok {
+		t.Errorf("name:ja should not be set: %v", v)
+	}
+	// by default all the translations are included
+	result, err = config.Process(data, bound, 18)
+	if err != nil {
+		t.Fatalf("process error: %v", err)
+	}
+
+	props = result["pois"].Features[0].Properties
+	for _, k := range []string{"name:en", "name:de", "name:fr"} {
+		if v, ok := props[k]; !ok {
+			t.Errorf("%s should be set: %v", k, v)
+		}
+	}
+
+	for _, langs := range [][]string{nil, {"en", ""}} {
+		_, err = config.Process(data, bound, 18, WithLanguages(langs...))
+		if err == nil {
+			t.Errorf("should error for empty languages: %q", langs)
+		}
+	}
+}
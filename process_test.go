@@ -1,10 +1,13 @@
 package osmzen
 
 import (
+	"context"
 	"encoding/xml"
 	"reflect"
 	"testing"
 
+	"github.com/paulmach/osmzen/filter"
+
 	"github.com/paulmach/orb/geojson"
 	"github.com/paulmach/orb/maptile"
 	"github.com/paulmach/osm"
@@ -67,3 +70,70 @@ func TestProcess(t *testing.T) {
 		t.Errorf("incorrect properties: %v", feature.Properties)
 	}
 }
+
+func TestProcessContext(t *testing.T) {
+	config, err := Load("config/queries.yaml")
+	if err != nil {
+		t.Fatalf("unable to load layer: %v", err)
+	}
+
+	tile := maptile.New(17896, 24450, 16)
+	data := loadFile(t, tile)
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := config.ProcessContext(ctx, data, tile.Bound(), tile.Z)
+		if err != context.Canceled {
+			t.Errorf("incorrect error: %v", err)
+		}
+
+		_, err = config.Layers["pois"].ProcessContext(ctx, data, tile.Bound(), tile.Z)
+		if err != context.Canceled {
+			t.Errorf("incorrect error: %v", err)
+		}
+	})
+
+	t.Run("not canceled", func(t *testing.T) {
+		layers, err := config.ProcessContext(context.Background(), data, tile.Bound(), tile.Z)
+		if err != nil {
+			t.Fatalf("process error: %v", err)
+		}
+
+		if len(layers["buildings"].Features) == 0 {
+			t.Errorf("should have buildings")
+		}
+	})
+}
+
+func TestLayerIndex(t *testing.T) {
+	config, err := Load("config/queries.yaml")
+	if err != nil {
+		t.Fatalf("unable to load layer: %v", err)
+	}
+
+	tile := maptile.New(17896, 24450, 16)
+	data := loadFile(t, tile)
+	elements := buildElements(data, tile.Bound(), NewMembershipIndex(data))
+
+	ctx := &filter.Context{}
+	for _, name := range config.All {
+		l := config.Layers[name]
+		for i := range elements {
+			ctx = filter.NewContextFromElement(ctx, &elements[i])
+
+			var expected *filter.Filter
+			for _, f := range l.filters {
+				if f.Match(ctx) {
+					expected = f
+					break
+				}
+			}
+
+			if f := l.index.Match(ctx); f != expected {
+				t.Errorf("%s: %v: index match not the first matching filter", name, elements[i].id)
+			}
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package osmzen
+
+import (
+	"context"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+// ProcessZooms will convert the OSM data for the tile into the geojson layers
+// of the tile and all its children from minZ to maxZ. The filters and transforms
+// are evaluated once, only the min_zoom cut, the post processing and clipping
+// is done for each tile. This is much faster than calling Process for each tile
+// when building a pyramid, e.g. z10-z16 for a z10 tile.
+// The min zoom must be greater than or equal to the tile's zoom.
+// The options are the same as for Process and apply to every tile.
+func (c *Config) ProcessZooms(
+	data *osm.OSM,
+	tile maptile.Tile,
+	minZ, maxZ maptile.Zoom,
+	opts ...ProcessOption,
+) (map[maptile.Tile]map[string]*geojson.FeatureCollection, error) {
+	return c.ProcessZoomsContext(context.Background(), data, tile, minZ, maxZ, opts...)
+}
+
+// ProcessZoomsContext is the same as ProcessZooms but will stop and
+// return ctx.Err() if the context is canceled.
+func (c *Config) ProcessZoomsContext(
+	goctx context.Context,
+	data *osm.OSM,
+	tile maptile.Tile,
+	minZ, maxZ maptile.Zoom,
+	opts ...ProcessOption,
+) (map[maptile.Tile]map[string]*geojson.FeatureCollection, error) {
+	if minZ < tile.Z {
+		return nil, errors.Errorf("min zoom %d less than tile zoom %d", minZ, tile.Z)
+	}
+
+	if maxZ < minZ {
+		return nil, errors.Errorf("max zoom %d less than min zoom %d", maxZ, minZ)
+	}
+
+	options, err := newProcessOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	offset := maptile.Zoom(options.zoomOffset())
+
+	idx := options.membershipIndex(data)
+	ctx := newZenContext(goctx, data, tile.Bound(), maxZ+offset, idx)
+	ctx.options = options
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	input := buildElements(data, tile.Bound(), idx)
+
+	layers := make(map[string][]zoomFeature, len(c.Layers))
+	for _, name := range c.All {
+		lc, ok := c.Layers[name]
+		if !ok {
+			return nil, errors.Errorf("layer not defined: %v", name)
+		}
+
+		if !options.includeLayer(name) {
+			continue
+		}
+
+		var features []zoomFeature
+		err := lc.eachFeature(ctx, input, func(f *geojson.Feature, minZoom float64) {
+			features = append(features, zoomFeature{
+				Feature: f,
+				MinZoom: minZoom,
+				Bound:   f.Geometry.Bound(),
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+		layers[name] = features
+	}
+
+	factors := options.layerClipFactors(c.clipFactors)
+
+	result := make(map[maptile.Tile]map[string]*geojson.FeatureCollection)
+	for z := minZ; z <= maxZ; z++ {
+		tiles := c.splitByTile(layers, tile, z, offset, factors)
+		for t, tl := range tiles {
+			tctx := *ctx
+			tctx.Zoom = t.Z + offset
+			tctx.Bound = t.Bound()
+
+			r, err := c.postProcess(&tctx, tl, t.Z+offset)
+			if err != nil {
+				return nil, err
+			}
+
+			result[t] = r
+		}
+	}
+
+	return result, nil
+}
+
+// zoomFeature is a feature evaluated once to be used in many tiles.
+type zoomFeature struct {
+	Feature *geojson.Feature
+	MinZoom float64
+	Bound   orb.Bound
+}
+
+// splitByTile copies the features into the children of the tile at the zoom.
+// Features are included if they are visible at the zoom, plus the tile size
+// offset, and would not be completely removed when clipped.
+func (c *Config) splitByTile(
+	layers map[string][]zoomFeature,
+	tile maptile.Tile,
+	z, offset maptile.Zoom,
+	clipFactors map[string]float64,
+) map[maptile.Tile]map[string]*geojson.FeatureCollection {
+	min, max := tile.Range(z)
+
+	result := make(map[maptile.Tile]map[string]*geojson.FeatureCollection)
+	for x := min.X; x <= max.X; x++ {
+		for y := min.Y; y <= max.Y; y++ {
+			t := maptile.New(x, y, z)
+
+			result[t] = make(map[string]*geojson.FeatureCollection, len(layers))
+			for _, name := range c.All {
+				result[t][name] = geojson.NewFeatureCollection()
+			}
+		}
+	}
+
+	for name, features := range layers {
+		factor := clipFactor(clipFactors, name)
+		for _, f := range features {
+			// zoom 12 tile, return all features with [0, 13) min_zoom
+			if float64(z+offset+1) < f.MinZoom {
+				continue
+			}
+
+			minX, minY, maxX, maxY := tileRange(f.Bound, z, (factor-1)/2, min, max)
+			for x := minX; x <= maxX; x++ {
+				for y := minY; y <= maxY; y++ {
+					t := maptile.New(x, y, z)
+					if !inTile(f, t, factor) {
+						continue
+					}
+
+					result[t][name].Append(copyFeature(f.Feature))
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// inTile returns true if the feature would be in the tile. Points must be
+// in the tile, other geometry must intersect the clip bound of the tile
+// for the layer's clip factor.
+func inTile(f zoomFeature, t maptile.Tile, factor float64) bool {
+	b := t.Bound()
+	if p, ok := f.Feature.Geometry.(orb.Point); ok {
+		return b.Contains(p)
+	}
+
+	// same padding as postprocess.ClipAndWrapGeometry
+	return geo.BoundPad(b, geo.BoundHeight(b)*(factor-1)/2).Intersects(f.Bound)
+}
+
+// copyFeature copies the feature so it can be modified by the post
+// processors of each tile. Slice values, e.g. mz_networks, are copied
+// since they're appended to by the post processors. The original "tags"
+// map is shared, it is only read.
+func copyFeature(f *geojson.Feature) *geojson.Feature {
+	c := geojson.NewFeature(orb.Clone(f.Geometry))
+	c.Properties = f.Properties.Clone()
+
+	for k, v := range c.Properties {
+		switch v := v.(type) {
+		case []string:
+			c.Properties[k] = append([]string(nil), v...)
+		case []interface{}:
+			c.Properties[k] = append([]interface{}(nil), v...)
+		}
+	}
+
+	return c
+}
+
+// tileRange returns the range of tiles, between min and max, the bound
+// could be in. The pad, in number of tiles, is added on each side for
+// the clip padding. The tiles still need to be checked if they contain
+// the feature.
+func tileRange(b orb.Bound, z maptile.Zoom, pad float64, min, max maptile.Tile) (minX, minY, maxX, maxY uint32) {
+	fmin := maptile.Fraction(orb.Point{b.Min[0], b.Max[1]}, z)
+	fmax := maptile.Fraction(orb.Point{b.Max[0], b.Min[1]}, z)
+
+	clamp := func(v float64, min, max uint32) uint32 {
+		if v < float64(min) {
+			return min
+		}
+
+		if v > float64(max) {
+			return max
+		}
+
+		return uint32(v)
+	}
+
+	minX = clamp(fmin[0]-pad, min.X, max.X)
+	maxX = clamp(fmax[0]+pad, min.X, max.X)
+	minY = clamp(fmin[1]-pad, min.Y, max.Y)
+	maxY = clamp(fmax[1]+pad, min.Y, max.Y)
+
+	return minX, minY, maxX, maxY
+}
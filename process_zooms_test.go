@@ -0,0 +1,156 @@
+package osmzen
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+)
+
+func TestProcessZooms(t *testing.T) {
+	config, err := Load("config/queries.yaml")
+	if err != nil {
+		t.Fatalf("unable to load layer: %v", err)
+	}
+
+	tile := maptile.New(17896, 24450, 16)
+	data := loadFile(t, tile)
+
+	t.Run("same as process", func(t *testing.T) {
+		tiles, err := config.ProcessZooms(data, tile, 16, 16)
+		if err != nil {
+			t.Fatalf("process error: %v", err)
+		}
+
+		expected, err := config.Process(data, tile.Bound(), tile.Z)
+		if err != nil {
+			t.Fatalf("process error: %v", err)
+		}
+
+		if len(tiles) != 1 {
+			t.Fatalf("should have one tile: %v", len(tiles))
+		}
+
+		d1, _ := json.Marshal(tiles[tile])
+		d2, _ := json.Marshal(expected)
+		if string(d1) != string(d2) {
+			t.Errorf("should be the same as process")
+		}
+	})
+
+	t.Run("children", func(t *testing.T) {
+		parent := tile.Parent()
+		tiles, err := config.ProcessZooms(data, parent, 15, 17)
+		if err != nil {
+			t.Fatalf("process error: %v", err)
+		}
+
+		if len(tiles) != 1+4+16 {
+			t.Fatalf("incorrect number of tiles: %v", len(tiles))
+		}
+
+		for tl, layers := range tiles {
+			if len(layers) != len(config.All) {
+				t.Errorf("%v: should have all the layers: %v", tl, len(layers))
+			}
+
+			for name, fc := range layers {
+				for _, f := range fc.Features {
+					if mz := f.Properties.MustFloat64("min_zoom"); mz > float64(tl.Z+1) {
+						t.Errorf("%v: %v: feature with min zoom %v", tl, name, mz)
+					}
+
+					if _, ok := f.Properties["tags"]; ok {
+						t.Errorf("%v: %v: should remove tags", tl, name)
+					}
+				}
+			}
+		}
+
+		if len(tiles[tile]["buildings"].Features) == 0 {
+			t.Errorf("should have buildings")
+		}
+	})
+
+	t.Run("options", func(t *testing.T) {
+		tiles, err := config.ProcessZooms(data, tile.Parent(), 15, 16, WithLayers("roads"))
+		if err != nil {
+			t.Fatalf("process error: %v", err)
+		}
+
+		for tl, layers := range tiles {
+			if len(layers) != 1 || layers["roads"] == nil {
+				t.Errorf("%v: should only have roads: %v", tl, len(layers))
+			}
+		}
+
+		_, err = config.ProcessZooms(data, tile, 16, 16, WithTileSize(300))
+		if err == nil {
+			t.Errorf("should error for invalid options")
+		}
+	})
+
+	t.Run("invalid zooms", func(t *testing.T) {
+		_, err := config.ProcessZooms(data, tile, 15, 16)
+		if err == nil {
+			t.Errorf("should error if min zoom less than tile zoom")
+		}
+
+		_, err = config.ProcessZooms(data, tile, 17, 16)
+		if err == nil {
+			t.Errorf("should error if max zoom less than min zoom")
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := config.ProcessZoomsContext(ctx, data, tile, 16, 17)
+		if err != context.Canceled {
+			t.Errorf("incorrect error: %v", err)
+		}
+	})
+}
+
+func TestInTile(t *testing.T) {
+	tile := maptile.New(17896, 24450, 16)
+	b := tile.Bound()
+	h := b.Max[1] - b.Min[1]
+
+	// a line 0.75 tiles above the tile
+	ls := orb.LineString{
+		{b.Min[0], b.Max[1] + 0.75*h},
+		{b.Max[0], b.Max[1] + 0.75*h},
+	}
+	f := zoomFeature{Feature: geojson.NewFeature(ls), Bound: ls.Bound()}
+
+	if inTile(f, tile, 2.0) {
+		t.Errorf("should not be in the tile with a half tile padding")
+	}
+
+	if !inTile(f, tile, 3.0) {
+		t.Errorf("should be in the tile with a one tile padding")
+	}
+}
+
+func TestCopyFeature(t *testing.T) {
+	f := geojson.NewFeature(orb.Point{1, 2})
+	f.Properties["mz_networks"] = []string{"road", "US:I", "95"}
+	f.Properties["values"] = []interface{}{"a", 1}
+
+	c := copyFeature(f)
+	c.Properties["mz_networks"].([]string)[0] = "bus"
+	c.Properties["values"].([]interface{})[0] = "b"
+
+	if v := f.Properties["mz_networks"].([]string)[0]; v != "road" {
+		t.Errorf("should not share string slices: %v", v)
+	}
+
+	if v := f.Properties["values"].([]interface{})[0]; v != "a" {
+		t.Errorf("should not share interface slices: %v", v)
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/paulmach/orb/maptile"
+)
+
+type cacheKey struct {
+	tile   maptile.Tile
+	format format
+}
+
+// cache is a least recently used cache of encoded tiles.
+type cache struct {
+	size int
+
+	lock    sync.Mutex
+	list    *list.List
+	entries map[cacheKey]*list.Element
+}
+
+type cacheItem struct {
+	key   cacheKey
+	entry *entry
+}
+
+func newCache(size int) *cache {
+	return &cache{
+		size:    size,
+		list:    list.New(),
+		entries: make(map[cacheKey]*list.Element),
+	}
+}
+
+// Get returns the entry for the key or nil if not found.
+func (c *cache) Get(key cacheKey) *entry {
+	if c.size <= 0 {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	el := c.entries[key]
+	if el == nil {
+		return nil
+	}
+
+	c.list.MoveToFront(el)
+	return el.Value.(*cacheItem).entry
+}
+
+// Add adds the entry, removing the least recently used if the cache is full.
+func (c *cache) Add(key cacheKey, e *entry) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if el := c.entries[key]; el != nil {
+		el.Value.(*cacheItem).entry = e
+		c.list.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.list.PushFront(&cacheItem{key: key, entry: e})
+
+	for c.list.Len() > c.size {
+		el := c.list.Back()
+		c.list.Remove(el)
+		delete(c.entries, el.Value.(*cacheItem).key)
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+)
+
+type format int
+
+const (
+	formatMVT format = iota + 1
+	formatJSON
+)
+
+var formats = map[string]format{
+	"mvt":  formatMVT,
+	"json": formatJSON,
+}
+
+func (f format) contentType() string {
+	if f == formatMVT {
+		return "application/vnd.mapbox-vector-tile"
+	}
+
+	return "application/json"
+}
+
+func (f format) encode(layers map[string]*geojson.FeatureCollection, tile maptile.Tile) ([]byte, error) {
+	if f == formatJSON {
+		return json.Marshal(layers)
+	}
+
+	for _, fc := range layers {
+		for _, feature := range fc.Features {
+			mvtProperties(feature.Properties)
+		}
+	}
+
+	ls := mvt.NewLayers(layers)
+	ls.ProjectToTile(tile)
+	ls.Clip(mvt.MapboxGLDefaultExtentBound)
+	ls.RemoveEmpty(0, 0)
+
+	return mvt.Marshal(ls)
+}
+
+// mvtProperties removes the values that can not be encoded in a vector tile.
+// Only strings, numbers and booleans are supported.
+func mvtProperties(props geojson.Properties) {
+	for k, v := range props {
+		switch v.(type) {
+		case string, bool, float64, float32,
+			int, int8, int16, int32, int64,
+			uint, uint8, uint16, uint32, uint64:
+		default:
+			delete(props, k)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+// Package server implements an http.Handler that serves osmzen tiles
+// as Mapbox vector tiles or GeoJSON using a pluggable data source.
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/osmzen"
+	"github.com/paulmach/osmzen/source"
+	"github.com/pkg/errors"
+)
+
+// The defaults used if the option is not set.
+const (
+	DefaultMinZoom   = maptile.Zoom(14)
+	DefaultMaxZoom   = maptile.Zoom(20)
+	DefaultTimeout   = 30 * time.Second
+	DefaultCacheSize = 1024
+)
+
+// Options define how the tiles are served.
+type Options struct {
+	// MinZoom and MaxZoom are the range of zooms that are served.
+	// Tiles outside this range return a 404. The processing is only
+	// designed for zoom 14+ tiles. Defaults to 14 and 20.
+	MinZoom maptile.Zoom
+	MaxZoom maptile.Zoom
+
+	// Timeout is the max time to load and process a tile.
+	// Defaults to 30 seconds.
+	Timeout time.Duration
+
+	// CacheSize is the number of encoded tiles kept in memory.
+	// Defaults to 1024, set to a negative number to disable the cache.
+	CacheSize int
+
+	// MaxAge sets the Cache-Control max-age of the tiles if non-zero.
+	MaxAge time.Duration
+
+	// CORSOrigin is the value of the Access-Control-Allow-Origin header.
+	// Defaults to "*", set to "-" to not include the header.
+	CORSOrigin string
+
+	// URL is the public base url of the tiles used in the TileJSON document.
+	// If empty the url is built from the request, it should be set if
+	// the server is behind http.StripPrefix or a proxy.
+	URL string
+
+	// ErrorLog logs the errors when processing tiles.
+	// If nil, the default logger from the log package is used.
+	ErrorLog *log.Logger
+}
+
+// Server is an http.Handler that serves the tiles at the paths:
+//
+//	/{z}/{x}/{y}.mvt  - Mapbox vector tile
+//	/{z}/{x}/{y}.json - GeoJSON feature collections by layer
+//	/tilejson.json    - TileJSON document describing the tiles
+//
+// Use http.StripPrefix to serve under a sub path.
+type Server struct {
+	config *osmzen.Config
+	source source.Source
+	opts   Options
+	cache  *cache
+
+	vectorLayers []osmzen.VectorLayer
+}
+
+// New creates a new server that processes data from the source using the config.
+func New(config *osmzen.Config, src source.Source, opts Options) *Server {
+	if opts.MinZoom == 0 {
+		opts.MinZoom = DefaultMinZoom
+	}
+
+	if opts.MaxZoom == 0 {
+		opts.MaxZoom = DefaultMaxZoom
+	}
+
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	if opts.CacheSize == 0 {
+		opts.CacheSize = DefaultCacheSize
+	}
+
+	if opts.CORSOrigin == "" {
+		opts.CORSOrigin = "*"
+	}
+
+	if opts.ErrorLog == nil {
+		opts.ErrorLog = log.New(log.Writer(), "", log.LstdFlags)
+	}
+
+	return &Server{
+		config: config,
+		source: src,
+		opts:   opts,
+		cache:  newCache(opts.CacheSize),
+
+		vectorLayers: config.Catalog().VectorLayers(),
+	}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.opts.CORSOrigin != "-" {
+		w.Header().Set("Access-Control-Allow-Origin", s.opts.CORSOrigin)
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodOptions:
+		w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "If-None-Match")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if path == "tilejson.json" {
+		s.serveTileJSON(w, r)
+		return
+	}
+
+	tile, format, err := parsePath(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if tile.Z < s.opts.MinZoom || tile.Z > s.opts.MaxZoom {
+		http.Error(w, fmt.Sprintf("zoom must be between %d and %d", s.opts.MinZoom, s.opts.MaxZoom), http.StatusNotFound)
+		return
+	}
+
+	s.serveTile(w, r, tile, format)
+}
+
+func (s *Server) serveTile(w http.ResponseWriter, r *http.Request, tile maptile.Tile, f format) {
+	key := cacheKey{tile: tile, format: f}
+
+	e := s.cache.Get(key)
+	if e == nil {
+		ctx, cancel := context.WithTimeout(r.Context(), s.opts.Timeout)
+		defer cancel()
+
+		body, err := s.tile(ctx, tile, f)
+		if err != nil {
+			s.serveError(ctx, w, r, tile, err)
+			return
+		}
+
+		e = newEntry(body)
+		s.cache.Add(key, e)
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", f.contentType())
+	h.Set("ETag", e.etag)
+	h.Set("Vary", "Accept-Encoding")
+	if s.opts.MaxAge > 0 {
+		h.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(s.opts.MaxAge/time.Second)))
+	}
+
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatch(match, e.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	body := e.body
+	if acceptsGzip(r) {
+		h.Set("Content-Encoding", "gzip")
+		body = e.gzipped
+	}
+
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// tile loads the data and returns the encoded tile.
+func (s *Server) tile(ctx context.Context, tile maptile.Tile, f format) ([]byte, error) {
+	data, err := s.source.Bound(ctx, tile.Bound())
+	if err != nil {
+		return nil, errors.WithMessage(err, "source")
+	}
+
+	layers, err := s.config.ProcessContext(ctx, data, tile.Bound(), tile.Z)
+	if err != nil {
+		return nil, errors.WithMessage(err, "process")
+	}
+
+	return f.encode(layers, tile)
+}
+
+func (s *Server) serveError(ctx context.Context, w http.ResponseWriter, r *http.Request, tile maptile.Tile, err error) {
+	switch {
+	case r.Context().Err() != nil:
+		// the client went away, nobody to respond to.
+		return
+	case ctx.Err() == context.DeadlineExceeded:
+		s.opts.ErrorLog.Printf("tile %d/%d/%d: timeout: %v", tile.Z, tile.X, tile.Y, err)
+		http.Error(w, "timeout", http.StatusGatewayTimeout)
+	default:
+		s.opts.ErrorLog.Printf("tile %d/%d/%d: %v", tile.Z, tile.X, tile.Y, err)
+		http.Error(w, "unable to build tile", http.StatusInternalServerError)
+	}
+}
+
+// parsePath converts a `{z}/{x}/{y}.{format}` path to a tile.
+func parsePath(p string) (maptile.Tile, format, error) {
+	parts := strings.Split(p, "/")
+	if len(parts) != 3 {
+		return maptile.Tile{}, 0, errors.New("path must be /{z}/{x}/{y}.{mvt|json}")
+	}
+
+	dot := strings.LastIndex(parts[2], ".")
+	if dot == -1 {
+		return maptile.Tile{}, 0, errors.New("missing format, must be mvt or json")
+	}
+
+	f, ok := formats[parts[2][dot+1:]]
+	if !ok {
+		return maptile.Tile{}, 0, errors.Errorf("unsupported format: %s", parts[2][dot+1:])
+	}
+
+	nums := []string{parts[0], parts[1], parts[2][:dot]}
+	vals := make([]uint32, 3)
+	for i, n := range nums {
+		v, err := strconv.ParseUint(n, 10, 32)
+		if err != nil {
+			return maptile.Tile{}, 0, errors.Errorf("invalid tile number: %s", n)
+		}
+
+		vals[i] = uint32(v)
+	}
+
+	if vals[0] > 32 {
+		return maptile.Tile{}, 0, errors.Errorf("invalid zoom: %d", vals[0])
+	}
+
+	tile := maptile.New(vals[1], vals[2], maptile.Zoom(vals[0]))
+	if !tile.Valid() {
+		return maptile.Tile{}, 0, errors.Errorf("invalid tile: %d/%d/%d", tile.Z, tile.X, tile.Y)
+	}
+
+	return tile, f, nil
+}
+
+// entry is an encoded tile and its gzipped version.
+type entry struct {
+	body    []byte
+	gzipped []byte
+	etag    string
+}
+
+func newEntry(body []byte) *entry {
+	sum := sha1.Sum(body)
+
+	buf := &bytes.Buffer{}
+	gw, _ := gzip.NewWriterLevel(buf, gzip.DefaultCompression)
+	gw.Write(body)
+	gw.Close()
+
+	return &entry{
+		body:    body,
+		gzipped: buf.Bytes(),
+		etag:    `"` + hex.EncodeToString(sum[:]) + `"`,
+	}
+}
+
+func etagMatch(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, v := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		v = strings.TrimSpace(v)
+		if i := strings.Index(v, ";"); i != -1 {
+			if strings.TrimSpace(v[i+1:]) == "q=0" {
+				continue
+			}
+
+			v = strings.TrimSpace(v[:i])
+		}
+
+		if v == "gzip" || v == "*" {
+			return true
+		}
+	}
+
+	return false
+}
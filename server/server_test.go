@@ -0,0 +1,331 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osmzen"
+	"github.com/paulmach/osmzen/source"
+	"github.com/pkg/errors"
+)
+
+var config *osmzen.Config
+
+func init() {
+	var err error
+	config, err = osmzen.LoadDefaultConfig()
+	if err != nil {
+		panic(err)
+	}
+}
+
+var testTile = maptile.At(orb.Point{0.001, 0.001}, 16)
+
+func testSource(calls *int) source.Source {
+	return source.Func(func(ctx context.Context, bound orb.Bound) (*osm.OSM, error) {
+		if calls != nil {
+			*calls++
+		}
+
+		c := bound.Center()
+		return &osm.OSM{
+			Nodes: osm.Nodes{
+				{ID: 1, Lat: c.Lat(), Lon: c.Lon(), Visible: true,
+					Tags: osm.Tags{
+						{Key: "amenity", Value: "cafe"},
+						{Key: "name", Value: "Cafe"},
+					},
+				},
+			},
+		}, nil
+	})
+}
+
+func newTestServer(src source.Source, opts Options) *Server {
+	opts.ErrorLog = log.New(ioutil.Discard, "", 0)
+	return New(config, src, opts)
+}
+
+func get(t testing.TB, h http.Handler, path string, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestServer_tiles(t *testing.T) {
+	s := newTestServer(testSource(nil), Options{})
+	path := "/16/" + itoa(testTile.X) + "/" + itoa(testTile.Y)
+
+	t.Run("mvt", func(t *testing.T) {
+		w := get(t, s, path+".mvt")
+		if w.Code != http.StatusOK {
+			t.Fatalf("incorrect status: %v %s", w.Code, w.Body.String())
+		}
+
+		if ct := w.Header().Get("Content-Type"); ct != "application/vnd.mapbox-vector-tile" {
+			t.Errorf("incorrect content type: %v", ct)
+		}
+
+		layers, err := mvt.Unmarshal(w.Body.Bytes())
+		if err != nil {
+			t.Fatalf("unmarshal error: %v", err)
+		}
+
+		found := false
+		for _, l := range layers {
+			if l.Name == "pois" && len(l.Features) == 1 {
+				found = true
+				if k := l.Features[0].Properties["kind"]; k != "cafe" {
+					t.Errorf("incorrect kind: %v", k)
+				}
+			}
+		}
+
+		if !found {
+			t.Errorf("should have the poi")
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		w := get(t, s, path+".json")
+		if w.Code != http.StatusOK {
+			t.Fatalf("incorrect status: %v %s", w.Code, w.Body.String())
+		}
+
+		result := map[string]json.RawMessage{}
+		err := json.Unmarshal(w.Body.Bytes(), &result)
+		if err != nil {
+			t.Fatalf("unmarshal error: %v", err)
+		}
+
+		if _, ok := result["pois"]; !ok {
+			t.Errorf("should have pois layer")
+		}
+
+		if o := w.Header().Get("Access-Control-Allow-Origin"); o != "*" {
+			t.Errorf("incorrect cors header: %v", o)
+		}
+	})
+
+	t.Run("gzip", func(t *testing.T) {
+		w := get(t, s, path+".json", "Accept-Encoding", "gzip, deflate")
+		if ce := w.Header().Get("Content-Encoding"); ce != "gzip" {
+			t.Fatalf("incorrect content encoding: %v", ce)
+		}
+
+		gr, err := gzip.NewReader(bytes.NewReader(w.Body.Bytes()))
+		if err != nil {
+			t.Fatalf("gzip error: %v", err)
+		}
+
+		data, err := ioutil.ReadAll(gr)
+		if err != nil {
+			t.Fatalf("gzip error: %v", err)
+		}
+
+		if !json.Valid(data) {
+			t.Errorf("should be valid json: %s", data)
+		}
+	})
+
+	t.Run("etag", func(t *testing.T) {
+		w := get(t, s, path+".json")
+		etag := w.Header().Get("ETag")
+		if etag == "" {
+			t.Fatalf("should have etag")
+		}
+
+		w = get(t, s, path+".json", "If-None-Match", etag)
+		if w.Code != http.StatusNotModified {
+			t.Errorf("incorrect status: %v", w.Code)
+		}
+
+		if w.Body.Len() != 0 {
+			t.Errorf("should not have body")
+		}
+	})
+}
+
+func TestServer_cache(t *testing.T) {
+	calls := 0
+	s := newTestServer(testSource(&calls), Options{CacheSize: 1})
+
+	path := "/16/" + itoa(testTile.X) + "/" + itoa(testTile.Y) + ".mvt"
+	other := "/16/" + itoa(testTile.X+1) + "/" + itoa(testTile.Y) + ".mvt"
+
+	get(t, s, path)
+	get(t, s, path)
+	if calls != 1 {
+		t.Errorf("should use cache: %v", calls)
+	}
+
+	get(t, s, other)
+	get(t, s, path)
+	if calls != 3 {
+		t.Errorf("should evict least recently used: %v", calls)
+	}
+
+	calls = 0
+	s = newTestServer(testSource(&calls), Options{CacheSize: -1})
+	get(t, s, path)
+	get(t, s, path)
+	if calls != 2 {
+		t.Errorf("should not cache: %v", calls)
+	}
+}
+
+func TestServer_errors(t *testing.T) {
+	failing := source.Func(func(ctx context.Context, bound orb.Bound) (*osm.OSM, error) {
+		return nil, errors.New("failed")
+	})
+
+	slow := source.Func(func(ctx context.Context, bound orb.Bound) (*osm.OSM, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	tile := "/16/" + itoa(testTile.X) + "/" + itoa(testTile.Y) + ".mvt"
+
+	cases := []struct {
+		name   string
+		source source.Source
+		path   string
+		status int
+	}{
+		{
+			name:   "bad path",
+			path:   "/16/1.mvt",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "bad format",
+			path:   "/16/1/1.png",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "invalid tile",
+			path:   "/2/5/1.mvt",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "zoom out of range",
+			path:   "/10/1/1.mvt",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "source error",
+			source: failing,
+			path:   tile,
+			status: http.StatusInternalServerError,
+		},
+		{
+			name:   "timeout",
+			source: slow,
+			path:   tile,
+			status: http.StatusGatewayTimeout,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			src := tc.source
+			if src == nil {
+				src = testSource(nil)
+			}
+
+			s := newTestServer(src, Options{Timeout: 10 * time.Millisecond})
+			w := get(t, s, tc.path)
+			if w.Code != tc.status {
+				t.Errorf("incorrect status: %v != %v", w.Code, tc.status)
+			}
+		})
+	}
+
+	t.Run("method not allowed", func(t *testing.T) {
+		s := newTestServer(testSource(nil), Options{})
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tile, nil))
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("incorrect status: %v", w.Code)
+		}
+	})
+}
+
+func TestServer_tileJSON(t *testing.T) {
+	s := newTestServer(testSource(nil), Options{})
+
+	w := get(t, s, "http://example.com/tilejson.json")
+	if w.Code != http.StatusOK {
+		t.Fatalf("incorrect status: %v", w.Code)
+	}
+
+	tj := &TileJSON{}
+	err := json.Unmarshal(w.Body.Bytes(), tj)
+	if err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+
+	if tj.Tiles[0] != "http://example.com/{z}/{x}/{y}.mvt" {
+		t.Errorf("incorrect tiles url: %v", tj.Tiles)
+	}
+
+	if tj.MinZoom != 14 || tj.MaxZoom != 20 {
+		t.Errorf("incorrect zooms: %v %v", tj.MinZoom, tj.MaxZoom)
+	}
+
+	if len(tj.VectorLayers) != len(config.All) {
+		t.Errorf("should have all the layers: %v", tj.VectorLayers)
+	}
+
+	if f := tj.VectorLayers[0].Fields["kind"]; f != "String" {
+		t.Errorf("should have the layer fields: %v", tj.VectorLayers[0].Fields)
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	cases := []struct {
+		header   string
+		expected bool
+	}{
+		{header: "", expected: false},
+		{header: "gzip", expected: true},
+		{header: "deflate, gzip;q=1.0, *;q=0.5", expected: true},
+		{header: "gzip;q=0", expected: false},
+		{header: "br", expected: false},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", tc.header)
+
+		if v := acceptsGzip(req); v != tc.expected {
+			t.Errorf("%s: incorrect result: %v", tc.header, v)
+		}
+	}
+}
+
+func itoa(i uint32) string {
+	return strconv.Itoa(int(i))
+}
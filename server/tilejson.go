@@ -0,0 +1,76 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// TileJSON is the subset of the TileJSON 3.0.0 spec used to describe the tiles.
+// https://github.com/mapbox/tilejson-spec
+type TileJSON struct {
+	TileJSON     string        `json:"tilejson"`
+	Name         string        `json:"name,omitempty"`
+	Scheme       string        `json:"scheme"`
+	Tiles        []string      `json:"tiles"`
+	MinZoom      int           `json:"minzoom"`
+	MaxZoom      int           `json:"maxzoom"`
+	Bounds       []float64     `json:"bounds"`
+	VectorLayers []VectorLayer `json:"vector_layers"`
+}
+
+// VectorLayer describes one of the layers in the vector tiles.
+type VectorLayer struct {
+	ID     string            `json:"id"`
+	Fields map[string]string `json:"fields"`
+}
+
+// TileJSON returns the document describing the vector tiles
+// served at the base url.
+func (s *Server) TileJSON(baseURL string) *TileJSON {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	tj := &TileJSON{
+		TileJSON: "3.0.0",
+		Name:     "osmzen",
+		Scheme:   "xyz",
+		Tiles:    []string{baseURL + "/{z}/{x}/{y}.mvt"},
+		MinZoom:  int(s.opts.MinZoom),
+		MaxZoom:  int(s.opts.MaxZoom),
+		Bounds:   []float64{-180, -85.05112877980659, 180, 85.0511287798066},
+	}
+
+	for _, vl := range s.vectorLayers {
+		tj.VectorLayers = append(tj.VectorLayers, VectorLayer{
+			ID:     vl.ID,
+			Fields: vl.Fields,
+		})
+	}
+
+	return tj
+}
+
+func (s *Server) serveTileJSON(w http.ResponseWriter, r *http.Request) {
+	baseURL := s.opts.URL
+	if baseURL == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+
+		if p := r.Header.Get("X-Forwarded-Proto"); p != "" {
+			scheme = p
+		}
+
+		// relative to where this document is being served.
+		path := strings.TrimSuffix(r.URL.Path, "tilejson.json")
+		baseURL = scheme + "://" + r.Host + path
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	json.NewEncoder(w).Encode(s.TileJSON(baseURL))
+}
@@ -0,0 +1,432 @@
+package source
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+	"github.com/pkg/errors"
+)
+
+// The files that make up an index directory.
+const (
+	nodesFile     = "nodes.idx"
+	nodeTagsFile  = "node_tags.idx"
+	waysFile      = "ways.idx"
+	relationsFile = "relations.idx"
+	spatialFile   = "spatial.idx"
+	elementsFile  = "elements.dat"
+)
+
+var errUnsorted = errors.New("source: data must be sorted by type then id")
+
+// BuildIndexFromPBF builds an index in the directory from an `.osm.pbf` file.
+// The file must be sorted by type then id, as the planet and most extracts are.
+func BuildIndexFromPBF(ctx context.Context, filename, dir string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	scanner := osmpbf.New(ctx, f, runtime.GOMAXPROCS(-1))
+	defer scanner.Close()
+
+	return BuildIndex(ctx, scanner, dir)
+}
+
+// BuildIndex builds an index in the directory from the scanner. The data
+// must be sorted by type, nodes then ways then relations, then by id.
+// Node coordinates, way nodes and relation members are stored on disk.
+// The spatial index entries are sorted in chunks, written to temporary
+// files in the directory, and merged.
+func BuildIndex(ctx context.Context, scanner osm.Scanner, dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	b, err := newBuilder(dir)
+	if err != nil {
+		return err
+	}
+	defer b.closeFiles()
+
+	count := 0
+	for scanner.Scan() {
+		count++
+		if count%(1<<16) == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		switch o := scanner.Object().(type) {
+		case *osm.Node:
+			err = b.addNode(o)
+		case *osm.Way:
+			err = b.addWay(o)
+		case *osm.Relation:
+			err = b.addRelation(o)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return errors.WithMessage(err, "source: scan")
+	}
+
+	return b.finish()
+}
+
+type builder struct {
+	dir   string
+	stage osm.Type
+
+	nodes     *tableWriter
+	nodeTags  *tableWriter
+	ways      *tableWriter
+	relations *tableWriter
+
+	elements *os.File
+	ew       *bufio.Writer
+	offset   int64
+	flushed  int64
+
+	spatial spatialSorter
+	encoder encoder
+
+	nodeCursor *cursor
+	wayCursor  *cursor
+}
+
+func newBuilder(dir string) (*builder, error) {
+	b := &builder{
+		dir:     dir,
+		stage:   osm.TypeNode,
+		spatial: spatialSorter{dir: dir},
+	}
+
+	var err error
+	if b.nodes, err = createTable(filepath.Join(dir, nodesFile), true); err != nil {
+		return nil, err
+	}
+
+	if b.nodeTags, err = createTable(filepath.Join(dir, nodeTagsFile), true); err != nil {
+		b.closeFiles()
+		return nil, err
+	}
+
+	if b.ways, err = createTable(filepath.Join(dir, waysFile), true); err != nil {
+		b.closeFiles()
+		return nil, err
+	}
+
+	if b.relations, err = createTable(filepath.Join(dir, relationsFile), true); err != nil {
+		b.closeFiles()
+		return nil, err
+	}
+
+	if b.elements, err = os.Create(filepath.Join(dir, elementsFile)); err != nil {
+		b.closeFiles()
+		return nil, errors.WithStack(err)
+	}
+	b.ew = bufio.NewWriter(b.elements)
+
+	b.nodeCursor = b.nodes.table.cursor()
+	b.wayCursor = b.ways.table.cursor()
+
+	return b, nil
+}
+
+// closeFiles closes everything, used to cleanup on error.
+func (b *builder) closeFiles() {
+	for _, tw := range []*tableWriter{b.nodes, b.nodeTags, b.ways, b.relations} {
+		if tw != nil {
+			tw.f.Close()
+		}
+	}
+
+	if b.elements != nil {
+		b.elements.Close()
+	}
+
+	b.spatial.remove()
+}
+
+// setStage makes sure the data of the previous types is readable since
+// the ways need the node locations and the relations need the way bounds.
+func (b *builder) setStage(t osm.Type) error {
+	if b.stage == t {
+		return nil
+	}
+
+	if t == osm.TypeNode || (t == osm.TypeWay && b.stage == osm.TypeRelation) {
+		return errUnsorted
+	}
+	b.stage = t
+
+	if err := b.nodes.flush(); err != nil {
+		return err
+	}
+
+	return b.ways.flush()
+}
+
+func (b *builder) writeElement() (int64, error) {
+	var l [4]byte
+	binary.LittleEndian.PutUint32(l[:], uint32(len(b.encoder.buf)))
+
+	offset := b.offset
+	if _, err := b.ew.Write(l[:]); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	if _, err := b.ew.Write(b.encoder.buf); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	b.offset += int64(len(l) + len(b.encoder.buf))
+	return offset, nil
+}
+
+func (b *builder) readElement(offset int64) ([]byte, error) {
+	if offset >= b.flushed {
+		if err := b.ew.Flush(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		b.flushed = b.offset
+	}
+
+	return readRecord(b.elements, offset)
+}
+
+func (b *builder) addSpatial(id osm.FeatureID, bound orb.Bound) error {
+	for _, k := range gridKeys(bound) {
+		if err := b.spatial.add(spatialRecord{key: k, id: id}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *builder) addNode(n *osm.Node) error {
+	if err := b.setStage(osm.TypeNode); err != nil {
+		return err
+	}
+
+	err := b.nodes.add(int64(n.ID), packPoint(n.Point()))
+	if err != nil {
+		return err
+	}
+
+	if len(n.Tags) == 0 {
+		return nil
+	}
+
+	b.encoder.reset()
+	b.encoder.tags(n.Tags)
+
+	offset, err := b.writeElement()
+	if err != nil {
+		return err
+	}
+
+	if err := b.addSpatial(n.FeatureID(), n.Point().Bound()); err != nil {
+		return err
+	}
+
+	return b.nodeTags.add(int64(n.ID), uint64(offset))
+}
+
+func (b *builder) addWay(w *osm.Way) error {
+	if err := b.setStage(osm.TypeWay); err != nil {
+		return err
+	}
+
+	var (
+		bound orb.Bound
+		found bool
+	)
+
+	for _, wn := range w.Nodes {
+		v, ok, err := b.nodeCursor.find(int64(wn.ID))
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			bound, found = extendBound(bound, found, unpackPoint(v).Bound())
+		}
+	}
+
+	b.encoder.reset()
+	encodeWay(&b.encoder, w, bound, found)
+
+	offset, err := b.writeElement()
+	if err != nil {
+		return err
+	}
+
+	if found {
+		if err := b.addSpatial(w.FeatureID(), bound); err != nil {
+			return err
+		}
+	}
+
+	return b.ways.add(int64(w.ID), uint64(offset))
+}
+
+func (b *builder) addRelation(r *osm.Relation) error {
+	if err := b.setStage(osm.TypeRelation); err != nil {
+		return err
+	}
+
+	bound, found, err := b.relationBound(r)
+	if err != nil {
+		return err
+	}
+
+	b.encoder.reset()
+	encodeRelation(&b.encoder, r, bound, found)
+
+	offset, err := b.writeElement()
+	if err != nil {
+		return err
+	}
+
+	if found {
+		if err := b.addSpatial(r.FeatureID(), bound); err != nil {
+			return err
+		}
+	}
+
+	return b.relations.add(int64(r.ID), uint64(offset))
+}
+
+// relationBound is the bound of the member nodes, ways and relations.
+// Member relations after this one are not known yet and are skipped.
+func (b *builder) relationBound(r *osm.Relation) (orb.Bound, bool, error) {
+	var (
+		bound orb.Bound
+		found bool
+	)
+
+	for _, m := range r.Members {
+		switch m.Type {
+		case osm.TypeNode:
+			v, ok, err := b.nodeCursor.find(m.Ref)
+			if err != nil {
+				return bound, false, err
+			}
+
+			if ok {
+				bound, found = extendBound(bound, found, unpackPoint(v).Bound())
+			}
+		case osm.TypeWay:
+			v, ok, err := b.wayCursor.find(m.Ref)
+			if err != nil {
+				return bound, false, err
+			}
+
+			if !ok {
+				continue
+			}
+
+			data, err := b.readElement(int64(v))
+			if err != nil {
+				return bound, false, err
+			}
+
+			d := &decoder{data: data}
+			if wb, ok := d.bound(); ok {
+				bound, found = extendBound(bound, found, wb)
+			}
+		case osm.TypeRelation:
+			// the relations table is still growing so a cached block could be stale.
+			if err := b.relations.flush(); err != nil {
+				return bound, false, err
+			}
+
+			v, ok, err := b.relations.table.cursor().find(m.Ref)
+			if err != nil {
+				return bound, false, err
+			}
+
+			if !ok {
+				continue
+			}
+
+			data, err := b.readElement(int64(v))
+			if err != nil {
+				return bound, false, err
+			}
+
+			d := &decoder{data: data}
+			if rb, ok := d.bound(); ok {
+				bound, found = extendBound(bound, found, rb)
+			}
+		}
+	}
+
+	return bound, found, nil
+}
+
+func (b *builder) finish() error {
+	if err := b.ew.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := b.elements.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	b.elements = nil
+
+	for _, tw := range []*tableWriter{b.nodes, b.nodeTags, b.ways, b.relations} {
+		if err := tw.close(); err != nil {
+			return err
+		}
+	}
+	b.nodes, b.nodeTags, b.ways, b.relations = nil, nil, nil, nil
+
+	spatial, err := createTable(filepath.Join(b.dir, spatialFile), false)
+	if err != nil {
+		return err
+	}
+
+	if err := b.spatial.write(spatial); err != nil {
+		spatial.f.Close()
+		return err
+	}
+	b.spatial.remove()
+
+	return spatial.close()
+}
+
+func extendBound(b orb.Bound, ok bool, other orb.Bound) (orb.Bound, bool) {
+	if !ok {
+		return other, true
+	}
+
+	return b.Union(other), true
+}
+
+// packPoint packs the point into the 8 byte value of a node record.
+func packPoint(p orb.Point) uint64 {
+	return uint64(uint32(toFixed(p[0])))<<32 | uint64(uint32(toFixed(p[1])))
+}
+
+func unpackPoint(v uint64) orb.Point {
+	return orb.Point{
+		fromFixed(int32(uint32(v >> 32))),
+		fromFixed(int32(uint32(v))),
+	}
+}
@@ -0,0 +1,262 @@
+package source
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+// coordinates are stored as fixed point integers, the same precision osm uses.
+const coordScale = 1e7
+
+func toFixed(f float64) int32 {
+	return int32(math.Round(f * coordScale))
+}
+
+func fromFixed(i int32) float64 {
+	return float64(i) / coordScale
+}
+
+var memberTypes = []osm.Type{osm.TypeNode, osm.TypeWay, osm.TypeRelation}
+
+func memberTypeCode(t osm.Type) byte {
+	for i, mt := range memberTypes {
+		if mt == t {
+			return byte(i)
+		}
+	}
+
+	return 255
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) reset() {
+	e.buf = e.buf[:0]
+}
+
+func (e *encoder) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	e.buf = append(e.buf, b[:n]...)
+}
+
+func (e *encoder) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(b[:], v)
+	e.buf = append(e.buf, b[:n]...)
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) tags(tags osm.Tags) {
+	e.uvarint(uint64(len(tags)))
+	for _, t := range tags {
+		e.string(t.Key)
+		e.string(t.Value)
+	}
+}
+
+// bound encodes an optional bound, elements with no located members have none.
+func (e *encoder) bound(b orb.Bound, ok bool) {
+	if !ok {
+		e.buf = append(e.buf, 0)
+		return
+	}
+
+	e.buf = append(e.buf, 1)
+	e.varint(int64(toFixed(b.Min[0])))
+	e.varint(int64(toFixed(b.Min[1])))
+	e.varint(int64(toFixed(b.Max[0])))
+	e.varint(int64(toFixed(b.Max[1])))
+}
+
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = errors.New("source: corrupt index record")
+		return 0
+	}
+
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err = errors.New("source: corrupt index record")
+		return 0
+	}
+
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+
+	if len(d.data) == 0 {
+		d.err = errors.New("source: corrupt index record")
+		return 0
+	}
+
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *decoder) string() string {
+	l := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+
+	if uint64(len(d.data)) < l {
+		d.err = errors.New("source: corrupt index record")
+		return ""
+	}
+
+	s := string(d.data[:l])
+	d.data = d.data[l:]
+	return s
+}
+
+func (d *decoder) tags() osm.Tags {
+	l := d.uvarint()
+	if l == 0 || d.err != nil {
+		return nil
+	}
+
+	tags := make(osm.Tags, 0, l)
+	for i := uint64(0); i < l && d.err == nil; i++ {
+		tags = append(tags, osm.Tag{Key: d.string(), Value: d.string()})
+	}
+
+	return tags
+}
+
+func (d *decoder) bound() (orb.Bound, bool) {
+	if d.byte() == 0 {
+		return orb.Bound{}, false
+	}
+
+	b := orb.Bound{}
+	b.Min[0] = fromFixed(int32(d.varint()))
+	b.Min[1] = fromFixed(int32(d.varint()))
+	b.Max[0] = fromFixed(int32(d.varint()))
+	b.Max[1] = fromFixed(int32(d.varint()))
+
+	return b, d.err == nil
+}
+
+// encodeWay encodes the bound, tags and node ids of a way.
+func encodeWay(e *encoder, w *osm.Way, b orb.Bound, ok bool) {
+	e.bound(b, ok)
+	e.tags(w.Tags)
+	e.uvarint(uint64(len(w.Nodes)))
+
+	prev := int64(0)
+	for _, wn := range w.Nodes {
+		e.varint(int64(wn.ID) - prev)
+		prev = int64(wn.ID)
+	}
+}
+
+func decodeWay(id osm.WayID, data []byte) (*osm.Way, orb.Bound, bool, error) {
+	d := &decoder{data: data}
+	b, ok := d.bound()
+
+	w := &osm.Way{ID: id, Visible: true, Tags: d.tags()}
+
+	l := d.uvarint()
+	if d.err == nil {
+		w.Nodes = make(osm.WayNodes, 0, l)
+	}
+
+	prev := int64(0)
+	for i := uint64(0); i < l && d.err == nil; i++ {
+		prev += d.varint()
+		w.Nodes = append(w.Nodes, osm.WayNode{ID: osm.NodeID(prev)})
+	}
+
+	return w, b, ok, d.err
+}
+
+// encodeRelation encodes the bound, tags and members of a relation.
+func encodeRelation(e *encoder, r *osm.Relation, b orb.Bound, ok bool) {
+	e.bound(b, ok)
+	e.tags(r.Tags)
+	e.uvarint(uint64(len(r.Members)))
+
+	for _, m := range r.Members {
+		e.buf = append(e.buf, memberTypeCode(m.Type))
+		e.varint(m.Ref)
+		e.string(m.Role)
+	}
+}
+
+func decodeRelation(id osm.RelationID, data []byte) (*osm.Relation, orb.Bound, bool, error) {
+	d := &decoder{data: data}
+	b, ok := d.bound()
+
+	r := &osm.Relation{ID: id, Visible: true, Tags: d.tags()}
+
+	l := d.uvarint()
+	if d.err == nil {
+		r.Members = make(osm.Members, 0, l)
+	}
+
+	for i := uint64(0); i < l && d.err == nil; i++ {
+		code := d.byte()
+		m := osm.Member{Ref: d.varint(), Role: d.string()}
+		if int(code) < len(memberTypes) {
+			m.Type = memberTypes[code]
+		}
+
+		r.Members = append(r.Members, m)
+	}
+
+	return r, b, ok, d.err
+}
+
+// readRecord reads the length prefixed record at the offset.
+func readRecord(r io.ReaderAt, offset int64) ([]byte, error) {
+	var l [4]byte
+	_, err := r.ReadAt(l[:], offset)
+	if err != nil {
+		return nil, errors.WithMessage(err, "source: read record")
+	}
+
+	data := make([]byte, binary.LittleEndian.Uint32(l[:]))
+	_, err = r.ReadAt(data, offset+4)
+	if err != nil {
+		return nil, errors.WithMessage(err, "source: read record")
+	}
+
+	return data, nil
+}
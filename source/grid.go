@@ -0,0 +1,91 @@
+package source
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+)
+
+// The spatial index is a hierarchical grid of map tiles. Elements are
+// indexed at the highest zoom, up to maxGridZoom, where their bound
+// covers at most maxGridTiles tiles. A query checks the tiles covering
+// the bound at every zoom. Big elements, like coastline relations,
+// end up in a few low zoom cells instead of thousands of high zoom ones.
+const (
+	maxGridZoom  = maptile.Zoom(12)
+	maxGridTiles = 4
+)
+
+func gridKey(z maptile.Zoom, x, y uint32) int64 {
+	return int64(z)<<48 | int64(x)<<24 | int64(y)
+}
+
+// tileRange returns the min and max tile x, y covering the bound.
+func tileRange(b orb.Bound, z maptile.Zoom) (minX, minY, maxX, maxY uint32) {
+	// tile y increases going south
+	minX, minY = tileAt(orb.Point{b.Min[0], b.Max[1]}, z)
+	maxX, maxY = tileAt(orb.Point{b.Max[0], b.Min[1]}, z)
+
+	return minX, minY, maxX, maxY
+}
+
+// tileAt is maptile.At clamped to the valid tiles, points can be
+// on the antimeridian or beyond the web mercator latitude limits.
+func tileAt(p orb.Point, z maptile.Zoom) (uint32, uint32) {
+	f := maptile.Fraction(p, z)
+	max := float64(uint32(1)<<z) - 1
+
+	clamp := func(v float64) uint32 {
+		if !(v > 0) {
+			return 0
+		}
+
+		if v > max {
+			return uint32(max)
+		}
+
+		return uint32(v)
+	}
+
+	return clamp(f[0]), clamp(f[1])
+}
+
+// gridKeys returns the grid cells to index an element with the given bound.
+func gridKeys(b orb.Bound) []int64 {
+	z := maxGridZoom
+	minX, minY, maxX, maxY := tileRange(b, z)
+	for z > 0 && uint64(maxX-minX+1)*uint64(maxY-minY+1) > maxGridTiles {
+		z--
+		minX, minY, maxX, maxY = minX/2, minY/2, maxX/2, maxY/2
+	}
+
+	keys := make([]int64, 0, maxGridTiles)
+	for x := minX; x <= maxX; x++ {
+		for y := minY; y <= maxY; y++ {
+			keys = append(keys, gridKey(z, x, y))
+		}
+	}
+
+	return keys
+}
+
+// queryKeys returns the grid cells at all the zooms that cover the bound.
+func queryKeys(b orb.Bound) []int64 {
+	var keys []int64
+
+	minX, minY, maxX, maxY := tileRange(b, maxGridZoom)
+	for z := maxGridZoom; ; z-- {
+		for x := minX; x <= maxX; x++ {
+			for y := minY; y <= maxY; y++ {
+				keys = append(keys, gridKey(z, x, y))
+			}
+		}
+
+		if z == 0 {
+			break
+		}
+
+		minX, minY, maxX, maxY = minX/2, minY/2, maxX/2, maxY/2
+	}
+
+	return keys
+}
@@ -0,0 +1,376 @@
+package source
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+var _ Source = &Index{}
+
+// Index is a source backed by an on-disk index created with BuildIndex.
+// It is safe for concurrent use.
+type Index struct {
+	files    []*os.File
+	elements *os.File
+
+	nodes     *table
+	nodeTags  *table
+	ways      *table
+	relations *table
+	spatial   *table
+}
+
+// OpenIndex opens the index in the directory.
+func OpenIndex(dir string) (*Index, error) {
+	idx := &Index{}
+
+	open := func(name string) (*os.File, error) {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		idx.files = append(idx.files, f)
+		return f, nil
+	}
+
+	tables := []struct {
+		name  string
+		table **table
+	}{
+		{nodesFile, &idx.nodes},
+		{nodeTagsFile, &idx.nodeTags},
+		{waysFile, &idx.ways},
+		{relationsFile, &idx.relations},
+		{spatialFile, &idx.spatial},
+	}
+
+	for _, t := range tables {
+		f, err := open(t.name)
+		if err != nil {
+			idx.Close()
+			return nil, err
+		}
+
+		*t.table, err = openTable(f)
+		if err != nil {
+			idx.Close()
+			return nil, err
+		}
+	}
+
+	f, err := open(elementsFile)
+	if err != nil {
+		idx.Close()
+		return nil, err
+	}
+	idx.elements = f
+
+	return idx, nil
+}
+
+// Close closes the index files.
+func (idx *Index) Close() error {
+	var err error
+	for _, f := range idx.files {
+		if e := f.Close(); e != nil && err == nil {
+			err = errors.WithStack(e)
+		}
+	}
+
+	idx.files = nil
+	return err
+}
+
+// Bound returns the tagged nodes, ways and relations that intersect the bound.
+// Ways include all their nodes and relations include all their member
+// nodes and ways, with all their nodes, so the geometry is complete.
+// Member relations are included with their members too.
+func (idx *Index) Bound(ctx context.Context, bound orb.Bound) (*osm.OSM, error) {
+	q := &query{
+		idx:       idx,
+		nodes:     idx.nodes.cursor(),
+		nodeTags:  idx.nodeTags.cursor(),
+		ways:      idx.ways.cursor(),
+		relations: idx.relations.cursor(),
+
+		resultNodes:     make(map[osm.NodeID]*osm.Node),
+		resultWays:      make(map[osm.WayID]*osm.Way),
+		resultRelations: make(map[osm.RelationID]*osm.Relation),
+	}
+
+	var ids []osm.FeatureID
+	seen := make(map[osm.FeatureID]struct{})
+
+	spatial := idx.spatial.cursor()
+	for _, k := range queryKeys(bound) {
+		err := spatial.scan(k, func(v uint64) {
+			id := osm.FeatureID(v)
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				ids = append(ids, id)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// ways and relations sorted by id read the element file in order.
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for i, id := range ids {
+		if i%1000 == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		var err error
+		switch id.Type() {
+		case osm.TypeNode:
+			err = q.addNodeInBound(id.NodeID(), bound)
+		case osm.TypeWay:
+			err = q.addWayInBound(id.WayID(), bound)
+		case osm.TypeRelation:
+			err = q.addRelationInBound(id.RelationID(), bound)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := q.addWayNodes(); err != nil {
+		return nil, err
+	}
+
+	return q.result(bound), ctx.Err()
+}
+
+type query struct {
+	idx *Index
+
+	nodes     *cursor
+	nodeTags  *cursor
+	ways      *cursor
+	relations *cursor
+
+	resultNodes     map[osm.NodeID]*osm.Node
+	resultWays      map[osm.WayID]*osm.Way
+	resultRelations map[osm.RelationID]*osm.Relation
+}
+
+// node returns the node with its tags, or nil if not in the index.
+func (q *query) node(id osm.NodeID) (*osm.Node, error) {
+	v, ok, err := q.nodes.find(int64(id))
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	p := unpackPoint(v)
+	n := &osm.Node{ID: id, Lon: p[0], Lat: p[1], Visible: true}
+
+	offset, ok, err := q.nodeTags.find(int64(id))
+	if err != nil || !ok {
+		return n, err
+	}
+
+	data, err := readRecord(q.idx.elements, int64(offset))
+	if err != nil {
+		return nil, err
+	}
+
+	d := &decoder{data: data}
+	n.Tags = d.tags()
+
+	return n, d.err
+}
+
+func (q *query) way(id osm.WayID) (*osm.Way, orb.Bound, bool, error) {
+	offset, ok, err := q.ways.find(int64(id))
+	if err != nil || !ok {
+		return nil, orb.Bound{}, false, err
+	}
+
+	data, err := readRecord(q.idx.elements, int64(offset))
+	if err != nil {
+		return nil, orb.Bound{}, false, err
+	}
+
+	return decodeWay(id, data)
+}
+
+func (q *query) relation(id osm.RelationID) (*osm.Relation, orb.Bound, bool, error) {
+	offset, ok, err := q.relations.find(int64(id))
+	if err != nil || !ok {
+		return nil, orb.Bound{}, false, err
+	}
+
+	data, err := readRecord(q.idx.elements, int64(offset))
+	if err != nil {
+		return nil, orb.Bound{}, false, err
+	}
+
+	return decodeRelation(id, data)
+}
+
+func (q *query) addNode(id osm.NodeID) error {
+	if q.resultNodes[id] != nil {
+		return nil
+	}
+
+	n, err := q.node(id)
+	if err != nil {
+		return err
+	}
+
+	if n != nil {
+		q.resultNodes[id] = n
+	}
+
+	return nil
+}
+
+func (q *query) addNodeInBound(id osm.NodeID, bound orb.Bound) error {
+	n, err := q.node(id)
+	if err != nil {
+		return err
+	}
+
+	if n != nil && bound.Contains(n.Point()) {
+		q.resultNodes[id] = n
+	}
+
+	return nil
+}
+
+func (q *query) addWay(id osm.WayID) error {
+	if q.resultWays[id] != nil {
+		return nil
+	}
+
+	w, _, _, err := q.way(id)
+	if err != nil {
+		return err
+	}
+
+	if w != nil {
+		q.resultWays[id] = w
+	}
+
+	return nil
+}
+
+func (q *query) addWayInBound(id osm.WayID, bound orb.Bound) error {
+	w, b, ok, err := q.way(id)
+	if err != nil {
+		return err
+	}
+
+	if w != nil && ok && bound.Intersects(b) {
+		q.resultWays[id] = w
+	}
+
+	return nil
+}
+
+// addRelationInBound adds the relation and its members if it intersects the bound.
+func (q *query) addRelationInBound(id osm.RelationID, bound orb.Bound) error {
+	if q.resultRelations[id] != nil {
+		return nil // already added as a member of another relation
+	}
+
+	r, b, ok, err := q.relation(id)
+	if err != nil {
+		return err
+	}
+
+	if r == nil || !ok || !bound.Intersects(b) {
+		return nil
+	}
+
+	return q.addRelation(r)
+}
+
+// addRelation adds the relation and its member nodes and ways. Member
+// relations are added with their members, e.g. the routes of a route_master.
+// Relations already added are skipped, this also stops membership cycles.
+func (q *query) addRelation(r *osm.Relation) error {
+	q.resultRelations[r.ID] = r
+
+	for _, m := range r.Members {
+		var err error
+		switch m.Type {
+		case osm.TypeNode:
+			err = q.addNode(osm.NodeID(m.Ref))
+		case osm.TypeWay:
+			err = q.addWay(osm.WayID(m.Ref))
+		case osm.TypeRelation:
+			if q.resultRelations[osm.RelationID(m.Ref)] != nil {
+				continue
+			}
+
+			var child *osm.Relation
+			child, _, _, err = q.relation(osm.RelationID(m.Ref))
+			if err == nil && child != nil {
+				err = q.addRelation(child)
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addWayNodes adds all the nodes of the ways.
+func (q *query) addWayNodes() error {
+	for _, w := range q.resultWays {
+		for _, wn := range w.Nodes {
+			if err := q.addNode(wn.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (q *query) result(bound orb.Bound) *osm.OSM {
+	o := &osm.OSM{
+		Bounds: &osm.Bounds{
+			MinLat: bound.Min.Lat(),
+			MaxLat: bound.Max.Lat(),
+			MinLon: bound.Min.Lon(),
+			MaxLon: bound.Max.Lon(),
+		},
+		Nodes:     make(osm.Nodes, 0, len(q.resultNodes)),
+		Ways:      make(osm.Ways, 0, len(q.resultWays)),
+		Relations: make(osm.Relations, 0, len(q.resultRelations)),
+	}
+
+	for _, n := range q.resultNodes {
+		o.Nodes = append(o.Nodes, n)
+	}
+
+	for _, w := range q.resultWays {
+		o.Ways = append(o.Ways, w)
+	}
+
+	for _, r := range q.resultRelations {
+		o.Relations = append(o.Relations, r)
+	}
+
+	sort.Slice(o.Nodes, func(i, j int) bool { return o.Nodes[i].ID < o.Nodes[j].ID })
+	sort.Slice(o.Ways, func(i, j int) bool { return o.Ways[i].ID < o.Ways[j].ID })
+	sort.Slice(o.Relations, func(i, j int) bool { return o.Relations[i].ID < o.Relations[j].ID })
+
+	return o
+}
@@ -0,0 +1,363 @@
+package source
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmtest"
+)
+
+func testObjects() osm.Objects {
+	return osm.Objects{
+		// a small building
+		&osm.Node{ID: 1, Lat: 0.0010, Lon: 0.0010},
+		&osm.Node{ID: 2, Lat: 0.0010, Lon: 0.0020},
+		&osm.Node{ID: 3, Lat: 0.0020, Lon: 0.0020},
+
+		// a tagged node
+		&osm.Node{ID: 4, Lat: 0.0015, Lon: 0.0015, Tags: osm.Tags{{Key: "amenity", Value: "cafe"}}},
+
+		// a road that goes far outside the bound
+		&osm.Node{ID: 5, Lat: 0.0015, Lon: 0.0005},
+		&osm.Node{ID: 6, Lat: 0.5000, Lon: 0.5000},
+
+		// a multipolygon with one outer ring far away
+		&osm.Node{ID: 7, Lat: 1.0000, Lon: 1.0000},
+		&osm.Node{ID: 8, Lat: 1.0000, Lon: 1.0010},
+		&osm.Node{ID: 9, Lat: 1.0010, Lon: 1.0010},
+
+		// something that should not be included
+		&osm.Node{ID: 10, Lat: 2.0000, Lon: 2.0000, Tags: osm.Tags{{Key: "shop", Value: "bakery"}}},
+
+		&osm.Way{ID: 20,
+			Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 1}},
+			Tags:  osm.Tags{{Key: "building", Value: "yes"}},
+		},
+		&osm.Way{ID: 21,
+			Nodes: osm.WayNodes{{ID: 5}, {ID: 6}},
+			Tags:  osm.Tags{{Key: "highway", Value: "primary"}},
+		},
+		&osm.Way{ID: 22, Nodes: osm.WayNodes{{ID: 7}, {ID: 8}, {ID: 9}, {ID: 7}}},
+
+		&osm.Relation{ID: 30,
+			Members: osm.Members{
+				{Type: osm.TypeWay, Ref: 21, Role: "outer"},
+				{Type: osm.TypeWay, Ref: 22, Role: "outer"},
+			},
+			Tags: osm.Tags{
+				{Key: "type", Value: "multipolygon"},
+				{Key: "landuse", Value: "forest"},
+			},
+		},
+		&osm.Relation{ID: 31,
+			Members: osm.Members{{Type: osm.TypeRelation, Ref: 30}},
+			Tags:    osm.Tags{{Key: "type", Value: "collection"}},
+		},
+	}
+}
+
+func buildTestIndex(t testing.TB, objects osm.Objects) *Index {
+	t.Helper()
+
+	dir := t.TempDir()
+	err := BuildIndex(context.Background(), osmtest.NewScanner(objects), dir)
+	if err != nil {
+		t.Fatalf("build error: %v", err)
+	}
+
+	idx, err := OpenIndex(dir)
+	if err != nil {
+		t.Fatalf("open error: %v", err)
+	}
+
+	t.Cleanup(func() { idx.Close() })
+	return idx
+}
+
+func TestIndexBound(t *testing.T) {
+	idx := buildTestIndex(t, testObjects())
+
+	data, err := idx.Bound(context.Background(), orb.Bound{
+		Min: orb.Point{0.0000, 0.0000},
+		Max: orb.Point{0.0030, 0.0030},
+	})
+	if err != nil {
+		t.Fatalf("bound error: %v", err)
+	}
+
+	ids := data.FeatureIDs()
+	expected := []osm.FeatureID{
+		osm.NodeID(1).FeatureID(),
+		osm.NodeID(2).FeatureID(),
+		osm.NodeID(3).FeatureID(),
+		osm.NodeID(4).FeatureID(),
+		osm.NodeID(5).FeatureID(),
+		osm.NodeID(6).FeatureID(),
+		osm.NodeID(7).FeatureID(),
+		osm.NodeID(8).FeatureID(),
+		osm.NodeID(9).FeatureID(),
+		osm.WayID(20).FeatureID(),
+		osm.WayID(21).FeatureID(),
+		osm.WayID(22).FeatureID(),
+		osm.RelationID(30).FeatureID(),
+		osm.RelationID(31).FeatureID(),
+	}
+
+	if len(ids) != len(expected) {
+		t.Fatalf("incorrect elements: %v", ids)
+	}
+
+	for i := range expected {
+		if ids[i] != expected[i] {
+			t.Errorf("incorrect element %d: %v != %v", i, ids[i], expected[i])
+		}
+	}
+
+	// data should round trip
+	n := data.Nodes[3]
+	if n.Tags.Find("amenity") != "cafe" || n.Lat != 0.0015 || n.Lon != 0.0015 {
+		t.Errorf("incorrect node: %+v", n)
+	}
+
+	w := data.Ways[0]
+	if w.Tags.Find("building") != "yes" || len(w.Nodes) != 4 || w.Nodes[3].ID != 1 {
+		t.Errorf("incorrect way: %+v", w)
+	}
+
+	r := data.Relations[0]
+	if r.Tags.Find("landuse") != "forest" || len(r.Members) != 2 || r.Members[1].Role != "outer" {
+		t.Errorf("incorrect relation: %+v", r)
+	}
+}
+
+func TestIndexBound_memberRelations(t *testing.T) {
+	objects := osm.Objects{
+		&osm.Node{ID: 1, Lat: 0.0010, Lon: 0.0010},
+		&osm.Node{ID: 2, Lat: 0.0010, Lon: 0.0020},
+		&osm.Node{ID: 3, Lat: 1.0000, Lon: 1.0000},
+		&osm.Node{ID: 4, Lat: 1.0000, Lon: 1.0010},
+		&osm.Node{ID: 5, Lat: 1.0010, Lon: 1.0010, Tags: osm.Tags{{Key: "highway", Value: "bus_stop"}}},
+
+		&osm.Way{ID: 20, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}},
+		&osm.Way{ID: 21, Nodes: osm.WayNodes{{ID: 3}, {ID: 4}}},
+
+		// a route far outside the bound in a route_master that is in the bound
+		&osm.Relation{ID: 30,
+			Members: osm.Members{
+				{Type: osm.TypeWay, Ref: 21},
+				{Type: osm.TypeNode, Ref: 5},
+			},
+			Tags: osm.Tags{{Key: "type", Value: "route"}},
+		},
+		&osm.Relation{ID: 31,
+			Members: osm.Members{
+				{Type: osm.TypeWay, Ref: 20},
+				{Type: osm.TypeRelation, Ref: 30},
+				{Type: osm.TypeRelation, Ref: 32},
+			},
+			Tags: osm.Tags{{Key: "type", Value: "route_master"}},
+		},
+
+		// a membership cycle
+		&osm.Relation{ID: 32,
+			Members: osm.Members{{Type: osm.TypeRelation, Ref: 31}},
+			Tags:    osm.Tags{{Key: "type", Value: "collection"}},
+		},
+	}
+
+	idx := buildTestIndex(t, objects)
+
+	data, err := idx.Bound(context.Background(), orb.Bound{
+		Min: orb.Point{0.0000, 0.0000},
+		Max: orb.Point{0.0030, 0.0030},
+	})
+	if err != nil {
+		t.Fatalf("bound error: %v", err)
+	}
+
+	ids := data.FeatureIDs()
+	expected := osm.FeatureIDs{
+		osm.NodeID(1).FeatureID(),
+		osm.NodeID(2).FeatureID(),
+		osm.NodeID(3).FeatureID(),
+		osm.NodeID(4).FeatureID(),
+		osm.NodeID(5).FeatureID(),
+		osm.WayID(20).FeatureID(),
+		osm.WayID(21).FeatureID(),
+		osm.RelationID(30).FeatureID(),
+		osm.RelationID(31).FeatureID(),
+		osm.RelationID(32).FeatureID(),
+	}
+
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("incorrect elements: %v", ids)
+	}
+}
+
+func TestBuildIndex_chunks(t *testing.T) {
+	defer func(size int) { spatialChunkSize = size }(spatialChunkSize)
+
+	expected := buildTestIndex(t, testObjects())
+
+	// small chunks so the spatial records are merged from many files
+	spatialChunkSize = 2
+	dir := t.TempDir()
+	err := BuildIndex(context.Background(), osmtest.NewScanner(testObjects()), dir)
+	if err != nil {
+		t.Fatalf("build error: %v", err)
+	}
+
+	tmp, err := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	if err != nil || len(tmp) != 0 {
+		t.Errorf("chunk files should be removed: %v %v", tmp, err)
+	}
+
+	idx, err := OpenIndex(dir)
+	if err != nil {
+		t.Fatalf("open error: %v", err)
+	}
+	defer idx.Close()
+
+	if idx.spatial.count != expected.spatial.count {
+		t.Fatalf("incorrect spatial records: %v != %v", idx.spatial.count, expected.spatial.count)
+	}
+
+	for _, b := range []orb.Bound{
+		{Min: orb.Point{0.0000, 0.0000}, Max: orb.Point{0.0030, 0.0030}},
+		{Min: orb.Point{1.9000, 1.9000}, Max: orb.Point{2.1000, 2.1000}},
+	} {
+		d1, err := expected.Bound(context.Background(), b)
+		if err != nil {
+			t.Fatalf("bound error: %v", err)
+		}
+
+		d2, err := idx.Bound(context.Background(), b)
+		if err != nil {
+			t.Fatalf("bound error: %v", err)
+		}
+
+		if !reflect.DeepEqual(d1.FeatureIDs(), d2.FeatureIDs()) {
+			t.Errorf("incorrect elements: %v != %v", d2.FeatureIDs(), d1.FeatureIDs())
+		}
+	}
+}
+
+func TestIndexBound_empty(t *testing.T) {
+	idx := buildTestIndex(t, testObjects())
+
+	data, err := idx.Bound(context.Background(), orb.Bound{
+		Min: orb.Point{-10, -10},
+		Max: orb.Point{-9, -9},
+	})
+	if err != nil {
+		t.Fatalf("bound error: %v", err)
+	}
+
+	if ids := data.FeatureIDs(); len(ids) != 0 {
+		t.Errorf("should be empty: %v", ids)
+	}
+}
+
+func TestIndexBound_canceled(t *testing.T) {
+	idx := buildTestIndex(t, testObjects())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := idx.Bound(ctx, orb.Bound{Max: orb.Point{0.003, 0.003}})
+	if err != context.Canceled {
+		t.Errorf("should return canceled error: %v", err)
+	}
+}
+
+func TestBuildIndex_unsorted(t *testing.T) {
+	cases := []struct {
+		name    string
+		objects osm.Objects
+	}{
+		{
+			name: "node ids",
+			objects: osm.Objects{
+				&osm.Node{ID: 2},
+				&osm.Node{ID: 1},
+			},
+		},
+		{
+			name: "nodes after ways",
+			objects: osm.Objects{
+				&osm.Way{ID: 1},
+				&osm.Node{ID: 1},
+			},
+		},
+		{
+			name: "ways after relations",
+			objects: osm.Objects{
+				&osm.Relation{ID: 1},
+				&osm.Way{ID: 1},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := BuildIndex(context.Background(), osmtest.NewScanner(tc.objects), t.TempDir())
+			if err != errUnsorted {
+				t.Errorf("incorrect error: %v", err)
+			}
+		})
+	}
+}
+
+func TestTable(t *testing.T) {
+	// keys with duplicates that span blocks
+	tw, err := createTable(t.TempDir()+"/table.idx", false)
+	if err != nil {
+		t.Fatalf("create error: %v", err)
+	}
+	defer tw.close()
+
+	for i := 0; i < 3*blockSize; i++ {
+		key := int64(i / 10)
+		if i >= blockSize-5 && i < 2*blockSize+5 {
+			key = 1000
+		}
+
+		if i >= 2*blockSize+5 {
+			key = 2000 + int64(i)
+		}
+
+		if err := tw.add(key, uint64(i)); err != nil {
+			t.Fatalf("add error: %v", err)
+		}
+	}
+
+	if err := tw.flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	c := tw.table.cursor()
+
+	count := 0
+	err = c.scan(1000, func(uint64) { count++ })
+	if err != nil {
+		t.Fatalf("scan error: %v", err)
+	}
+
+	if count != blockSize+10 {
+		t.Errorf("incorrect count: %v", count)
+	}
+
+	v, ok, err := c.find(2000 + 3*blockSize - 1)
+	if err != nil || !ok || v != 3*blockSize-1 {
+		t.Errorf("incorrect find: %v %v %v", v, ok, err)
+	}
+
+	_, ok, err = c.find(-1)
+	if err != nil || ok {
+		t.Errorf("should not find: %v %v", ok, err)
+	}
+}
@@ -0,0 +1,39 @@
+// Package source defines where the osm data for a tile comes from.
+// Data can be loaded from the live osm api or from a local index
+// built from an `.osm.pbf` extract.
+package source
+
+import (
+	"context"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmapi"
+)
+
+// A Source returns the osm data needed to process a bound. This is all the
+// elements that intersect the bound and their complete member geometry,
+// ie. all the nodes of the ways and all the member ways of multipolygons.
+type Source interface {
+	Bound(ctx context.Context, bound orb.Bound) (*osm.OSM, error)
+}
+
+// Func is an adapter to allow the use of ordinary functions as a source.
+type Func func(ctx context.Context, bound orb.Bound) (*osm.OSM, error)
+
+// Bound calls f(ctx, bound).
+func (f Func) Bound(ctx context.Context, bound orb.Bound) (*osm.OSM, error) {
+	return f(ctx, bound)
+}
+
+// OSMAPI loads the data using the osm api map call. This is useful for
+// demos and testing but the api is rate limited and should not be used
+// to serve tiles to others.
+var OSMAPI Source = Func(func(ctx context.Context, bound orb.Bound) (*osm.OSM, error) {
+	return osmapi.Map(ctx, &osm.Bounds{
+		MinLat: bound.Min.Lat(),
+		MaxLat: bound.Max.Lat(),
+		MinLon: bound.Min.Lon(),
+		MaxLon: bound.Max.Lon(),
+	})
+})
@@ -0,0 +1,213 @@
+package source
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+// spatialChunkSize is the number of spatial records, 16 bytes each, sorted
+// in memory. Larger data sets are sorted in chunks that are written to
+// temporary files in the index directory and merged into the spatial table.
+var spatialChunkSize = 1 << 22
+
+type spatialRecord struct {
+	key int64
+	id  osm.FeatureID
+}
+
+func (r spatialRecord) less(o spatialRecord) bool {
+	if r.key != o.key {
+		return r.key < o.key
+	}
+
+	return r.id < o.id
+}
+
+// spatialSorter is an external sort of the spatial records.
+type spatialSorter struct {
+	dir     string
+	records []spatialRecord
+	chunks  []string
+}
+
+func (s *spatialSorter) add(r spatialRecord) error {
+	s.records = append(s.records, r)
+	if len(s.records) < spatialChunkSize {
+		return nil
+	}
+
+	return s.writeChunk()
+}
+
+func (s *spatialSorter) sortRecords() {
+	sort.Slice(s.records, func(i, j int) bool {
+		return s.records[i].less(s.records[j])
+	})
+}
+
+// writeChunk sorts the records in memory and writes them to a new chunk file.
+func (s *spatialSorter) writeChunk() error {
+	s.sortRecords()
+
+	name := filepath.Join(s.dir, fmt.Sprintf("spatial-%d.tmp", len(s.chunks)))
+	f, err := os.Create(name)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	s.chunks = append(s.chunks, name)
+
+	w := bufio.NewWriter(f)
+	for _, r := range s.records {
+		var rec [recordSize]byte
+		binary.LittleEndian.PutUint64(rec[:], uint64(r.key))
+		binary.LittleEndian.PutUint64(rec[8:], uint64(r.id))
+
+		if _, err := w.Write(rec[:]); err != nil {
+			f.Close()
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return errors.WithStack(err)
+	}
+
+	s.records = s.records[:0]
+	return errors.WithStack(f.Close())
+}
+
+// write adds all the records to the table sorted by key then id.
+// If everything fit in memory no chunks are written.
+func (s *spatialSorter) write(tw *tableWriter) error {
+	if len(s.chunks) == 0 {
+		s.sortRecords()
+		for _, r := range s.records {
+			if err := tw.add(r.key, uint64(r.id)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if len(s.records) > 0 {
+		if err := s.writeChunk(); err != nil {
+			return err
+		}
+	}
+	s.records = nil
+
+	return s.merge(tw)
+}
+
+// merge does a k-way merge of the sorted chunk files into the table.
+func (s *spatialSorter) merge(tw *tableWriter) error {
+	h := make(chunkHeap, 0, len(s.chunks))
+	defer func() {
+		for _, c := range h {
+			c.f.Close()
+		}
+	}()
+
+	for _, name := range s.chunks {
+		f, err := os.Open(name)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		c := &chunkReader{f: f, r: bufio.NewReader(f)}
+		ok, err := c.next()
+		if err != nil || !ok {
+			f.Close()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		h = append(h, c)
+	}
+	heap.Init(&h)
+
+	for len(h) > 0 {
+		c := h[0]
+		if err := tw.add(c.rec.key, uint64(c.rec.id)); err != nil {
+			return err
+		}
+
+		ok, err := c.next()
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+			c.f.Close()
+		}
+	}
+
+	return nil
+}
+
+// remove deletes the chunk files.
+func (s *spatialSorter) remove() {
+	for _, name := range s.chunks {
+		os.Remove(name)
+	}
+	s.chunks = nil
+}
+
+type chunkReader struct {
+	f   *os.File
+	r   *bufio.Reader
+	rec spatialRecord
+}
+
+// next reads the next record, returns false at the end of the chunk.
+func (c *chunkReader) next() (bool, error) {
+	var rec [recordSize]byte
+	_, err := io.ReadFull(c.r, rec[:])
+	if err == io.EOF {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, errors.WithMessagef(err, "source: %s", c.f.Name())
+	}
+
+	c.rec = spatialRecord{
+		key: int64(binary.LittleEndian.Uint64(rec[:])),
+		id:  osm.FeatureID(binary.LittleEndian.Uint64(rec[8:])),
+	}
+
+	return true, nil
+}
+
+type chunkHeap []*chunkReader
+
+func (h chunkHeap) Len() int           { return len(h) }
+func (h chunkHeap) Less(i, j int) bool { return h[i].rec.less(h[j].rec) }
+func (h chunkHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *chunkHeap) Push(x interface{}) {
+	*h = append(*h, x.(*chunkReader))
+}
+
+func (h *chunkHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
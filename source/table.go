@@ -0,0 +1,219 @@
+package source
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// All the index tables have 16 byte records, an int64 key followed by
+// 8 bytes of data. The records are sorted by key and read in blocks.
+const (
+	recordSize = 16
+	blockSize  = 256 // records
+)
+
+// table is a sorted file of fixed size records. The first key of every
+// block is kept in memory so a lookup is a binary search in memory
+// followed by one read of a block from disk.
+type table struct {
+	r      io.ReaderAt
+	count  int
+	firsts []int64
+}
+
+func openTable(f *os.File) (*table, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if info.Size()%recordSize != 0 {
+		return nil, errors.Errorf("source: %s: invalid size", f.Name())
+	}
+
+	t := &table{
+		r:     f,
+		count: int(info.Size() / recordSize),
+	}
+
+	var key [8]byte
+	for i := 0; i < t.count; i += blockSize {
+		_, err := f.ReadAt(key[:], int64(i)*recordSize)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "source: %s", f.Name())
+		}
+
+		t.firsts = append(t.firsts, int64(binary.LittleEndian.Uint64(key[:])))
+	}
+
+	return t, nil
+}
+
+func (t *table) blocks() int {
+	return len(t.firsts)
+}
+
+// cursor returns a reader for the table that caches the last block read.
+// Lookups of nearby keys, e.g. the nodes of a way, are common.
+// Cursors are not safe for concurrent use, the table is.
+func (t *table) cursor() *cursor {
+	return &cursor{t: t, index: -1}
+}
+
+type cursor struct {
+	t     *table
+	index int
+	block []byte
+}
+
+func (c *cursor) load(i int) error {
+	if c.index == i {
+		return nil
+	}
+
+	n := blockSize
+	if rem := c.t.count - i*blockSize; rem < n {
+		n = rem
+	}
+
+	if cap(c.block) < n*recordSize {
+		c.block = make([]byte, n*recordSize)
+	}
+	c.block = c.block[:n*recordSize]
+
+	_, err := c.t.r.ReadAt(c.block, int64(i)*blockSize*recordSize)
+	if err != nil {
+		c.index = -1
+		return errors.WithMessage(err, "source: read block")
+	}
+
+	c.index = i
+	return nil
+}
+
+func (c *cursor) key(i int) int64 {
+	return int64(binary.LittleEndian.Uint64(c.block[i*recordSize:]))
+}
+
+func (c *cursor) value(i int) uint64 {
+	return binary.LittleEndian.Uint64(c.block[i*recordSize+8:])
+}
+
+// find returns the value for the key. The keys are expected to be unique.
+func (c *cursor) find(key int64) (uint64, bool, error) {
+	// the last block with a first key <= key
+	b := sort.Search(len(c.t.firsts), func(i int) bool { return c.t.firsts[i] > key }) - 1
+	if b < 0 {
+		return 0, false, nil
+	}
+
+	err := c.load(b)
+	if err != nil {
+		return 0, false, err
+	}
+
+	n := len(c.block) / recordSize
+	i := sort.Search(n, func(i int) bool { return c.key(i) >= key })
+	if i < n && c.key(i) == key {
+		return c.value(i), true, nil
+	}
+
+	return 0, false, nil
+}
+
+// scan calls the function with the value of every record with the key.
+func (c *cursor) scan(key int64, fn func(uint64)) error {
+	// keys can repeat across blocks, so start with the block
+	// before the first with a first key >= key.
+	b := sort.Search(len(c.t.firsts), func(i int) bool { return c.t.firsts[i] >= key }) - 1
+	if b < 0 {
+		b = 0
+	}
+
+	for ; b < c.t.blocks(); b++ {
+		if c.t.firsts[b] > key {
+			return nil
+		}
+
+		err := c.load(b)
+		if err != nil {
+			return err
+		}
+
+		n := len(c.block) / recordSize
+		for i := sort.Search(n, func(i int) bool { return c.key(i) >= key }); i < n; i++ {
+			if c.key(i) != key {
+				return nil
+			}
+
+			fn(c.value(i))
+		}
+	}
+
+	return nil
+}
+
+// tableWriter writes a table with the keys in increasing order.
+type tableWriter struct {
+	f     *os.File
+	w     *bufio.Writer
+	table *table
+
+	last    int64
+	started bool
+	unique  bool
+}
+
+func createTable(filename string, unique bool) (*tableWriter, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &tableWriter{
+		f:      f,
+		w:      bufio.NewWriter(f),
+		table:  &table{r: f},
+		unique: unique,
+	}, nil
+}
+
+func (tw *tableWriter) add(key int64, value uint64) error {
+	if tw.started && (key < tw.last || (tw.unique && key == tw.last)) {
+		return errUnsorted
+	}
+	tw.started = true
+	tw.last = key
+
+	if tw.table.count%blockSize == 0 {
+		tw.table.firsts = append(tw.table.firsts, key)
+	}
+	tw.table.count++
+
+	var rec [recordSize]byte
+	binary.LittleEndian.PutUint64(rec[:], uint64(key))
+	binary.LittleEndian.PutUint64(rec[8:], value)
+
+	_, err := tw.w.Write(rec[:])
+	return errors.WithStack(err)
+}
+
+// flush makes sure everything added can be read using the table.
+func (tw *tableWriter) flush() error {
+	return errors.WithStack(tw.w.Flush())
+}
+
+func (tw *tableWriter) close() error {
+	err := tw.flush()
+	if err != nil {
+		tw.f.Close()
+		return err
+	}
+
+	return errors.WithStack(tw.f.Close())
+}
@@ -0,0 +1,121 @@
+package transform
+
+import "strings"
+
+// A Property is a feature property set by a transform.
+type Property struct {
+	Key string
+
+	// Type is the json type of the values, eg. string, number, boolean or array.
+	Type string
+
+	// Values are the constant values set by the transform. Computed is true
+	// if the transform can also set other values.
+	Values   []interface{}
+	Computed bool
+}
+
+// Properties returns the properties set by the transform with the name
+// found in the config. Returns nil if the transform doesn't set any
+// properties or is not defined.
+func Properties(name string) []Property {
+	name = strings.TrimPrefix(name, "vectordatasource.transform.")
+	return properties[name]
+}
+
+// properties must have an entry for every implemented transform,
+// transforms that don't set any properties have a nil entry.
+var properties = map[string][]Property{
+	"tags_name_i18n": nameAlternateProperties(),
+
+	"add_road_network_from_ncat": {{Key: "network", Type: "string", Values: ncatValues()}},
+
+	"detect_osm_relation":              {{Key: "osm_relation", Type: "boolean", Values: []interface{}{true}}},
+	"water_tunnel":                     {{Key: "is_tunnel", Type: "boolean", Values: []interface{}{true}}},
+	"place_population_int":             {{Key: "population", Type: "number", Computed: true}},
+	"population_rank":                  {{Key: "population_rank", Type: "number", Computed: true}},
+	"major_airport_detector":           {{Key: "kind_detail", Type: "string", Values: []interface{}{"international", "regional"}}},
+	"calculate_default_place_min_zoom": {{Key: "min_zoom", Type: "number", Computed: true}},
+	"normalize_tourism_kind": {
+		{Key: "kind", Type: "string", Computed: true},
+		{Key: "tourism", Type: "string", Values: []interface{}{"attraction"}},
+	},
+	"normalize_operator_values": {{Key: "operator", Type: "string", Computed: true}},
+	"parse_layer_as_float":      {{Key: "layer", Type: "number", Computed: true}},
+	"road_classifier": {
+		{Key: "is_link", Type: "boolean", Values: []interface{}{true}},
+		{Key: "is_tunnel", Type: "boolean", Values: []interface{}{true}},
+		{Key: "is_bridge", Type: "boolean", Values: []interface{}{true}},
+	},
+	"road_oneway":            {{Key: "oneway", Type: "string", Values: []interface{}{"yes", "no"}}},
+	"route_name":             {{Key: "name", Type: "string", Computed: true}},
+	"road_abbreviate_name":   {{Key: "name", Type: "string", Computed: true}},
+	"normalize_aerialways":   {{Key: "aerialway", Type: "string", Values: []interface{}{"zip_line", "unknown"}, Computed: true}},
+	"normalize_cycleway":     {{Key: "cycleway", Type: "string", Computed: true}},
+	"add_is_bicycle_related": {{Key: "is_bicycle_related", Type: "boolean", Values: []interface{}{true}}},
+	"add_vehicle_restrictions": {
+		{Key: "hgv_restriction", Type: "string", Values: restrictionValues()},
+		{Key: "hgv_restriction_shield_text", Type: "string", Computed: true},
+	},
+	"road_trim_properties": nil,
+
+	"building_height":     {{Key: "height", Type: "number", Computed: true}},
+	"building_min_height": {{Key: "min_height", Type: "number", Computed: true}},
+	"synthesize_volume":   {{Key: "volume", Type: "number", Computed: true}},
+
+	"building_trim_properties": nil,
+
+	"add_iata_code_to_airports": {{Key: "iata", Type: "string", Computed: true}},
+	"add_uic_ref":               {{Key: "uic_ref", Type: "number", Computed: true}},
+	"normalize_social_kind": {
+		{Key: "kind", Type: "string", Computed: true},
+		{Key: "social_facility", Type: "string", Computed: true},
+		{Key: "for", Type: "array", Computed: true},
+	},
+	"normalize_medical_kind": {{Key: "speciality", Type: "array", Computed: true}},
+
+	"make_representative_point": nil,
+	"height_to_meters":          {{Key: "height", Type: "number", Computed: true}},
+	"pois_capacity_int":         {{Key: "capacity", Type: "number", Computed: true}},
+	"pois_direction_int":        {{Key: "direction", Type: "number", Computed: true}},
+	"elevation_to_meters":       {{Key: "elevation", Type: "number", Computed: true}},
+	"admin_level_as_int":        {{Key: "admin_level", Type: "number", Computed: true}},
+}
+
+func nameAlternateProperties() []Property {
+	result := make([]Property, len(tagNameAlternates), len(tagNameAlternates)+1)
+	for i, k := range tagNameAlternates {
+		result[i] = Property{Key: k, Type: "string", Computed: true}
+	}
+
+	// the translations, one for each language in the tags.
+	return append(result, Property{Key: "name:*", Type: "string", Computed: true})
+}
+
+func ncatValues() []interface{} {
+	var result []interface{}
+	for _, v := range ncatNetworks {
+		result = appendValue(result, v)
+	}
+
+	return result
+}
+
+func restrictionValues() []interface{} {
+	result := []interface{}{"multiple"}
+	for _, r := range restrictions {
+		result = appendValue(result, r.kind)
+	}
+
+	return result
+}
+
+func appendValue(list []interface{}, v interface{}) []interface{} {
+	for _, l := range list {
+		if l == v {
+			return list
+		}
+	}
+
+	return append(list, v)
+}
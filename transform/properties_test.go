@@ -0,0 +1,21 @@
+package transform
+
+import "testing"
+
+func TestProperties(t *testing.T) {
+	for name, tr := range transforms {
+		if tr == nil {
+			continue
+		}
+
+		if _, ok := properties[name]; !ok {
+			t.Errorf("%s: implemented transform missing from properties", name)
+		}
+	}
+
+	for name := range properties {
+		if transforms[name] == nil {
+			t.Errorf("%s: properties for transform that is not implemented", name)
+		}
+	}
+}
@@ -31,7 +31,7 @@ var transforms = map[string]Transform{
 	"add_id_to_properties": nil,
 	"remove_feature_id":    nil,
 
-	"add_road_network_from_ncat": nil, // south korea road network thing
+	"add_road_network_from_ncat": addRoadNetworkFromNcat,
 	"remove_zero_area":           nil,
 
 	// not needed we filter to 2dp in filter.Context.MinZoom()
@@ -430,7 +430,7 @@ func normalizeAerialways(ctx *filter.Context, feature *geojson.Feature) {
 // representative point. This is a point which should be within the interior of
 // the geometry, which can be important for labelling concave or doughnut-shaped polygons.
 func makeRepresentativePoint(ctx *filter.Context, feature *geojson.Feature) {
-	feature.Geometry, _ = planar.CentroidArea(ctx.Geometry)
+	feature.Geometry, _ = planar.CentroidArea(ctx.LoadGeometry())
 }
 
 // addIataCodeToAirports
@@ -443,7 +443,7 @@ func addIataCodeToAirports(ctx *filter.Context, feature *geojson.Feature) {
 		return
 	}
 
-	iata := strings.TrimSpace(ctx.Tags["iata"])
+	iata := strings.TrimSpace(ctx.Tag("iata"))
 	if iata == "" {
 		return
 	}
@@ -460,7 +460,7 @@ func addIataCodeToAirports(ctx *filter.Context, feature *geojson.Feature) {
 // If the feature has a valid uic_ref tag (7 integers), then move it
 // to its properties.
 func addUICRef(ctx *filter.Context, feature *geojson.Feature) {
-	ref := strings.TrimSpace(ctx.Tags["uic_ref"])
+	ref := strings.TrimSpace(ctx.Tag("uic_ref"))
 	if ref == "" {
 		return
 	}
@@ -513,7 +513,7 @@ func normalizeSocialKind(ctx *filter.Context, feature *geojson.Feature) {
 		return
 	}
 
-	socialFacility := ctx.Tags["social_facility"]
+	socialFacility := ctx.Tag("social_facility")
 	if socialFacility != "" {
 		feature.Properties["kind"] = socialFacility
 
@@ -521,7 +521,7 @@ func normalizeSocialKind(ctx *filter.Context, feature *geojson.Feature) {
 		feature.Properties["social_facility"] = socialFacility
 
 		// normalise the 'for' list to an actual list
-		if list, ok := ctx.Tags["social_facility:for"]; ok {
+		if list, ok := ctx.LookupTag("social_facility:for"); ok {
 			feature.Properties["for"] = strings.Split(list, ";")
 		}
 	}
@@ -534,7 +534,7 @@ func normalizeSocialKind(ctx *filter.Context, feature *geojson.Feature) {
 func normalizeMedicalKind(ctx *filter.Context, feature *geojson.Feature) {
 	kind := feature.Properties.MustString("kind", "")
 	if kind == "clinic" || kind == "doctors" || kind == "dentist" {
-		speciality := ctx.Tags["healthcare:speciality"]
+		speciality := ctx.Tag("healthcare:speciality")
 		if speciality != "" {
 			feature.Properties["speciality"] = strings.Split(speciality, ";")
 		}
@@ -632,6 +632,31 @@ func addIsBicycleRelated(ctx *filter.Context, feature *geojson.Feature) {
 	}
 }
 
+// ncatNetworks maps the South Korean `ncat` tag values to networks.
+var ncatNetworks = map[string]string{
+	"국도":    "KR:national",     // national roads - gukdo
+	"광역시도로": "KR:metropolitan", // metropolitan city roads - gwangyeoksido
+	"특별시도":  "KR:metropolitan", // special city (Seoul) roads - teukbyeolsido
+	"고속도로":  "KR:expressway",   // expressways - gosokdoro
+	"지방도":   "KR:local",        // local highways - jibangdo
+}
+
+// addRoadNetworkFromNcat
+// Many South Korean roads appear to have an "ncat" tag, which seems to
+// correspond to the type of road network (perhaps "ncat" = "national
+// category"?). This carries that through into "network", unless it is
+// already populated.
+func addRoadNetworkFromNcat(ctx *filter.Context, feature *geojson.Feature) {
+	if _, ok := feature.Properties["network"]; ok {
+		return
+	}
+
+	network := ncatNetworks[strings.TrimSpace(ctx.Tag("ncat"))]
+	if network != "" {
+		feature.Properties["network"] = network
+	}
+}
+
 var lookupOperatorRules = map[string][]string{
 	"United States National Park Service": {
 		"National Park Service",
@@ -692,7 +717,7 @@ func normalizeOperatorValues(ctx *filter.Context, feature *geojson.Feature) {
 // tagsNameI18N
 
 func tagsNameI18N(ctx *filter.Context, feature *geojson.Feature) {
-	if len(ctx.Tags) == 0 || ctx.Tags["name"] == "" {
+	if ctx.Tag("name") == "" {
 		return
 	}
 
@@ -742,13 +767,20 @@ func tagsNameI18N(ctx *filter.Context, feature *geojson.Feature) {
 	// 	feature.Properties[[key] = item.Value
 	// }
 
-	name := ctx.Tags["name"]
+	name := ctx.Tag("name")
 	for _, altTagNameCandidate := range tagNameAlternates {
-		altTagNameValue := ctx.Tags[altTagNameCandidate]
+		altTagNameValue := ctx.Tag(altTagNameCandidate)
 		if altTagNameValue != "" && altTagNameValue != name {
 			feature.Properties[altTagNameCandidate] = altTagNameValue
 		}
 	}
+
+	// translations, the language codes are used as is.
+	ctx.EachTag(func(k, v string) {
+		if v != "" && util.IsNameTranslation(k) {
+			feature.Properties[k] = v
+		}
+	})
 }
 
 var tagNameAlternates = []string{
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osmzen/filter"
 )
 
 func TestPoisCapacity(t *testing.T) {
@@ -56,3 +57,49 @@ func TestPoisCapacity(t *testing.T) {
 		})
 	}
 }
+
+func TestAddRoadNetworkFromNcat(t *testing.T) {
+	cases := []struct {
+		name       string
+		tags       map[string]string
+		properties map[string]interface{}
+		result     interface{}
+	}{
+		{
+			name:       "expressway",
+			tags:       map[string]string{"ncat": "고속도로"},
+			properties: map[string]interface{}{},
+			result:     "KR:expressway",
+		},
+		{
+			name:       "national road",
+			tags:       map[string]string{"ncat": "국도"},
+			properties: map[string]interface{}{},
+			result:     "KR:national",
+		},
+		{
+			name:       "does not replace network",
+			tags:       map[string]string{"ncat": "국도"},
+			properties: map[string]interface{}{"network": "KR:local"},
+			result:     "KR:local",
+		},
+		{
+			name:       "unknown ncat",
+			tags:       map[string]string{"ncat": "something"},
+			properties: map[string]interface{}{},
+			result:     nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := geojson.NewFeature(nil)
+			f.Properties = tc.properties
+
+			addRoadNetworkFromNcat(&filter.Context{Tags: tc.tags}, f)
+			if v := f.Properties["network"]; v != tc.result {
+				t.Errorf("incorrect network: %v != %v", v, tc.result)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package update
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/orb/maptile/tilecover"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+// MinZoom is the minimum zoom dirty tiles can be computed for.
+// The processing only supports zoom 14+ tiles.
+const MinZoom = maptile.Zoom(14)
+
+// Apply applies the change to the store and returns the set of tiles,
+// at the given zoom, that need to be rebuilt. These are the tiles covering
+// the changed elements plus the ways and relations they are a member of,
+// both before and after the change.
+func (s *Store) Apply(change *osm.Change, z maptile.Zoom) (maptile.Set, error) {
+	if z < MinZoom {
+		return nil, errors.Errorf("update: zoom must be %d or greater: %d", MinZoom, z)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := changedIDs(change)
+	dirty := make(maptile.Set)
+
+	// the old locations of everything
+	err := s.cover(dirty, s.affected(changed), z)
+	if err != nil {
+		return nil, err
+	}
+
+	s.apply(change)
+
+	// the new locations, membership may have changed too.
+	err = s.cover(dirty, s.affected(changed), z)
+	if err != nil {
+		return nil, err
+	}
+
+	return dirty, nil
+}
+
+func changedIDs(change *osm.Change) []osm.FeatureID {
+	var ids []osm.FeatureID
+	for _, o := range []*osm.OSM{change.Create, change.Modify, change.Delete} {
+		if o != nil {
+			ids = append(ids, o.FeatureIDs()...)
+		}
+	}
+
+	return ids
+}
+
+// affected returns the elements plus all the ways and relations
+// they are a member of, walking up the relation hierarchy.
+func (s *Store) affected(ids []osm.FeatureID) map[osm.FeatureID]struct{} {
+	result := make(map[osm.FeatureID]struct{}, len(ids))
+
+	queue := make([]osm.FeatureID, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := result[id]; !ok {
+			result[id] = struct{}{}
+			queue = append(queue, id)
+		}
+	}
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		var parents []osm.FeatureID
+		if id.Type() == osm.TypeNode {
+			for wid := range s.wayMembership[id.NodeID()] {
+				parents = append(parents, wid.FeatureID())
+			}
+		}
+
+		for rid := range s.relationMembership[id] {
+			parents = append(parents, rid.FeatureID())
+		}
+
+		for _, p := range parents {
+			if _, ok := result[p]; !ok {
+				result[p] = struct{}{}
+				queue = append(queue, p)
+			}
+		}
+	}
+
+	return result
+}
+
+// cover adds the tiles covering the elements, as they currently are in
+// the store, to the set. Elements not in the store are skipped.
+func (s *Store) cover(set maptile.Set, ids map[osm.FeatureID]struct{}, z maptile.Zoom) error {
+	visited := make(map[osm.RelationID]struct{})
+	for id := range ids {
+		var err error
+		switch id.Type() {
+		case osm.TypeNode:
+			s.coverNode(set, id.NodeID(), z)
+		case osm.TypeWay:
+			err = s.coverWay(set, id.WayID(), z)
+		case osm.TypeRelation:
+			err = s.coverRelation(set, id.RelationID(), z, visited)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) coverNode(set maptile.Set, id osm.NodeID, z maptile.Zoom) {
+	if n := s.nodes[id]; n != nil {
+		set[maptile.At(n.Point(), z)] = true
+	}
+}
+
+func (s *Store) coverWay(set maptile.Set, id osm.WayID, z maptile.Zoom) error {
+	ls := s.wayLineString(id)
+	if len(ls) == 0 {
+		return nil
+	}
+
+	if len(ls) == 1 {
+		set[maptile.At(ls[0], z)] = true
+		return nil
+	}
+
+	// closed ways can be areas so the inside needs to be rebuilt too.
+	if len(ls) >= 4 && ls[0] == ls[len(ls)-1] {
+		tiles, err := tilecover.Ring(orb.Ring(ls), z)
+		if err != nil {
+			return errors.WithMessagef(err, "update: way %d", id)
+		}
+
+		set.Merge(tiles)
+		return nil
+	}
+
+	set.Merge(tilecover.LineString(ls, z))
+	return nil
+}
+
+func (s *Store) coverRelation(
+	set maptile.Set,
+	id osm.RelationID,
+	z maptile.Zoom,
+	visited map[osm.RelationID]struct{},
+) error {
+	if _, ok := visited[id]; ok {
+		return nil
+	}
+	visited[id] = struct{}{}
+
+	r := s.relations[id]
+	if r == nil {
+		return nil
+	}
+
+	// the interior of multipolygons changes if the relation changes, so
+	// cover the whole bound. For other relations, e.g. routes, only the
+	// members are affected.
+	if r.Tags.Find("type") == "multipolygon" {
+		bound, ok := s.relationBound(r)
+		if ok {
+			set.Merge(tilecover.Bound(bound, z))
+		}
+
+		return nil
+	}
+
+	for _, m := range r.Members {
+		var err error
+		switch m.Type {
+		case osm.TypeNode:
+			s.coverNode(set, osm.NodeID(m.Ref), z)
+		case osm.TypeWay:
+			err = s.coverWay(set, osm.WayID(m.Ref), z)
+		case osm.TypeRelation:
+			err = s.coverRelation(set, osm.RelationID(m.Ref), z, visited)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) relationBound(r *osm.Relation) (orb.Bound, bool) {
+	var (
+		bound orb.Bound
+		found bool
+	)
+
+	extend := func(p orb.Point) {
+		if !found {
+			bound = p.Bound()
+			found = true
+		} else {
+			bound = bound.Extend(p)
+		}
+	}
+
+	for _, m := range r.Members {
+		switch m.Type {
+		case osm.TypeNode:
+			if n := s.nodes[osm.NodeID(m.Ref)]; n != nil {
+				extend(n.Point())
+			}
+		case osm.TypeWay:
+			for _, p := range s.wayLineString(osm.WayID(m.Ref)) {
+				extend(p)
+			}
+		}
+	}
+
+	return bound, found
+}
+
+// wayLineString returns the geometry of the way skipping any nodes
+// that are not in the store.
+func (s *Store) wayLineString(id osm.WayID) orb.LineString {
+	w := s.ways[id]
+	if w == nil {
+		return nil
+	}
+
+	ls := make(orb.LineString, 0, len(w.Nodes))
+	for _, wn := range w.Nodes {
+		if n := s.nodes[wn.ID]; n != nil {
+			ls = append(ls, n.Point())
+		}
+	}
+
+	return ls
+}
@@ -0,0 +1,89 @@
+package update
+
+import (
+	"compress/gzip"
+	"encoding/xml"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osmzen"
+	"github.com/pkg/errors"
+)
+
+// ReadChange reads an osmChange document, i.e. an `.osc` file.
+func ReadChange(r io.Reader) (*osm.Change, error) {
+	change := &osm.Change{}
+	err := xml.NewDecoder(r).Decode(change)
+	if err != nil {
+		return nil, errors.WithMessage(err, "update: unable to decode change")
+	}
+
+	return change, nil
+}
+
+// ReadChangeFile reads an `.osc` or gzipped `.osc.gz` file.
+func ReadChangeFile(filename string) (*osm.Change, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(filename, ".gz") {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		defer gr.Close()
+
+		r = gr
+	}
+
+	return ReadChange(r)
+}
+
+// Process runs the config over the data in the store for each of the tiles.
+// The tiles are processed in order of zoom, x, y and the function is called
+// with the result of each one. Processing stops at the first error.
+func (s *Store) Process(
+	c *osmzen.Config,
+	tiles maptile.Set,
+	fn func(maptile.Tile, map[string]*geojson.FeatureCollection) error,
+) error {
+	list := make([]maptile.Tile, 0, len(tiles))
+	for t := range tiles {
+		list = append(list, t)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Z != list[j].Z {
+			return list[i].Z < list[j].Z
+		}
+
+		if list[i].X != list[j].X {
+			return list[i].X < list[j].X
+		}
+
+		return list[i].Y < list[j].Y
+	})
+
+	for _, t := range list {
+		layers, err := c.Process(s.Data(t.Bound()), t.Bound(), t.Z)
+		if err != nil {
+			return errors.WithMessagef(err, "update: tile %d/%d/%d", t.Z, t.X, t.Y)
+		}
+
+		err = fn(t, layers)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
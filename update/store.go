@@ -0,0 +1,337 @@
+// Package update keeps a local set of osm elements up to date using
+// osmChange diffs and computes the tiles that need to be rebuilt.
+package update
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/orb/maptile/tilecover"
+	"github.com/paulmach/osm"
+)
+
+// indexZoom is the zoom of the tiles used to index the node locations.
+const indexZoom = maptile.Zoom(14)
+
+// Store is an in memory set of osm elements with the way and relation
+// membership needed to figure out which elements are affected by a change.
+// It is safe for concurrent use, e.g. as a tile source while changes are
+// being applied.
+type Store struct {
+	mu sync.RWMutex
+
+	nodes     map[osm.NodeID]*osm.Node
+	ways      map[osm.WayID]*osm.Way
+	relations map[osm.RelationID]*osm.Relation
+
+	// the reverse of the way nodes and relation members.
+	wayMembership      map[osm.NodeID]map[osm.WayID]struct{}
+	relationMembership map[osm.FeatureID]map[osm.RelationID]struct{}
+
+	nodeIndex map[maptile.Tile]map[osm.NodeID]struct{}
+}
+
+// NewStore creates a new store with the initial data, e.g. a regional extract.
+// The data can be nil for an empty store.
+func NewStore(data *osm.OSM) *Store {
+	s := &Store{
+		nodes:     make(map[osm.NodeID]*osm.Node),
+		ways:      make(map[osm.WayID]*osm.Way),
+		relations: make(map[osm.RelationID]*osm.Relation),
+
+		wayMembership:      make(map[osm.NodeID]map[osm.WayID]struct{}),
+		relationMembership: make(map[osm.FeatureID]map[osm.RelationID]struct{}),
+
+		nodeIndex: make(map[maptile.Tile]map[osm.NodeID]struct{}),
+	}
+
+	if data != nil {
+		for _, n := range data.Nodes {
+			s.putNode(n)
+		}
+
+		for _, w := range data.Ways {
+			s.putWay(w)
+		}
+
+		for _, r := range data.Relations {
+			s.putRelation(r)
+		}
+	}
+
+	return s
+}
+
+// Node returns the node from the store or nil if not found.
+func (s *Store) Node(id osm.NodeID) *osm.Node {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.nodes[id]
+}
+
+// Way returns the way from the store or nil if not found.
+func (s *Store) Way(id osm.WayID) *osm.Way {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.ways[id]
+}
+
+// Relation returns the relation from the store or nil if not found.
+func (s *Store) Relation(id osm.RelationID) *osm.Relation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.relations[id]
+}
+
+// apply applies the creates, modifies and deletes, in that order, to the store.
+// Elements older than the version in the store are skipped.
+func (s *Store) apply(change *osm.Change) {
+	for _, o := range []*osm.OSM{change.Create, change.Modify} {
+		if o == nil {
+			continue
+		}
+
+		for _, n := range o.Nodes {
+			if e := s.nodes[n.ID]; e == nil || !isOlder(n.Version, e.Version) {
+				s.putNode(n)
+			}
+		}
+
+		for _, w := range o.Ways {
+			if e := s.ways[w.ID]; e == nil || !isOlder(w.Version, e.Version) {
+				s.putWay(w)
+			}
+		}
+
+		for _, r := range o.Relations {
+			if e := s.relations[r.ID]; e == nil || !isOlder(r.Version, e.Version) {
+				s.putRelation(r)
+			}
+		}
+	}
+
+	if change.Delete == nil {
+		return
+	}
+
+	// delete the "parents" first so memberships are removed
+	// before the members themselves.
+	for _, r := range change.Delete.Relations {
+		if e := s.relations[r.ID]; e != nil && !isOlder(r.Version, e.Version) {
+			s.deleteRelation(r.ID)
+		}
+	}
+
+	for _, w := range change.Delete.Ways {
+		if e := s.ways[w.ID]; e != nil && !isOlder(w.Version, e.Version) {
+			s.deleteWay(w.ID)
+		}
+	}
+
+	for _, n := range change.Delete.Nodes {
+		if e := s.nodes[n.ID]; e != nil && !isOlder(n.Version, e.Version) {
+			s.deleteNode(n.ID)
+		}
+	}
+}
+
+// isOlder returns true if the version is known to be older than the current one.
+func isOlder(version, current int) bool {
+	return version != 0 && current != 0 && version < current
+}
+
+func (s *Store) putNode(n *osm.Node) {
+	s.deleteNode(n.ID)
+	s.nodes[n.ID] = n
+
+	t := maptile.At(n.Point(), indexZoom)
+	if s.nodeIndex[t] == nil {
+		s.nodeIndex[t] = make(map[osm.NodeID]struct{})
+	}
+	s.nodeIndex[t][n.ID] = struct{}{}
+}
+
+func (s *Store) deleteNode(id osm.NodeID) {
+	n := s.nodes[id]
+	if n == nil {
+		return
+	}
+
+	t := maptile.At(n.Point(), indexZoom)
+	delete(s.nodeIndex[t], id)
+	if len(s.nodeIndex[t]) == 0 {
+		delete(s.nodeIndex, t)
+	}
+
+	delete(s.nodes, id)
+}
+
+func (s *Store) putWay(w *osm.Way) {
+	s.deleteWay(w.ID)
+	s.ways[w.ID] = w
+
+	for _, wn := range w.Nodes {
+		if s.wayMembership[wn.ID] == nil {
+			s.wayMembership[wn.ID] = make(map[osm.WayID]struct{})
+		}
+		s.wayMembership[wn.ID][w.ID] = struct{}{}
+	}
+}
+
+func (s *Store) deleteWay(id osm.WayID) {
+	w := s.ways[id]
+	if w == nil {
+		return
+	}
+
+	for _, wn := range w.Nodes {
+		delete(s.wayMembership[wn.ID], id)
+		if len(s.wayMembership[wn.ID]) == 0 {
+			delete(s.wayMembership, wn.ID)
+		}
+	}
+
+	delete(s.ways, id)
+}
+
+func (s *Store) putRelation(r *osm.Relation) {
+	s.deleteRelation(r.ID)
+	s.relations[r.ID] = r
+
+	for _, m := range r.Members {
+		fid := m.FeatureID()
+		if s.relationMembership[fid] == nil {
+			s.relationMembership[fid] = make(map[osm.RelationID]struct{})
+		}
+		s.relationMembership[fid][r.ID] = struct{}{}
+	}
+}
+
+func (s *Store) deleteRelation(id osm.RelationID) {
+	r := s.relations[id]
+	if r == nil {
+		return
+	}
+
+	for _, m := range r.Members {
+		fid := m.FeatureID()
+		delete(s.relationMembership[fid], id)
+		if len(s.relationMembership[fid]) == 0 {
+			delete(s.relationMembership, fid)
+		}
+	}
+
+	delete(s.relations, id)
+}
+
+// Data returns the elements needed to process the bound. Similar to the
+// osm api map call, this is the nodes in the bound, the ways using those
+// nodes, with all their nodes, and the relations that reference any of them.
+// Multipolygon relations also include all their member ways so the
+// polygons can be built.
+func (s *Store) Data(bound orb.Bound) *osm.OSM {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nodes := make(map[osm.NodeID]struct{})
+	ways := make(map[osm.WayID]struct{})
+	relations := make(map[osm.RelationID]struct{})
+
+	for t := range tilecover.Bound(bound, indexZoom) {
+		for id := range s.nodeIndex[t] {
+			if bound.Contains(s.nodes[id].Point()) {
+				nodes[id] = struct{}{}
+			}
+		}
+	}
+
+	for id := range nodes {
+		for wid := range s.wayMembership[id] {
+			ways[wid] = struct{}{}
+		}
+	}
+
+	for id := range nodes {
+		for rid := range s.relationMembership[id.FeatureID()] {
+			relations[rid] = struct{}{}
+		}
+	}
+
+	for id := range ways {
+		for rid := range s.relationMembership[id.FeatureID()] {
+			relations[rid] = struct{}{}
+		}
+	}
+
+	// relations that reference the relations, one level up. These are
+	// collected separately so only one level is added.
+	parents := make(map[osm.RelationID]struct{})
+	for id := range relations {
+		for rid := range s.relationMembership[id.FeatureID()] {
+			parents[rid] = struct{}{}
+		}
+	}
+
+	for id := range parents {
+		relations[id] = struct{}{}
+	}
+
+	for id := range relations {
+		r := s.relations[id]
+		if r.Tags.Find("type") != "multipolygon" {
+			continue
+		}
+
+		for _, m := range r.Members {
+			if m.Type == osm.TypeWay {
+				if _, ok := s.ways[osm.WayID(m.Ref)]; ok {
+					ways[osm.WayID(m.Ref)] = struct{}{}
+				}
+			}
+		}
+	}
+
+	for id := range ways {
+		for _, wn := range s.ways[id].Nodes {
+			if _, ok := s.nodes[wn.ID]; ok {
+				nodes[wn.ID] = struct{}{}
+			}
+		}
+	}
+
+	result := &osm.OSM{
+		Nodes:     make(osm.Nodes, 0, len(nodes)),
+		Ways:      make(osm.Ways, 0, len(ways)),
+		Relations: make(osm.Relations, 0, len(relations)),
+	}
+
+	for id := range nodes {
+		result.Nodes = append(result.Nodes, s.nodes[id])
+	}
+
+	for id := range ways {
+		result.Ways = append(result.Ways, s.ways[id])
+	}
+
+	for id := range relations {
+		result.Relations = append(result.Relations, s.relations[id])
+	}
+
+	sort.Slice(result.Nodes, func(i, j int) bool { return result.Nodes[i].ID < result.Nodes[j].ID })
+	sort.Slice(result.Ways, func(i, j int) bool { return result.Ways[i].ID < result.Ways[j].ID })
+	sort.Slice(result.Relations, func(i, j int) bool { return result.Relations[i].ID < result.Relations[j].ID })
+
+	return result
+}
+
+// Bound returns the data needed to process the bound, see Data.
+// It allows the store to be used as a source.Source.
+func (s *Store) Bound(ctx context.Context, bound orb.Bound) (*osm.OSM, error) {
+	return s.Data(bound), ctx.Err()
+}
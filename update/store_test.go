@@ -0,0 +1,292 @@
+package update
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osmzen"
+)
+
+func testData() *osm.OSM {
+	return &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Version: 1, Lat: 0.0010, Lon: 0.0010, Visible: true},
+			{ID: 2, Version: 1, Lat: 0.0010, Lon: 0.0200, Visible: true},
+			{ID: 3, Version: 1, Lat: 0.0200, Lon: 0.0200, Visible: true},
+			{ID: 4, Version: 1, Lat: 0.0200, Lon: 0.0010, Visible: true},
+			{ID: 5, Version: 1, Lat: 0.1000, Lon: 0.1000, Visible: true},
+		},
+		Ways: osm.Ways{
+			{ID: 10, Version: 1, Visible: true,
+				Nodes: osm.WayNodes{{ID: 1}, {ID: 2}},
+				Tags:  osm.Tags{{Key: "highway", Value: "residential"}},
+			},
+		},
+		Relations: osm.Relations{
+			{ID: 100, Version: 1, Visible: true,
+				Members: osm.Members{{Type: osm.TypeWay, Ref: 10}},
+				Tags: osm.Tags{
+					{Key: "type", Value: "route"},
+					{Key: "route", Value: "bus"},
+				},
+			},
+		},
+	}
+}
+
+func TestStoreApply(t *testing.T) {
+	z := maptile.Zoom(14)
+
+	tile := func(lon, lat float64) maptile.Tile {
+		return maptile.At(orb.Point{lon, lat}, z)
+	}
+
+	t.Run("node move dirties old and new tiles", func(t *testing.T) {
+		s := NewStore(testData())
+		dirty, err := s.Apply(&osm.Change{
+			Modify: &osm.OSM{Nodes: osm.Nodes{
+				{ID: 5, Version: 2, Lat: 0.2000, Lon: 0.2000, Visible: true},
+			}},
+		}, z)
+		if err != nil {
+			t.Fatalf("apply error: %v", err)
+		}
+
+		expected := maptile.Set{tile(0.1, 0.1): true, tile(0.2, 0.2): true}
+		compareSets(t, dirty, expected)
+
+		if p := s.Node(5).Point(); p != (orb.Point{0.2, 0.2}) {
+			t.Errorf("node not updated: %v", p)
+		}
+	})
+
+	t.Run("way node move dirties the way", func(t *testing.T) {
+		s := NewStore(testData())
+		dirty, err := s.Apply(&osm.Change{
+			Modify: &osm.OSM{Nodes: osm.Nodes{
+				{ID: 1, Version: 2, Lat: 0.0011, Lon: 0.0011, Visible: true},
+			}},
+		}, z)
+		if err != nil {
+			t.Fatalf("apply error: %v", err)
+		}
+
+		if !dirty[tile(0.0010, 0.0010)] || !dirty[tile(0.0200, 0.0010)] {
+			t.Errorf("should dirty both ends of the way: %v", dirty)
+		}
+	})
+
+	t.Run("relation tag change dirties member tiles", func(t *testing.T) {
+		s := NewStore(testData())
+		r := *s.Relation(100)
+		r.Version = 2
+		r.Tags = osm.Tags{{Key: "type", Value: "route"}, {Key: "route", Value: "bicycle"}}
+
+		dirty, err := s.Apply(&osm.Change{Modify: &osm.OSM{Relations: osm.Relations{&r}}}, z)
+		if err != nil {
+			t.Fatalf("apply error: %v", err)
+		}
+
+		if !dirty[tile(0.0010, 0.0010)] || !dirty[tile(0.0200, 0.0010)] {
+			t.Errorf("should dirty the member way: %v", dirty)
+		}
+
+		if dirty[tile(0.1, 0.1)] {
+			t.Errorf("should not dirty unrelated tiles: %v", dirty)
+		}
+	})
+
+	t.Run("create and delete", func(t *testing.T) {
+		s := NewStore(testData())
+		dirty, err := s.Apply(&osm.Change{
+			Create: &osm.OSM{Nodes: osm.Nodes{
+				{ID: 6, Version: 1, Lat: 0.3000, Lon: 0.3000, Visible: true},
+			}},
+			Delete: &osm.OSM{Nodes: osm.Nodes{
+				{ID: 5, Version: 2},
+			}},
+		}, z)
+		if err != nil {
+			t.Fatalf("apply error: %v", err)
+		}
+
+		expected := maptile.Set{tile(0.1, 0.1): true, tile(0.3, 0.3): true}
+		compareSets(t, dirty, expected)
+
+		if s.Node(5) != nil {
+			t.Errorf("node 5 should be deleted")
+		}
+
+		if s.Node(6) == nil {
+			t.Errorf("node 6 should be created")
+		}
+	})
+
+	t.Run("older versions are skipped", func(t *testing.T) {
+		s := NewStore(testData())
+		_, err := s.Apply(&osm.Change{
+			Modify: &osm.OSM{Nodes: osm.Nodes{
+				{ID: 1, Version: 3, Lat: 0.0011, Lon: 0.0011, Visible: true},
+			}},
+		}, z)
+		if err != nil {
+			t.Fatalf("apply error: %v", err)
+		}
+
+		_, err = s.Apply(&osm.Change{
+			Modify: &osm.OSM{Nodes: osm.Nodes{
+				{ID: 1, Version: 2, Lat: 0.0012, Lon: 0.0012, Visible: true},
+			}},
+		}, z)
+		if err != nil {
+			t.Fatalf("apply error: %v", err)
+		}
+
+		if v := s.Node(1).Version; v != 3 {
+			t.Errorf("should keep newer version: %v", v)
+		}
+	})
+
+	t.Run("zoom too low", func(t *testing.T) {
+		s := NewStore(testData())
+		_, err := s.Apply(&osm.Change{}, 13)
+		if err == nil {
+			t.Errorf("should return error for zoom < 14")
+		}
+	})
+}
+
+func TestStoreData(t *testing.T) {
+	s := NewStore(testData())
+
+	// only includes node 1, but should get the full way and relation
+	data := s.Data(orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{0.005, 0.005}})
+
+	if l := len(data.Nodes); l != 2 {
+		t.Errorf("incorrect number of nodes: %v", l)
+	}
+
+	if l := len(data.Ways); l != 1 {
+		t.Errorf("incorrect number of ways: %v", l)
+	}
+
+	if l := len(data.Relations); l != 1 {
+		t.Errorf("incorrect number of relations: %v", l)
+	}
+
+	// only the relations one level up are included
+	s = NewStore(testData())
+	s.putRelation(&osm.Relation{ID: 101, Members: osm.Members{{Type: osm.TypeRelation, Ref: 100}}})
+	s.putRelation(&osm.Relation{ID: 102, Members: osm.Members{{Type: osm.TypeRelation, Ref: 101}}})
+	s.putRelation(&osm.Relation{ID: 103, Members: osm.Members{{Type: osm.TypeRelation, Ref: 102}}})
+
+	for i := 0; i < 10; i++ {
+		data = s.Data(orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{0.005, 0.005}})
+		if l := len(data.Relations); l != 2 {
+			t.Fatalf("incorrect number of relations: %v", l)
+		}
+	}
+}
+
+func TestStore_concurrent(t *testing.T) {
+	s := NewStore(testData())
+	bound := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{0.005, 0.005}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.Data(bound)
+			}
+		}()
+	}
+
+	for v := 2; v < 100; v++ {
+		_, err := s.Apply(&osm.Change{
+			Modify: &osm.OSM{Nodes: osm.Nodes{
+				{ID: 1, Version: v, Lat: 0.0010, Lon: 0.0010, Visible: true},
+			}},
+		}, 16)
+		if err != nil {
+			t.Fatalf("apply error: %v", err)
+		}
+	}
+
+	wg.Wait()
+}
+
+func TestStoreProcess(t *testing.T) {
+	config, err := osmzen.LoadDefaultConfig()
+	if err != nil {
+		t.Fatalf("unable to load config: %v", err)
+	}
+
+	s := NewStore(testData())
+	z := maptile.Zoom(16)
+	tiles := maptile.Set{
+		maptile.At(orb.Point{0.0010, 0.0010}, z): true,
+		maptile.At(orb.Point{0.1000, 0.1000}, z): true,
+	}
+
+	var seen []maptile.Tile
+	err = s.Process(config, tiles, func(tile maptile.Tile, layers map[string]*geojson.FeatureCollection) error {
+		seen = append(seen, tile)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("process error: %v", err)
+	}
+
+	if len(seen) != 2 {
+		t.Fatalf("should process all the tiles: %v", seen)
+	}
+
+	if seen[0].X > seen[1].X {
+		t.Errorf("tiles should be processed in order: %v", seen)
+	}
+}
+
+func TestReadChange(t *testing.T) {
+	doc := `<osmChange version="0.6">
+  <modify>
+    <node id="5" version="2" lat="0.2" lon="0.2"/>
+  </modify>
+  <delete>
+    <way id="10" version="2"/>
+  </delete>
+</osmChange>`
+
+	change, err := ReadChange(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+
+	if l := len(change.Modify.Nodes); l != 1 {
+		t.Errorf("incorrect modified nodes: %v", l)
+	}
+
+	if l := len(change.Delete.Ways); l != 1 {
+		t.Errorf("incorrect deleted ways: %v", l)
+	}
+}
+
+func compareSets(t testing.TB, result, expected maptile.Set) {
+	t.Helper()
+
+	if len(result) != len(expected) {
+		t.Errorf("incorrect number of tiles: %v != %v", len(result), len(expected))
+	}
+
+	for tile := range expected {
+		if !result[tile] {
+			t.Errorf("missing tile: %v", tile)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package util
+
+import "testing"
+
+func TestParseColour(t *testing.T) {
+	cases := []struct {
+		name   string
+		value  string
+		result string
+		ok     bool
+	}{
+		{"css name", "Red", "#ff0000", true},
+		{"css name with space", "light grey", "#d3d3d3", true},
+		{"short hex", "#F0a", "#ff00aa", true},
+		{"long hex", "#12AB3c", "#12ab3c", true},
+		{"hex without hash", "12ab3c", "#12ab3c", true},
+		{"with spaces", "  #fff ", "#ffffff", true},
+		{"bad hex", "#12345", "", false},
+		{"short hex without hash", "add", "", false},
+		{"unknown name", "reddish", "", false},
+		{"empty", "", "", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, ok := NormalizeColour(tc.value)
+			if ok != tc.ok {
+				t.Fatalf("not parsed correctly: %v != %v", ok, tc.ok)
+			}
+
+			if v != tc.result {
+				t.Errorf("result not correct: %v != %v", v, tc.result)
+			}
+		})
+	}
+}
+
+func TestColourDistance(t *testing.T) {
+	red := Colour{255, 0, 0}
+	crimson := Colour{220, 20, 60}
+	blue := Colour{0, 0, 255}
+
+	if d := red.Distance(red); d != 0 {
+		t.Errorf("same colour should have zero distance: %v", d)
+	}
+
+	if red.Distance(crimson) >= red.Distance(blue) {
+		t.Errorf("crimson should be closer to red than blue")
+	}
+
+	if red.Distance(blue) != blue.Distance(red) {
+		t.Errorf("distance should be symmetric")
+	}
+}
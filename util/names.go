@@ -0,0 +1,14 @@
+package util
+
+import "strings"
+
+// IsNameTranslation returns true for `name:<lang>` keys, e.g. `name:en`.
+// `name:short` is an alternate name and `name:left`, `name:right` are the
+// names of the sides of a boundary, they are not translations.
+func IsNameTranslation(key string) bool {
+	if !strings.HasPrefix(key, "name:") || key == "name:short" {
+		return false
+	}
+
+	return !strings.HasPrefix(key, "name:left") && !strings.HasPrefix(key, "name:right")
+}
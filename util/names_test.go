@@ -0,0 +1,24 @@
+package util
+
+import "testing"
+
+func TestIsNameTranslation(t *testing.T) {
+	cases := []struct {
+		key    string
+		result bool
+	}{
+		{"name:en", true},
+		{"name:zh-Hans", true},
+		{"name", false},
+		{"name:short", false},
+		{"name:left", false},
+		{"name:right:de", false},
+		{"old_name:en", false},
+	}
+
+	for _, tc := range cases {
+		if v := IsNameTranslation(tc.key); v != tc.result {
+			t.Errorf("%s: incorrect result: %v != %v", tc.key, v, tc.result)
+		}
+	}
+}
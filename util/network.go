@@ -0,0 +1,21 @@
+package util
+
+import "strings"
+
+// NetworkImportance returns a number representing the importance of the
+// route network, where lower numbers are more important. National networks,
+// and `US:I` interstates, are 1. Regional networks, and `US:US` highways, are 2.
+// Other networks are considered less important the deeper they are in the
+// hierarchy, e.g. `US:CA` is 5 and `US:CA:Santa Clara` is 6.
+// Callers should handle empty and their own well known networks first.
+func NetworkImportance(network string) int {
+	if network == "US:I" || strings.Contains(network, ":national") {
+		return 1
+	}
+
+	if network == "US:US" || strings.Contains(network, "regional") {
+		return 2
+	}
+
+	return len(strings.Split(network, ":")) + 3
+}
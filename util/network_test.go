@@ -0,0 +1,24 @@
+package util
+
+import "testing"
+
+func TestNetworkImportance(t *testing.T) {
+	cases := []struct {
+		network    string
+		importance int
+	}{
+		{"US:I", 1},
+		{"GB:national", 1},
+		{"US:US", 2},
+		{"DE:regional:BY", 2},
+		{"US:CA", 5},
+		{"US:CA:Santa Clara", 6},
+		{"lcn", 4},
+	}
+
+	for _, tc := range cases {
+		if v := NetworkImportance(tc.network); v != tc.importance {
+			t.Errorf("%s: incorrect importance: %v != %v", tc.network, v, tc.importance)
+		}
+	}
+}